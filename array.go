@@ -0,0 +1,309 @@
+// Copyright © 2019 Praveen Tirumandyam praveen.tirumandyam@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package efp
+
+// size returns the rows and columns of arr. Rows of ragged arrays shorter than
+// the longest are taken as padded with #N/A, see at
+func (arr Array) size() (int, int) {
+	cols := 0
+	for _, row := range arr {
+		if len(row) > cols {
+			cols = len(row)
+		}
+	}
+	return len(arr), cols
+}
+
+// at returns the value at row i and column j of arr, #N/A outside the
+// values of ragged rows
+func (arr Array) at(i, j int) interface{} {
+	if i < len(arr) && j < len(arr[i]) {
+		return arr[i][j]
+	}
+	return ErrNA
+}
+
+// newArray returns an Array of rows and columns holding the values of fn
+func newArray(rows, cols int, fn func(i, j int) interface{}) Array {
+	out := make(Array, rows)
+	for i := range out {
+		out[i] = make([]interface{}, cols)
+		for j := range out[i] {
+			out[i][j] = fn(i, j)
+		}
+	}
+	return out
+}
+
+// VStack implements Excel's VSTACK function appending the rows of arrays.
+// Arrays narrower than the widest are padded with #N/A
+func VStack(arrays ...Array) Array {
+	width := 0
+	var out Array
+	for _, a := range arrays {
+		if _, cols := a.size(); cols > width {
+			width = cols
+		}
+	}
+	for _, a := range arrays {
+		rows, _ := a.size()
+		out = append(out, newArray(rows, width, a.at)...)
+	}
+	return out
+}
+
+// HStack implements Excel's HSTACK function appending the columns of arrays.
+// Arrays shorter than the tallest are padded with #N/A
+func HStack(arrays ...Array) Array {
+	height := 0
+	for _, a := range arrays {
+		if rows, _ := a.size(); rows > height {
+			height = rows
+		}
+	}
+	out := make(Array, height)
+	for _, a := range arrays {
+		_, cols := a.size()
+		for i := range out {
+			for j := 0; j < cols; j++ {
+				out[i] = append(out[i], a.at(i, j))
+			}
+		}
+	}
+	return out
+}
+
+// takeSpan returns the first and last index plus one of n items taken from the
+// start of count items, or from the end when n is negative
+func takeSpan(count, n int) (int, int) {
+	if n < 0 {
+		if -n > count {
+			return 0, count
+		}
+		return count + n, count
+	}
+	if n > count {
+		return 0, count
+	}
+	return 0, n
+}
+
+// slice returns the rows from r0 to r1 and columns from c0 to c1 of arr
+func (arr Array) slice(r0, r1, c0, c1 int) Array {
+	return newArray(r1-r0, c1-c0, func(i, j int) interface{} { return arr.at(r0+i, c0+j) })
+}
+
+// Take implements Excel's TAKE function returning rows and cols from the
+// start of arr, or from the end when negative. Returns ErrCalc if rows or
+// cols is 0
+func Take(arr Array, rows, cols int) (Array, error) {
+	if rows == 0 || cols == 0 {
+		return nil, ErrCalc
+	}
+	h, w := arr.size()
+	r0, r1 := takeSpan(h, rows)
+	c0, c1 := takeSpan(w, cols)
+	return arr.slice(r0, r1, c0, c1), nil
+}
+
+// Drop implements Excel's DROP function removing rows and cols from the start
+// of arr, or from the end when negative. Returns ErrCalc if nothing remains
+func Drop(arr Array, rows, cols int) (Array, error) {
+	h, w := arr.size()
+	r0, r1 := dropSpan(h, rows)
+	c0, c1 := dropSpan(w, cols)
+	if r0 >= r1 || c0 >= c1 {
+		return nil, ErrCalc
+	}
+	return arr.slice(r0, r1, c0, c1), nil
+}
+
+func dropSpan(count, n int) (int, int) {
+	if n < 0 {
+		if -n > count {
+			return 0, 0
+		}
+		return 0, count + n
+	}
+	if n > count {
+		return count, count
+	}
+	return n, count
+}
+
+// position returns the 0 based index of the 1 based index n among count items,
+// counted from the end when negative. Returns ErrValue if n is out of range
+func position(count, n int) (int, error) {
+	switch {
+	case n > 0 && n <= count:
+		return n - 1, nil
+	case n < 0 && -n <= count:
+		return count + n, nil
+	}
+	return 0, ErrValue
+}
+
+// ChooseRows implements Excel's CHOOSEROWS function returning the rows of arr
+// numbered by idx. Negative numbers count from the end
+func ChooseRows(arr Array, idx ...int) (Array, error) {
+	h, w := arr.size()
+	out := make(Array, 0, len(idx))
+	for _, n := range idx {
+		i, err := position(h, n)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, arr.slice(i, i+1, 0, w)...)
+	}
+	return out, nil
+}
+
+// ChooseCols implements Excel's CHOOSECOLS function returning the columns of
+// arr numbered by idx. Negative numbers count from the end
+func ChooseCols(arr Array, idx ...int) (Array, error) {
+	h, w := arr.size()
+	cols := make([]int, len(idx))
+	for k, n := range idx {
+		j, err := position(w, n)
+		if err != nil {
+			return nil, err
+		}
+		cols[k] = j
+	}
+	return newArray(h, len(cols), func(i, k int) interface{} { return arr.at(i, cols[k]) }), nil
+}
+
+// flatten returns the values of arr row by row, or column by column when
+// byCol is set. Ignore 1 skips blanks, 2 errors and 3 both
+func (arr Array) flatten(ignore int, byCol bool) ([]interface{}, error) {
+	if ignore < 0 || ignore > 3 {
+		return nil, ErrValue
+	}
+	h, w := arr.size()
+	var out []interface{}
+	add := func(i, j int) {
+		v := arr.at(i, j)
+		if _, isErr := v.(ErrorValue); (ignore&1 != 0 && (v == nil || v == "")) || (ignore&2 != 0 && isErr) {
+			return
+		}
+		out = append(out, v)
+	}
+	if byCol {
+		for j := 0; j < w; j++ {
+			for i := 0; i < h; i++ {
+				add(i, j)
+			}
+		}
+	} else {
+		for i := 0; i < h; i++ {
+			for j := 0; j < w; j++ {
+				add(i, j)
+			}
+		}
+	}
+	if len(out) == 0 {
+		return nil, ErrCalc
+	}
+	return out, nil
+}
+
+// ToCol implements Excel's TOCOL function returning the values of arr in a
+// single column. See flatten for ignore and byCol
+func ToCol(arr Array, ignore int, byCol bool) (Array, error) {
+	vals, err := arr.flatten(ignore, byCol)
+	if err != nil {
+		return nil, err
+	}
+	return newArray(len(vals), 1, func(i, _ int) interface{} { return vals[i] }), nil
+}
+
+// ToRow implements Excel's TOROW function returning the values of arr in a
+// single row. See flatten for ignore and byCol
+func ToRow(arr Array, ignore int, byCol bool) (Array, error) {
+	vals, err := arr.flatten(ignore, byCol)
+	if err != nil {
+		return nil, err
+	}
+	return Array{vals}, nil
+}
+
+// vector returns the values of an array of a single row or column. Returns
+// ErrValue for other arrays
+func (arr Array) vector() ([]interface{}, error) {
+	h, w := arr.size()
+	if h != 1 && w != 1 {
+		return nil, ErrValue
+	}
+	return arr.flatten(0, false)
+}
+
+// WrapRows implements Excel's WRAPROWS function placing the values of vector
+// in rows of wrap values. The last row is padded with pad
+func WrapRows(vector Array, wrap int, pad interface{}) (Array, error) {
+	vals, err := vector.vector()
+	if err != nil {
+		return nil, err
+	}
+	if wrap < 1 {
+		return nil, ErrNum
+	}
+	rows := (len(vals) + wrap - 1) / wrap
+	return newArray(rows, wrap, func(i, j int) interface{} {
+		if k := i*wrap + j; k < len(vals) {
+			return vals[k]
+		}
+		return pad
+	}), nil
+}
+
+// WrapCols implements Excel's WRAPCOLS function placing the values of vector
+// in columns of wrap values. The last column is padded with pad
+func WrapCols(vector Array, wrap int, pad interface{}) (Array, error) {
+	vals, err := vector.vector()
+	if err != nil {
+		return nil, err
+	}
+	if wrap < 1 {
+		return nil, ErrNum
+	}
+	cols := (len(vals) + wrap - 1) / wrap
+	return newArray(wrap, cols, func(i, j int) interface{} {
+		if k := j*wrap + i; k < len(vals) {
+			return vals[k]
+		}
+		return pad
+	}), nil
+}
+
+// Expand implements Excel's EXPAND function growing arr to rows and cols
+// padded with pad. Returns ErrValue if arr is larger
+func Expand(arr Array, rows, cols int, pad interface{}) (Array, error) {
+	h, w := arr.size()
+	if rows < h || cols < w {
+		return nil, ErrValue
+	}
+	return newArray(rows, cols, func(i, j int) interface{} {
+		if i < h && j < w {
+			return arr.at(i, j)
+		}
+		return pad
+	}), nil
+}
+
+// Transpose implements Excel's TRANSPOSE function
+func Transpose(arr Array) Array {
+	h, w := arr.size()
+	return newArray(w, h, func(i, j int) interface{} { return arr.at(j, i) })
+}
@@ -0,0 +1,116 @@
+package efp
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestArrayShaping(t *testing.T) {
+	a := Array{{1.0, 2.0, 3.0}, {4.0, 5.0, 6.0}}
+	ragged := Array{{1.0}, {2.0, 3.0}}
+	tt := []struct {
+		name string
+		fn   func() (Array, error)
+		out  Array
+		err  error
+	}{
+		{"VSTACK pads narrow arrays", func() (Array, error) { return VStack(a, Array{{7.0}}), nil },
+			Array{{1.0, 2.0, 3.0}, {4.0, 5.0, 6.0}, {7.0, ErrNA, ErrNA}}, nil},
+		{"HSTACK pads short arrays", func() (Array, error) { return HStack(Array{{0.0}}, a), nil },
+			Array{{0.0, 1.0, 2.0, 3.0}, {ErrNA, 4.0, 5.0, 6.0}}, nil},
+		{"Ragged rows are padded", func() (Array, error) { return Transpose(ragged), nil },
+			Array{{1.0, 2.0}, {ErrNA, 3.0}}, nil},
+		{"TAKE from the start", func() (Array, error) { return Take(a, 1, 2) },
+			Array{{1.0, 2.0}}, nil},
+		{"TAKE from the end", func() (Array, error) { return Take(a, -1, -1) },
+			Array{{6.0}}, nil},
+		{"TAKE nothing", func() (Array, error) { return Take(a, 0, 1) }, nil, ErrCalc},
+		{"DROP", func() (Array, error) { return Drop(a, 1, -1) },
+			Array{{4.0, 5.0}}, nil},
+		{"DROP everything", func() (Array, error) { return Drop(a, 2, 0) }, nil, ErrCalc},
+		{"CHOOSEROWS", func() (Array, error) { return ChooseRows(a, -1, 1) },
+			Array{{4.0, 5.0, 6.0}, {1.0, 2.0, 3.0}}, nil},
+		{"CHOOSECOLS", func() (Array, error) { return ChooseCols(a, 3, 3) },
+			Array{{3.0, 3.0}, {6.0, 6.0}}, nil},
+		{"CHOOSECOLS out of range", func() (Array, error) { return ChooseCols(a, 4) }, nil, ErrValue},
+		{"TOCOL by column", func() (Array, error) { return ToCol(a, 0, true) },
+			Array{{1.0}, {4.0}, {2.0}, {5.0}, {3.0}, {6.0}}, nil},
+		{"TOROW ignoring blanks and errors", func() (Array, error) {
+			return ToRow(Array{{1.0, nil}, {ErrDiv0, "x"}}, 3, false)
+		}, Array{{1.0, "x"}}, nil},
+		{"WRAPROWS", func() (Array, error) { return WrapRows(Array{{1.0, 2.0, 3.0, 4.0, 5.0}}, 2, ErrNA) },
+			Array{{1.0, 2.0}, {3.0, 4.0}, {5.0, ErrNA}}, nil},
+		{"WRAPCOLS", func() (Array, error) { return WrapCols(Array{{1.0}, {2.0}, {3.0}}, 2, "") },
+			Array{{1.0, 3.0}, {2.0, ""}}, nil},
+		{"WRAPROWS of a table", func() (Array, error) { return WrapRows(a, 2, ErrNA) }, nil, ErrValue},
+		{"WRAPROWS by zero", func() (Array, error) { return WrapRows(Array{{1.0}}, 0, ErrNA) }, nil, ErrNum},
+		{"EXPAND", func() (Array, error) { return Expand(Array{{1.0}}, 2, 2, 0.0) },
+			Array{{1.0, 0.0}, {0.0, 0.0}}, nil},
+		{"EXPAND smaller", func() (Array, error) { return Expand(a, 1, 3, 0.0) }, nil, ErrValue},
+	}
+	var errCnt int
+	for _, tu := range tt {
+		out, err := tu.fn()
+		if !reflect.DeepEqual(out, tu.out) || err != tu.err {
+			t.Logf("Test: %v, Expected: %v %v, Got: %v %v", tu.name, tu.out, tu.err, out, err)
+			errCnt++
+		}
+	}
+	if errCnt > 0 {
+		t.Errorf("Failed %v of %v test cases", errCnt, len(tt))
+	}
+}
+
+func TestArrayFormulas(t *testing.T) {
+	wb := NewWorkbook()
+	s := wb.AddSheet("Sheet1")
+	for row := 1; row <= 3; row++ {
+		for col := 1; col <= 2; col++ {
+			s.SetValue(ColumnName(col)+strconv.Itoa(row), float64(row*10+col))
+		}
+	}
+	tt := []struct {
+		exp string
+		out interface{}
+	}{
+		{"SUM(VSTACK(A1:B1,A3:B3))", 11.0 + 12.0 + 31.0 + 32.0},
+		{"SUM(VSTACK(A1:B1,A3))", ErrNA},
+		{"COUNT(HSTACK(A1:A3,B1))", 4.0},
+		{"SUM(TAKE(A1:B3,-1))", 63.0},
+		{"SUM(TAKE(A1:B3,,1))", 63.0},
+		{"SUM(DROP(A1:B3,1,1))", 54.0},
+		{"ROWS(TOCOL(A1:B3))", 6.0},
+		{"COLUMNS(TRANSPOSE(A1:B3))", 3.0},
+		{"ARRAYTOTEXT(WRAPCOLS(TOCOL(A1:B2),3,0))", "11, 22, 12, 0, 21, 0"},
+		{"ARRAYTOTEXT(CHOOSEROWS(A1:B3,3,1))", "31, 32, 11, 12"},
+		{"ARRAYTOTEXT(EXPAND(A1,2,1))", "11, #N/A"},
+		{"ARRAYTOTEXT(TRANSPOSE({1,2,3}),1)", "{1;2;3}"},
+		{"ARRAYTOTEXT(VSTACK({1,2},{3}),1)", "{1,2;3,#N/A}"},
+		{"ARRAYTOTEXT(HSTACK({1;2},{3,4}),1)", "{1,3,4;2,#N/A,#N/A}"},
+		{`ARRAYTOTEXT(VSTACK({"a",TRUE},{#DIV/0!,-1.5}),1)`, `{"a",TRUE;#DIV/0!,-1.5}`},
+		{"SUM(TAKE({1,2;3,4},-1))", 7.0},
+		{"ARRAYTOTEXT(WRAPROWS({1,2,3},2),1)", "{1,2;3,#N/A}"},
+		{"ROWS(VSTACK(A1:B1,{1,2;3,4}))", 3.0},
+	}
+	var errCnt int
+	for _, tu := range tt {
+		out, err := wb.EvaluateFormula(context.Background(), "Sheet1", tu.exp, nil)
+		if e, ok := err.(ErrorValue); ok {
+			out = e
+		}
+		if out != tu.out {
+			t.Logf("Test: %v, Expected: %v, Got: %v %v", tu.exp, tu.out, out, err)
+			errCnt++
+		}
+	}
+	// Excel does not accept array constants with rows of different length
+	if out, err := wb.EvaluateFormula(context.Background(), "Sheet1", "SUM({1,2;3})", nil); err == nil {
+		t.Logf("Test: %v, Expected: error, Got: %v", "SUM({1,2;3})", out)
+		errCnt++
+	}
+	if errCnt > 0 {
+		t.Errorf("Failed %v of %v test cases", errCnt, len(tt)+1)
+	}
+}
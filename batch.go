@@ -0,0 +1,264 @@
+// Copyright © 2019 Praveen Tirumandyam praveen.tirumandyam@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package efp
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+	"unsafe"
+
+	"github.com/PaesslerAG/gval"
+)
+
+// Columns holds the values of variables for many rows, one slice per
+// variable. Slices of float64, int, int64, string, bool, time.Time and
+// interface{} are read without reflection; other slices are read with Bind.
+// Values of float64, int, int64, string, bool and time.Time slices are read
+// without allocating. All slices must have the same length
+type Columns map[string]interface{}
+
+// BatchOptions controls EvaluateColumns
+type BatchOptions struct {
+	// Workers is the number of goroutines evaluating rows. 0 or 1 evaluates
+	// the rows in the calling goroutine, a negative value uses GOMAXPROCS
+	Workers int
+}
+
+// NumberResults are the results of EvaluateNumbers
+type NumberResults struct {
+	// Numbers holds the result of every row, 0 for rows whose result is not
+	// a number
+	Numbers []float64
+	// Others holds the results which are not numbers, like Excel errors and
+	// text, by row
+	Others map[int]interface{}
+}
+
+// column reads the value of one variable for a row
+type column func(i int) interface{}
+
+// columnRow is the parameter a formula is evaluated with for one row. Each
+// worker reuses a single columnRow, moving it from row to row
+type columnRow struct {
+	cols map[string]column
+	i    int
+}
+
+// selectName implements nameSelector
+func (r *columnRow) selectName(c context.Context, name string) (interface{}, bool, error) {
+	col, ok := r.cols[name]
+	if !ok {
+		return nil, false, nil
+	}
+	return col(r.i), true, nil
+}
+
+// EvaluateColumns evaluates eval once for every row of cols and returns the
+// results in row order. Excel errors are results like any other value;
+// other errors stop the evaluation and are returned with the row they
+// happened in. Results do not depend on the number of workers.
+//
+// Reading the columns does not allocate, but the formula engine produces
+// every intermediate value and result as an interface{}, so each row still
+// allocates for the numbers it computes. EvaluateNumbers keeps the results
+// of formulas computing numbers in a []float64 instead
+func EvaluateColumns(c context.Context, eval gval.Evaluable, cols Columns, opts BatchOptions) ([]interface{}, error) {
+	readers, rows, err := columnReaders(cols)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]interface{}, rows)
+	err = evaluateBatch(c, eval, readers, rows, opts, func(i int, v interface{}) { out[i] = v })
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// EvaluateNumbers evaluates eval for every row of cols like EvaluateColumns
+// and returns the results as numbers, keeping the results which are not
+// numbers aside
+func EvaluateNumbers(c context.Context, eval gval.Evaluable, cols Columns, opts BatchOptions) (NumberResults, error) {
+	readers, rows, err := columnReaders(cols)
+	if err != nil {
+		return NumberResults{}, err
+	}
+	res := NumberResults{Numbers: make([]float64, rows), Others: make(map[int]interface{})}
+	var mu sync.Mutex
+	err = evaluateBatch(c, eval, readers, rows, opts, func(i int, v interface{}) {
+		if n, ok := v.(float64); ok {
+			res.Numbers[i] = n
+			return
+		}
+		mu.Lock()
+		res.Others[i] = v
+		mu.Unlock()
+	})
+	if err != nil {
+		return NumberResults{}, err
+	}
+	return res, nil
+}
+
+// columnReaders returns the readers of cols by name and their number of rows
+func columnReaders(cols Columns) (map[string]column, int, error) {
+	readers := make(map[string]column, len(cols))
+	rows := -1
+	names := make([]string, 0, len(cols))
+	for name := range cols {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		col, n, err := columnReader(cols[name])
+		if err != nil {
+			return nil, 0, fmt.Errorf("column %s: %v", name, err)
+		}
+		if rows >= 0 && n != rows {
+			return nil, 0, fmt.Errorf("column %s has %d rows, expected %d", name, n, rows)
+		}
+		readers[name], rows = col, n
+	}
+	if rows < 0 {
+		rows = 0
+	}
+	return readers, rows, nil
+}
+
+// evaluateBatch evaluates rows of readers on the workers of opts and passes
+// each result to store with its row
+func evaluateBatch(c context.Context, eval gval.Evaluable, readers map[string]column, rows int, opts BatchOptions, store func(int, interface{})) error {
+	workers := opts.Workers
+	if workers < 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers <= 1 || rows < 2 {
+		return evaluateRows(c, eval, readers, store, 0, rows)
+	}
+	if workers > rows {
+		workers = rows
+	}
+
+	// Workers are not stopped when another fails so that the error returned
+	// is always the one of the first failing row
+	errs := make([]error, workers)
+	var wg sync.WaitGroup
+	chunk := (rows + workers - 1) / workers
+	for w := 0; w < workers; w++ {
+		from, to := w*chunk, (w+1)*chunk
+		if to > rows {
+			to = rows
+		}
+		wg.Add(1)
+		go func(w, from, to int) {
+			defer wg.Done()
+			errs[w] = evaluateRows(c, eval, readers, store, from, to)
+		}(w, from, to)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// evaluateRows evaluates rows from up to to, passing results to store
+func evaluateRows(c context.Context, eval gval.Evaluable, cols map[string]column, store func(int, interface{}), from, to int) error {
+	r := &columnRow{cols: cols}
+	for i := from; i < to; i++ {
+		if err := c.Err(); err != nil {
+			return err
+		}
+		r.i = i
+		v, err := eval(c, r)
+		if e, ok := err.(ErrorValue); ok {
+			v, err = e, nil
+		}
+		if err != nil {
+			if _, ok := err.(*LimitError); ok {
+				return err
+			}
+			return fmt.Errorf("row %d: %v", i, err)
+		}
+		store(i, v)
+	}
+	return nil
+}
+
+// columnReader returns the reader of slice v and its length
+func columnReader(v interface{}) (column, int, error) {
+	switch s := v.(type) {
+	case []float64:
+		return floatColumn(append([]float64(nil), s...)), len(s), nil
+	case []int:
+		floats := make([]float64, len(s))
+		for i, n := range s {
+			floats[i] = float64(n)
+		}
+		return floatColumn(floats), len(s), nil
+	case []int64:
+		floats := make([]float64, len(s))
+		for i, n := range s {
+			floats[i] = float64(n)
+		}
+		return floatColumn(floats), len(s), nil
+	case []string:
+		return stringColumn(append([]string(nil), s...)), len(s), nil
+	case []bool:
+		// Single byte values are boxed without allocating
+		return func(i int) interface{} { return s[i] }, len(s), nil
+	case []time.Time:
+		floats := make([]float64, len(s))
+		for i, t := range s {
+			floats[i] = SerialDate(t)
+		}
+		return floatColumn(floats), len(s), nil
+	case []interface{}:
+		return func(i int) interface{} { return Bind(s[i]) }, len(s), nil
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, 0, fmt.Errorf("expected a slice but got %T", v)
+	}
+	return func(i int) interface{} { return Bind(rv.Index(i).Interface()) }, rv.Len(), nil
+}
+
+// floatColumn returns the reader of numbers converted from a column once.
+// Each value read refers to its element of floats rather than to a copy
+// boxed for the row, so reading a number does not allocate. floats must be
+// owned by the column and never change as results may refer to it
+func floatColumn(floats []float64) column {
+	return func(i int) interface{} {
+		v := interface{}(0.0)
+		(*[2]unsafe.Pointer)(unsafe.Pointer(&v))[1] = unsafe.Pointer(&floats[i])
+		return v
+	}
+}
+
+// stringColumn returns the reader of texts like floatColumn does for numbers
+func stringColumn(strs []string) column {
+	return func(i int) interface{} {
+		v := interface{}("")
+		(*[2]unsafe.Pointer)(unsafe.Pointer(&v))[1] = unsafe.Pointer(&strs[i])
+		return v
+	}
+}
@@ -0,0 +1,122 @@
+package efp
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEvaluateColumns(t *testing.T) {
+	cols := Columns{
+		"qty":   []int{1, 2, 3, 4, 0},
+		"price": []float64{2.5, 1, 10, 0.5, 3},
+		"name":  []string{"a", "b", "c", "d", "e"},
+	}
+	tt := []struct {
+		name    string
+		formula string
+		cols    Columns
+		workers int
+		out     []interface{}
+		err     string
+	}{
+		{"Serial", "qty*price", cols, 0, []interface{}{2.5, 2.0, 30.0, 2.0, 0.0}, ""},
+		{"Parallel", "qty*price", cols, 3, []interface{}{2.5, 2.0, 30.0, 2.0, 0.0}, ""},
+		{"All processors", `UPPER(name)&qty`, cols, -1, []interface{}{"A1", "B2", "C3", "D4", "E0"}, ""},
+		{"Excel errors are values", "price/qty", cols, 2, []interface{}{2.5, 0.5, 10.0 / 3, 0.125, ErrDiv0}, ""},
+		{"Unknown column", "qty*cost", cols, 2, nil, "row 0: unknown parameter cost"},
+		{"Columns of different length", "a+b", Columns{"a": []float64{1}, "b": []float64{1, 2}}, 0, nil, "column b has 2 rows, expected 1"},
+		{"Slice of other type", "a*2", Columns{"a": []int32{1, 2}}, 0, []interface{}{2.0, 4.0}, ""},
+		{"Not a slice", "a", Columns{"a": 1.0}, 0, nil, "column a: expected a slice but got float64"},
+	}
+	var errCnt int
+	for _, tu := range tt {
+		eval, err := Parse(strings.NewReader(tu.formula))
+		if err != nil {
+			t.Logf("Test: %v, Parse failed, Error: %v", tu.name, err)
+			errCnt++
+			continue
+		}
+		out, err := EvaluateColumns(context.Background(), eval, tu.cols, BatchOptions{Workers: tu.workers})
+		errText := ""
+		if err != nil {
+			errText = err.Error()
+		}
+		if errText != tu.err || !reflect.DeepEqual(out, tu.out) {
+			t.Logf("Test: %v, Expected: %v %v, Got: %v %v", tu.name, tu.out, tu.err, out, errText)
+			errCnt++
+		}
+	}
+	if errCnt > 0 {
+		t.Errorf("Failed %v of %v test cases", errCnt, len(tt))
+	}
+}
+
+func TestFloatColumn(t *testing.T) {
+	in := []float64{1.5, 2}
+	col, _, err := columnReader(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if allocs := testing.AllocsPerRun(100, func() { col(1) }); allocs != 0 {
+		t.Errorf("Expected: 0 allocations, Got: %v", allocs)
+	}
+	v := col(0)
+	in[0] = 9
+	if v != 1.5 || col(1) != 2.0 {
+		t.Errorf("Expected: 1.5 2, Got: %v %v", v, col(1))
+	}
+}
+
+func TestColumnAllocations(t *testing.T) {
+	tt := []struct {
+		name string
+		col  interface{}
+		out  interface{}
+	}{
+		{"Numbers", []float64{1.5, 2}, 2.0},
+		{"Integers", []int{1, 2}, 2.0},
+		{"Texts", []string{"a", "b"}, "b"},
+		{"Booleans", []bool{false, true}, true},
+		{"Dates", []time.Time{{}, time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)}, 43466.0},
+	}
+	var errCnt int
+	for _, tu := range tt {
+		col, _, err := columnReader(tu.col)
+		if err != nil {
+			t.Logf("Test: %v, Reader failed, Error: %v", tu.name, err)
+			errCnt++
+			continue
+		}
+		allocs := testing.AllocsPerRun(100, func() { col(1) })
+		if v := col(1); allocs != 0 || v != tu.out {
+			t.Logf("Test: %v, Expected: %v with 0 allocations, Got: %v with %v", tu.name, tu.out, v, allocs)
+			errCnt++
+		}
+	}
+	if errCnt > 0 {
+		t.Errorf("Failed %v of %v test cases", errCnt, len(tt))
+	}
+}
+
+func TestEvaluateNumbers(t *testing.T) {
+	cols := Columns{
+		"qty":   []int{1, 2, 3, 4, 0},
+		"price": []float64{2.5, 1, 10, 0.5, 3},
+	}
+	eval, err := Parse(strings.NewReader(`IF(qty=3,"n/a",price/qty)`))
+	if err != nil {
+		t.Fatalf("Parse failed, Error: %v", err)
+	}
+	res, err := EvaluateNumbers(context.Background(), eval, cols, BatchOptions{Workers: 2})
+	if err != nil {
+		t.Fatalf("EvaluateNumbers failed, Error: %v", err)
+	}
+	numbers := []float64{2.5, 0.5, 0, 0.125, 0}
+	others := map[int]interface{}{2: "n/a", 4: ErrDiv0}
+	if !reflect.DeepEqual(res.Numbers, numbers) || !reflect.DeepEqual(res.Others, others) {
+		t.Errorf("Expected: %v %v, Got: %v %v", numbers, others, res.Numbers, res.Others)
+	}
+}
@@ -0,0 +1,203 @@
+// Copyright © 2019 Praveen Tirumandyam praveen.tirumandyam@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package efp
+
+import (
+	"container/list"
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/PaesslerAG/gval"
+)
+
+// relRoot is the root of the variable path carrying references in R1C1
+// notation relative to the cell a formula is evaluated for. relAreaRoot
+// carries them like areaRoot
+const (
+	relRoot     = "_rel"
+	relAreaRoot = "_relArea"
+)
+
+// Cache keeps compiled formulas so that a formula used many times is parsed
+// once. It holds at most size formulas and discards the least recently used
+// one to make room. A Cache is safe for concurrent use
+type Cache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[string]*list.Element
+	lru     *list.List
+	stats   CacheStats
+	// Limits are checked when formulas are parsed and applied to their
+	// evaluations like Limits.Parse does. Set them before using the cache
+	Limits Limits
+}
+
+// CacheStats reports the use of a Cache
+type CacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	// Len is the number of formulas in the cache
+	Len int
+}
+
+type cacheEntry struct {
+	key   string
+	eval  gval.Evaluable
+	depth int
+}
+
+// NewCache creates a cache holding up to size compiled formulas
+func NewCache(size int) *Cache {
+	if size < 1 {
+		size = 1
+	}
+	return &Cache{size: size, entries: make(map[string]*list.Element), lru: list.New()}
+}
+
+// Parse returns formula compiled as efp.Parse does, or as Limits.Parse does
+// when the cache has Limits. The formula is parsed only if the same text is
+// not in the cache
+func (ca *Cache) Parse(formula string) (gval.Evaluable, error) {
+	e, err := ca.compile(formula, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkNesting(e.depth, ca.Limits.MaxDepth); err != nil {
+		return nil, err
+	}
+	return ca.limited(e.eval), nil
+}
+
+// ParseAt returns formula compiled for cell host. Formulas which are the same
+// in R1C1 notation, like =B2*2 in A2 and =B3*2 in A3, share one compiled
+// formula that finds relative references from the cell it is evaluated for
+func (ca *Cache) ParseAt(formula string, host CellRef) (gval.Evaluable, error) {
+	e, err := ca.compile(formula, &host)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkNesting(e.depth, ca.Limits.MaxDepth); err != nil {
+		return nil, err
+	}
+	return ca.limited(atHost(e.eval, host)), nil
+}
+
+// limited returns eval evaluating within the limits of the cache, if any
+func (ca *Cache) limited(eval gval.Evaluable) gval.Evaluable {
+	if ca.Limits == (Limits{}) {
+		return eval
+	}
+	return ca.Limits.apply(eval)
+}
+
+// Stats returns the use of the cache so far
+func (ca *Cache) Stats() CacheStats {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	st := ca.stats
+	st.Len = ca.lru.Len()
+	return st
+}
+
+// compile returns the cache entry of formula. Formulas given with a host
+// are keyed by their R1C1 form
+func (ca *Cache) compile(formula string, host *CellRef) (*cacheEntry, error) {
+	exp := strings.TrimPrefix(formula, "=")
+	key := "A1:" + exp
+	var toks []token
+	if host != nil {
+		var err error
+		if toks, err = lex(exp); err != nil {
+			return nil, err
+		}
+		toks = relativeTokens(toks, *host)
+		key = "R1C1:" + joinTokens(toks)
+	}
+	if e := ca.get(key); e != nil {
+		return e, nil
+	}
+
+	if toks == nil {
+		var err error
+		if toks, err = lex(exp); err != nil {
+			return nil, err
+		}
+	}
+	eval, err := excelLanguage.NewEvaluable(translate(toks))
+	if err != nil {
+		return nil, err
+	}
+	e := &cacheEntry{key: key, eval: eval, depth: nesting(toks)}
+	ca.add(e)
+	return e, nil
+}
+
+func (ca *Cache) get(key string) *cacheEntry {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	el, ok := ca.entries[key]
+	if !ok {
+		ca.stats.Misses++
+		return nil
+	}
+	ca.stats.Hits++
+	ca.lru.MoveToFront(el)
+	return el.Value.(*cacheEntry)
+}
+
+func (ca *Cache) add(e *cacheEntry) {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	if el, ok := ca.entries[e.key]; ok {
+		// Parsed by another goroutine meanwhile
+		ca.lru.MoveToFront(el)
+		return
+	}
+	ca.entries[e.key] = ca.lru.PushFront(e)
+	for ca.lru.Len() > ca.size {
+		el := ca.lru.Back()
+		ca.lru.Remove(el)
+		delete(ca.entries, el.Value.(*cacheEntry).key)
+		ca.stats.Evictions++
+	}
+}
+
+// relativeTokens replaces the references in toks by lookups of their R1C1
+// form relative to host
+func relativeTokens(toks []token, host CellRef) []token {
+	return referenceOperators(toks, relRoot, relAreaRoot, func(r Ref) string { return r.R1C1(host) })
+}
+
+type hostKey struct{}
+
+// atHost returns eval evaluating relative references from host
+func atHost(eval gval.Evaluable, host CellRef) gval.Evaluable {
+	return func(c context.Context, v interface{}) (interface{}, error) {
+		if c == nil {
+			c = context.Background()
+		}
+		return eval(context.WithValue(c, hostKey{}, host), v)
+	}
+}
+
+func hostFrom(c context.Context) (CellRef, bool) {
+	if c == nil {
+		return CellRef{}, false
+	}
+	host, ok := c.Value(hostKey{}).(CellRef)
+	return host, ok
+}
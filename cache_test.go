@@ -0,0 +1,126 @@
+package efp
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/PaesslerAG/gval"
+)
+
+func TestCache(t *testing.T) {
+	params := map[string]interface{}{"B2": 1.0, "B3": 2.0, "C1": 10.0}
+	ca := NewCache(3)
+	tt := []struct {
+		name    string
+		formula string
+		host    string
+		out     interface{}
+		hits    uint64
+	}{
+		{"First use", "=B2*2", "A2", 2.0, 0},
+		{"Same text", "=B2*2", "A2", 2.0, 1},
+		{"Copied down", "=B3*2", "A3", 4.0, 2},
+		{"Absolute reference", "=B3*$C$1", "A3", 20.0, 2},
+		{"Absolute reference copied", "=B2*$C$1", "A2", 10.0, 3},
+		{"Different formula", "=B2+2", "A2", 3.0, 3},
+		{"Different offset", "=B3*2", "A2", 4.0, 3},
+		{"Evicted", "=B2*2", "A2", 2.0, 3},
+	}
+	var errCnt int
+	for _, tu := range tt {
+		host, _ := ParseCellRef(tu.host)
+		eval, err := ca.ParseAt(tu.formula, host)
+		if err != nil {
+			t.Logf("Test: %v, Parse failed, Error: %v", tu.name, err)
+			errCnt++
+			continue
+		}
+		v, err := eval(context.Background(), params)
+		if st := ca.Stats(); err != nil || v != tu.out || st.Hits != tu.hits {
+			t.Logf("Test: %v, Expected: %v %v hits, Got: %v %v hits %v", tu.name, tu.out, tu.hits, v, st.Hits, err)
+			errCnt++
+		}
+	}
+	if st := ca.Stats(); st.Len != 3 || st.Evictions != 2 {
+		t.Logf("Test: Stats, Expected: 3 formulas 2 evictions, Got: %+v", st)
+		errCnt++
+	}
+	if errCnt > 0 {
+		t.Errorf("Failed %v of %v test cases", errCnt, len(tt))
+	}
+}
+
+func TestCacheConcurrent(t *testing.T) {
+	ca := NewCache(16)
+	var wg sync.WaitGroup
+	errs := make(chan error, 100)
+	for i := 1; i <= 100; i++ {
+		wg.Add(1)
+		go func(row int) {
+			defer wg.Done()
+			eval, err := ca.ParseAt(fmt.Sprintf("=B%d+1", row), CellRef{Row: row, Col: 1})
+			if err != nil {
+				errs <- err
+				return
+			}
+			v, err := eval(context.Background(), map[string]interface{}{fmt.Sprintf("B%d", row): float64(row)})
+			if err == nil && v != float64(row+1) {
+				err = fmt.Errorf("row %d: got %v", row, v)
+			}
+			if err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	if st := ca.Stats(); st.Len != 1 || st.Hits+st.Misses != 100 {
+		t.Errorf("Expected one formula after 100 lookups, Got: %+v", st)
+	}
+}
+
+func TestCacheLimits(t *testing.T) {
+	ca := NewCache(4)
+	ca.Limits = Limits{MaxDepth: 2, MaxStringLength: 5}
+	tt := []struct {
+		name    string
+		formula string
+		host    *CellRef
+		out     interface{}
+	}{
+		{"Within limits", "=((1+2))", nil, 3.0},
+		{"Too deep", "=(((1+2)))", nil, &LimitError{Limit: "MaxDepth", Max: 2}},
+		{"Too deep when cached", "=(((1+2)))", nil, &LimitError{Limit: "MaxDepth", Max: 2}},
+		{"Too deep for cell", "=(((B2)))", &CellRef{Row: 1, Col: 1}, &LimitError{Limit: "MaxDepth", Max: 2}},
+		{"Text too long", `=REPT("x",6)`, nil, &LimitError{Limit: "MaxStringLength", Max: 5}},
+	}
+	var errCnt int
+	for _, tu := range tt {
+		var eval gval.Evaluable
+		var err error
+		if tu.host != nil {
+			eval, err = ca.ParseAt(tu.formula, *tu.host)
+		} else {
+			eval, err = ca.Parse(tu.formula)
+		}
+		var v interface{}
+		if err == nil {
+			v, err = eval(context.Background(), nil)
+		}
+		if err != nil {
+			v = err
+		}
+		if fmt.Sprint(v) != fmt.Sprint(tu.out) {
+			t.Logf("Test: %v, Expected: %v, Got: %v", tu.name, tu.out, v)
+			errCnt++
+		}
+	}
+	if errCnt > 0 {
+		t.Errorf("Failed %v of %v test cases", errCnt, len(tt))
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright © 2019 Praveen Tirumandyam praveen.tirumandyam@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/praveentiru/efp"
+)
+
+// varFlags collects repeated -var name=value flags. Values are typed the
+// same way cells of a CSV file are
+type varFlags map[string]interface{}
+
+func (v varFlags) String() string {
+	return ""
+}
+
+func (v varFlags) Set(s string) error {
+	i := strings.IndexByte(s, '=')
+	if i <= 0 {
+		return fmt.Errorf("variable %q is not of the form name=value", s)
+	}
+	val, _ := efp.InferValue(s[i+1:])
+	v[strings.TrimSpace(s[:i])] = val
+	return nil
+}
+
+// result is the JSON output of a formula evaluation
+type result struct {
+	Value interface{} `json:"value"`
+	Type  string      `json:"type,omitempty"`
+	Error string      `json:"error,omitempty"`
+}
+
+func newResult(v interface{}, err error) result {
+	if e, ok := err.(efp.ErrorValue); ok {
+		v, err = e, nil
+	}
+	if err != nil {
+		return result{Error: err.Error()}
+	}
+	r := result{Value: v, Type: efp.ValueType(v)}
+	if e, ok := v.(efp.ErrorValue); ok {
+		r.Value, r.Error = string(e), string(e)
+	}
+	return r
+}
+
+func runEval(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("eval", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: efp eval [flags] [formula]")
+		fs.PrintDefaults()
+	}
+	vars := make(varFlags)
+	fs.Var(vars, "var", "set variable as `name=value`, may be repeated")
+	jsonVars := fs.String("json", "", "read variables from JSON object in `file`")
+	book := fs.String("xlsx", "", "evaluate against workbook in .xlsx `file`")
+	cell := fs.String("cell", "", "evaluate `Sheet!A1` of the workbook instead of a formula")
+	output := fs.String("o", "text", "output `format`: text or json")
+	locale := fs.String("locale", "en", "`language` formulas are written in: en, de, fr, es, it or pt")
+	pos, err := parseArgs(fs, args)
+	if err != nil {
+		return exitUsage
+	}
+	if *output != "text" && *output != "json" {
+		fmt.Fprintf(stderr, "efp eval: unknown output format %q\n", *output)
+		return exitUsage
+	}
+	loc, ok := efp.Locales[*locale]
+	if !ok {
+		fmt.Fprintf(stderr, "efp eval: unknown locale %q\n", *locale)
+		return exitUsage
+	}
+	if (len(pos) == 1) == (*cell != "") || len(pos) > 1 {
+		fs.Usage()
+		return exitUsage
+	}
+	if *cell != "" && *book == "" {
+		fmt.Fprintln(stderr, "efp eval: -cell needs -xlsx")
+		return exitUsage
+	}
+	if *jsonVars != "" {
+		if err := readVars(*jsonVars, vars); err != nil {
+			fmt.Fprintf(stderr, "efp eval: %v\n", err)
+			return exitError
+		}
+	}
+
+	var formula string
+	if len(pos) == 1 {
+		if formula, err = loc.Delocalize(pos[0]); err != nil {
+			fmt.Fprintf(stderr, "efp eval: %v\n", err)
+			return exitError
+		}
+	}
+	r := newResult(evaluate(context.Background(), formula, map[string]interface{}(vars), *book, *cell))
+	if *output == "json" {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(r)
+	} else if r.Type != "" {
+		fmt.Fprintln(stdout, loc.FormatValue(r.Value))
+	} else {
+		fmt.Fprintf(stderr, "efp eval: %s\n", r.Error)
+	}
+	if r.Type == "" {
+		return exitError
+	}
+	return exitOK
+}
+
+// readVars adds the members of JSON object in file to vars. Variables set
+// with -var take precedence
+func readVars(file string, vars varFlags) error {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return fmt.Errorf("%s: %v", file, err)
+	}
+	for k, v := range m {
+		if _, ok := vars[k]; !ok {
+			vars[k] = v
+		}
+	}
+	return nil
+}
+
+// evaluate computes formula, or cell of workbook when formula is empty.
+// Formulas given with a workbook are evaluated on its first sheet unless
+// they refer to another sheet
+func evaluate(c context.Context, formula string, vars map[string]interface{}, book, cell string) (interface{}, error) {
+	if book == "" {
+		eval, err := efp.Parse(strings.NewReader(formula))
+		if err != nil {
+			return nil, err
+		}
+		return eval(c, vars)
+	}
+	wb, err := efp.OpenXLSX(book)
+	if err != nil {
+		return nil, err
+	}
+	if len(wb.Sheets) == 0 {
+		return nil, errors.New("workbook has no sheets")
+	}
+	if cell == "" {
+		return wb.EvaluateFormula(c, wb.Sheets[0].Name, formula, vars)
+	}
+	ref, err := efp.ParseRef(cell)
+	if err != nil {
+		return nil, err
+	}
+	if ref.IsRange() {
+		return nil, fmt.Errorf("%s is not a single cell", cell)
+	}
+	sheet := ref.Sheet
+	if sheet == "" {
+		sheet = wb.Sheets[0].Name
+	}
+	return wb.Evaluate(c, sheet, ref.From.String())
+}
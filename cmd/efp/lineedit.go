@@ -0,0 +1,221 @@
+// Copyright © 2019 Praveen Tirumandyam praveen.tirumandyam@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// errInterrupt is returned by readLine when the user presses Ctrl-C
+var errInterrupt = errors.New("interrupted")
+
+// lineEditor reads lines from a terminal in raw mode. It supports moving the
+// cursor, recalling earlier lines with the arrow keys and completing the word
+// before the cursor with Tab
+type lineEditor struct {
+	in      *bufio.Reader
+	out     io.Writer
+	history []string
+	// complete returns the index in line where the word being completed
+	// starts and the words it may be completed to
+	complete func(line string) (int, []string)
+}
+
+// addHistory remembers line so it can be recalled. Empty lines and repeats
+// of the last line are not added
+func (e *lineEditor) addHistory(line string) bool {
+	if strings.TrimSpace(line) == "" || (len(e.history) > 0 && e.history[len(e.history)-1] == line) {
+		return false
+	}
+	e.history = append(e.history, line)
+	return true
+}
+
+// readLine shows prompt and returns the line entered without the newline.
+// Returns io.EOF for Ctrl-D on an empty line
+func (e *lineEditor) readLine(prompt string) (string, error) {
+	var line []rune
+	pos := 0
+	hist := len(e.history)
+	var editing []rune // line being edited while browsing history
+	recall := func(i int) {
+		if hist == len(e.history) {
+			editing = line
+		}
+		hist = i
+		if hist == len(e.history) {
+			line = editing
+		} else {
+			line = []rune(e.history[hist])
+		}
+		pos = len(line)
+	}
+	e.refresh(prompt, line, pos)
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+		switch r {
+		case '\r', '\n':
+			fmt.Fprint(e.out, "\r\n")
+			return string(line), nil
+		case 3: // Ctrl-C
+			fmt.Fprint(e.out, "^C\r\n")
+			return "", errInterrupt
+		case 4: // Ctrl-D
+			if len(line) == 0 {
+				fmt.Fprint(e.out, "\r\n")
+				return "", io.EOF
+			}
+			if pos < len(line) {
+				line = append(line[:pos:pos], line[pos+1:]...)
+			}
+		case 1: // Ctrl-A
+			pos = 0
+		case 5: // Ctrl-E
+			pos = len(line)
+		case 2: // Ctrl-B
+			if pos > 0 {
+				pos--
+			}
+		case 6: // Ctrl-F
+			if pos < len(line) {
+				pos++
+			}
+		case 11: // Ctrl-K
+			line = line[:pos]
+		case 21: // Ctrl-U
+			line = append([]rune(nil), line[pos:]...)
+			pos = 0
+		case 8, 127: // Backspace
+			if pos > 0 {
+				line = append(line[:pos-1:pos-1], line[pos:]...)
+				pos--
+			}
+		case '\t':
+			line, pos = e.completeWord(prompt, line, pos)
+		case 27:
+			switch e.escape() {
+			case 'A':
+				if hist > 0 {
+					recall(hist - 1)
+				}
+			case 'B':
+				if hist < len(e.history) {
+					recall(hist + 1)
+				}
+			case 'C':
+				if pos < len(line) {
+					pos++
+				}
+			case 'D':
+				if pos > 0 {
+					pos--
+				}
+			case 'H':
+				pos = 0
+			case 'F':
+				pos = len(line)
+			case '~':
+				if pos < len(line) {
+					line = append(line[:pos:pos], line[pos+1:]...)
+				}
+			}
+		default:
+			if unicode.IsPrint(r) {
+				line = append(line[:pos:pos], append([]rune{r}, line[pos:]...)...)
+				pos++
+			}
+		}
+		e.refresh(prompt, line, pos)
+	}
+}
+
+// escape reads the rest of an escape sequence sent by a cursor key and
+// returns its final letter: A-D for arrows, H and F for Home and End and ~
+// for Delete. Other sequences return 0
+func (e *lineEditor) escape() rune {
+	r, _, err := e.in.ReadRune()
+	if err != nil || (r != '[' && r != 'O') {
+		return 0
+	}
+	var num []rune
+	for {
+		r, _, err = e.in.ReadRune()
+		if err != nil {
+			return 0
+		}
+		if r < '0' || r > '9' {
+			break
+		}
+		num = append(num, r)
+	}
+	if r != '~' {
+		return r
+	}
+	switch string(num) {
+	case "1", "7":
+		return 'H'
+	case "4", "8":
+		return 'F'
+	case "3":
+		return '~'
+	}
+	return 0
+}
+
+// completeWord completes the word before the cursor. A single match replaces
+// the word; several matches are extended to their common prefix, or listed
+// below the line when there is nothing to extend
+func (e *lineEditor) completeWord(prompt string, line []rune, pos int) ([]rune, int) {
+	if e.complete == nil {
+		return line, pos
+	}
+	start, cands := e.complete(string(line[:pos]))
+	if len(cands) == 0 {
+		fmt.Fprint(e.out, "\a")
+		return line, pos
+	}
+	prefix := []rune(cands[0])
+	for _, c := range cands[1:] {
+		cr := []rune(c)
+		n := 0
+		for n < len(prefix) && n < len(cr) && unicode.ToUpper(prefix[n]) == unicode.ToUpper(cr[n]) {
+			n++
+		}
+		prefix = prefix[:n]
+	}
+	if len(prefix) > pos-start || len(cands) == 1 {
+		rest := line[pos:]
+		line = append(append(append([]rune(nil), line[:start]...), prefix...), rest...)
+		return line, start + len(prefix)
+	}
+	fmt.Fprintf(e.out, "\r\n%s\r\n", strings.Join(cands, "  "))
+	return line, pos
+}
+
+// refresh redraws prompt and line and places the cursor at pos
+func (e *lineEditor) refresh(prompt string, line []rune, pos int) {
+	fmt.Fprintf(e.out, "\r%s%s\x1b[K", prompt, string(line))
+	if n := len(line) - pos; n > 0 {
+		fmt.Fprintf(e.out, "\x1b[%dD", n)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/praveentiru/efp"
+)
+
+func TestEval(t *testing.T) {
+	dir, err := ioutil.TempDir("", "efp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	vars := filepath.Join(dir, "vars.json")
+	if err := ioutil.WriteFile(vars, []byte(`{"qty": 4, "items": [1, 2, 3]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	wb := efp.NewWorkbook()
+	s := wb.AddSheet("Sheet1")
+	s.SetValue("A1", 10.0)
+	s.SetFormula("B4", "A1*3")
+	book := filepath.Join(dir, "book.xlsx")
+	if err := efp.SaveXLSX(book, wb); err != nil {
+		t.Fatal(err)
+	}
+
+	tt := []struct {
+		name string
+		args []string
+		code int
+		out  string
+	}{
+		{"Text output", []string{"eval", `=LEFT("abc",2)`}, exitOK, "ab\n"},
+		{"Variables after formula", []string{"eval", "x*y", "--var", "x=3", "--var", "y=4"}, exitOK, "12\n"},
+		{"JSON variables", []string{"eval", "--json", vars, "SUM(items)*qty"}, exitOK, "24\n"},
+		{"Flag overrides JSON", []string{"eval", "--json", vars, "--var", "qty=1", "qty"}, exitOK, "1\n"},
+		{"JSON output", []string{"eval", "-o", "json", "1=1"}, exitOK, "{\n  \"value\": true,\n  \"type\": \"logical\"\n}\n"},
+		{"Excel error", []string{"eval", "-o", "json", "1/x", "--var", "x=0"}, exitOK, "{\n  \"value\": \"#DIV/0!\",\n  \"type\": \"error\",\n  \"error\": \"#DIV/0!\"\n}\n"},
+		{"Workbook cell", []string{"eval", "--xlsx", book, "--cell", "Sheet1!B4"}, exitOK, "30\n"},
+		{"Formula on workbook", []string{"eval", "--xlsx", book, "A1+B4"}, exitOK, "40\n"},
+		{"German formula", []string{"eval", "--locale", "de", "SUMME(1,5;x)", "--var", "x=2"}, exitOK, "3,5\n"},
+		{"Unknown locale", []string{"eval", "--locale", "xx", "1"}, exitUsage, ""},
+		{"Parse error", []string{"eval", "LEFT("}, exitError, ""},
+		{"Missing formula", []string{"eval"}, exitUsage, ""},
+		{"Cell without workbook", []string{"eval", "--cell", "A1"}, exitUsage, ""},
+		{"Unknown command", []string{"calc"}, exitUsage, ""},
+	}
+	var errCnt int
+	for _, tu := range tt {
+		var stdout, stderr bytes.Buffer
+		code := run(tu.args, nil, &stdout, &stderr)
+		if code != tu.code || stdout.String() != tu.out {
+			t.Logf("Test: %v, Expected: %d %q, Got: %d %q %s", tu.name, tu.code, tu.out, code, stdout.String(), stderr.String())
+			errCnt++
+		}
+	}
+	if errCnt > 0 {
+		t.Errorf("Failed %v of %v test cases", errCnt, len(tt))
+	}
+}
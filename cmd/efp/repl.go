@@ -0,0 +1,299 @@
+// Copyright © 2019 Praveen Tirumandyam praveen.tirumandyam@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/praveentiru/efp"
+)
+
+const (
+	replPrompt  = "efp> "
+	historySize = 1000
+)
+
+const replHelp = `Enter a formula to evaluate it. The leading '=' is optional.
+
+	name := formula	evaluate formula and keep the value as variable name
+	A1 := formula	store formula in a cell of the scratch workbook
+	:vars		list variables
+	:help		show this help
+	:quit		leave the repl
+
+Tab completes function and variable names.
+`
+
+// repl keeps the variables and the scratch workbook of an interactive session
+type repl struct {
+	wb    *efp.Workbook
+	sheet string
+	vars  map[string]interface{}
+	out   io.Writer
+}
+
+func newREPL(out io.Writer) *repl {
+	wb := efp.NewWorkbook()
+	s := wb.AddSheet("Sheet1")
+	return &repl{wb: wb, sheet: s.Name, vars: make(map[string]interface{}), out: out}
+}
+
+func runREPL(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("repl", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: efp repl [flags]")
+		fs.PrintDefaults()
+	}
+	history := fs.String("history", defaultHistory(), "keep history of entered lines in `file`, empty to disable")
+	book := fs.String("xlsx", "", "use workbook in .xlsx `file` as the scratch workbook")
+	if pos, err := parseArgs(fs, args); err != nil || len(pos) > 0 {
+		if err == nil {
+			fs.Usage()
+		}
+		return exitUsage
+	}
+	r := newREPL(stdout)
+	if *book != "" {
+		wb, err := efp.OpenXLSX(*book)
+		if err != nil {
+			fmt.Fprintf(stderr, "efp repl: %v\n", err)
+			return exitError
+		}
+		if len(wb.Sheets) == 0 {
+			wb.AddSheet("Sheet1")
+		}
+		r.wb, r.sheet = wb, wb.Sheets[0].Name
+	}
+	c := context.Background()
+
+	if f, ok := stdin.(*os.File); ok && isTerminal(f.Fd()) {
+		if st, err := makeRaw(f.Fd()); err == nil {
+			defer restoreTerminal(f.Fd(), st)
+			r.interactive(c, f, *history)
+			return exitOK
+		}
+	}
+	sc := bufio.NewScanner(stdin)
+	for sc.Scan() {
+		if !r.exec(c, sc.Text()) {
+			break
+		}
+	}
+	if err := sc.Err(); err != nil {
+		fmt.Fprintf(stderr, "efp repl: %v\n", err)
+		return exitError
+	}
+	return exitOK
+}
+
+// interactive reads lines from terminal with line editing until the user
+// quits. Lines are appended to history file as they are entered
+func (r *repl) interactive(c context.Context, term io.Reader, history string) {
+	ed := &lineEditor{in: bufio.NewReader(term), out: r.out, complete: r.complete}
+	ed.history = loadHistory(history)
+	fmt.Fprint(r.out, "efp repl, type :help for help\r\n")
+	for {
+		line, err := ed.readLine(replPrompt)
+		if err == errInterrupt {
+			continue
+		}
+		if err != nil {
+			return
+		}
+		if ed.addHistory(line) {
+			appendHistory(history, line)
+		}
+		if !r.exec(c, line) {
+			return
+		}
+	}
+}
+
+// exec runs one line of input and prints its result. Returns false when the
+// session should end
+func (r *repl) exec(c context.Context, line string) bool {
+	line = strings.TrimSpace(line)
+	switch line {
+	case "":
+		return true
+	case ":q", ":quit", ":exit":
+		return false
+	case ":help":
+		fmt.Fprint(r.out, replHelp)
+		return true
+	case ":vars":
+		names := make([]string, 0, len(r.vars))
+		for k := range r.vars {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		for _, k := range names {
+			fmt.Fprintf(r.out, "%s = %s\n", k, efp.FormatValue(r.vars[k]))
+		}
+		return true
+	}
+	if i := strings.Index(line, ":="); i > 0 {
+		name, formula := strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+2:])
+		if ref, err := efp.ParseRef(name); err == nil && !ref.IsRange() {
+			r.setCell(c, ref, formula)
+			return true
+		}
+		if isName(name) {
+			if v, ok := r.eval(c, formula); ok {
+				r.vars[name] = v
+				r.print(v)
+			}
+			return true
+		}
+	}
+	if v, ok := r.eval(c, line); ok {
+		r.print(v)
+	}
+	return true
+}
+
+// eval evaluates formula on the scratch workbook. Excel errors are returned
+// as values; other errors are printed and false is returned
+func (r *repl) eval(c context.Context, formula string) (interface{}, bool) {
+	v, err := r.wb.EvaluateFormula(c, r.sheet, formula, r.vars)
+	if e, ok := err.(efp.ErrorValue); ok {
+		v, err = e, nil
+	}
+	if err != nil {
+		fmt.Fprintf(r.out, "error: %v\n", err)
+		return nil, false
+	}
+	return v, true
+}
+
+// setCell stores formula in the cell at ref and prints the cell's value
+func (r *repl) setCell(c context.Context, ref efp.Ref, formula string) {
+	if _, err := efp.Parse(strings.NewReader(formula)); err != nil {
+		fmt.Fprintf(r.out, "error: %v\n", err)
+		return
+	}
+	sheet := r.sheet
+	if ref.Sheet != "" {
+		sheet = ref.Sheet
+	}
+	s := r.wb.AddSheet(sheet)
+	if err := s.SetFormula(ref.From.String(), formula); err != nil {
+		fmt.Fprintf(r.out, "error: %v\n", err)
+		return
+	}
+	if v, ok := r.eval(c, ref.String()); ok {
+		r.print(v)
+	}
+}
+
+func (r *repl) print(v interface{}) {
+	fmt.Fprintln(r.out, efp.FormatValue(v))
+}
+
+// complete returns the function and variable names starting with the word
+// that ends line. Function names are completed with the opening parenthesis
+func (r *repl) complete(line string) (int, []string) {
+	rs := []rune(line)
+	start := len(rs)
+	for start > 0 && isNameRune(rs[start-1]) {
+		start--
+	}
+	word := string(rs[start:])
+	if word == "" {
+		return start, nil
+	}
+	var cands []string
+	for _, fn := range efp.Functions() {
+		if hasPrefixFold(fn, word) {
+			cands = append(cands, fn+"(")
+		}
+	}
+	for k := range r.vars {
+		if hasPrefixFold(k, word) {
+			cands = append(cands, k)
+		}
+	}
+	sort.Strings(cands)
+	return start, cands
+}
+
+func hasPrefixFold(s, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
+
+// isName returns true if s can be used as a variable name
+func isName(s string) bool {
+	for i, r := range s {
+		if !isNameRune(r) || (i == 0 && unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+func isNameRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func defaultHistory() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".efp_history")
+}
+
+// loadHistory returns the last lines of history file
+func loadHistory(file string) []string {
+	if file == "" {
+		return nil
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	var lines []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		lines = append(lines, sc.Text())
+	}
+	if len(lines) > historySize {
+		lines = lines[len(lines)-historySize:]
+	}
+	return lines
+}
+
+func appendHistory(file, line string) {
+	if file == "" {
+		return
+	}
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	fmt.Fprintln(f, line)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestREPL(t *testing.T) {
+	tt := []struct {
+		name string
+		in   string
+		out  string
+	}{
+		{"Formula", `=LEFT("abc",2)`, "ab\n"},
+		{"Variable", "x := 3", "3\n"},
+		{"Use variable", "x*2", "6\n"},
+		{"Cell", "A1 := x+1", "4\n"},
+		{"Cell depending on cell", "B1 := A1*10", "40\n"},
+		{"Reassign variable", "x := 5", "5\n"},
+		{"Cell follows variable", "B1", "60\n"},
+		{"Excel error", "1/0", "#DIV/0!\n"},
+		{"Error in variable", "e := A1/0", "#DIV/0!\n"},
+		{"Error propagates", "e+1", "#DIV/0!\n"},
+		{"Array", "A1:B1", "6\t60\n"},
+		{"Parse error", "LEFT(", "error: "},
+		{"Variables", ":vars", "e = #DIV/0!\nx = 5\n"},
+	}
+	r := newREPL(nil)
+	var errCnt int
+	for _, tu := range tt {
+		var out bytes.Buffer
+		r.out = &out
+		r.exec(context.Background(), tu.in)
+		if !strings.HasPrefix(out.String(), tu.out) {
+			t.Logf("Test: %v, Expected: %q, Got: %q", tu.name, tu.out, out.String())
+			errCnt++
+		}
+	}
+	if errCnt > 0 {
+		t.Errorf("Failed %v of %v test cases", errCnt, len(tt))
+	}
+}
+
+func TestComplete(t *testing.T) {
+	r := newREPL(nil)
+	r.vars["subtotal"] = 1.0
+	tt := []struct {
+		line  string
+		start int
+		cands []string
+	}{
+		{"le", 0, []string{"LEFT(", "LEN("}},
+		{"=1+su", 3, []string{"SUBSTITUTE(", "SUM(", "SUMIF(", "SUMPRODUCT(", "SUMX2MY2(", "SUMX2PY2(", "SUMXMY2(", "subtotal"}},
+		{"CONCAT(A1, lo", 11, []string{"LOWER("}},
+		{"1+", 2, nil},
+		{"xyz", 0, nil},
+	}
+	var errCnt int
+	for _, tu := range tt {
+		start, cands := r.complete(tu.line)
+		if start != tu.start || !reflect.DeepEqual(cands, tu.cands) {
+			t.Logf("Test: %v, Expected: %v %v, Got: %v %v", tu.line, tu.start, tu.cands, start, cands)
+			errCnt++
+		}
+	}
+	if errCnt > 0 {
+		t.Errorf("Failed %v of %v test cases", errCnt, len(tt))
+	}
+}
+
+func TestLineEditor(t *testing.T) {
+	r := newREPL(nil)
+	tt := []struct {
+		name string
+		keys string
+		out  string
+	}{
+		{"Typed line", "1+1\r", "1+1"},
+		{"Backspace", "12\x7f3\r", "13"},
+		{"Cursor keys", "23\x1b[D\x1b[D1\x1b[C\x1b[C4\r", "1234"},
+		{"Home and end", "bc\x01a\x05d\r", "abcd"},
+		{"Complete function", "lo\t\"A\")\r", `LOWER("A")`},
+		{"Extend common prefix", "sub\t\r", "SUBSTITUTE("},
+		{"Previous line", "\x1b[A\x1b[A\r", `LOWER("A")`},
+		{"Back to edited line", "9\x1b[A\x1b[B\r", "9"},
+	}
+	ed := &lineEditor{out: ioutil.Discard, complete: r.complete}
+	var errCnt int
+	for _, tu := range tt {
+		ed.in = bufio.NewReader(strings.NewReader(tu.keys))
+		line, err := ed.readLine(replPrompt)
+		if err != nil || line != tu.out {
+			t.Logf("Test: %v, Expected: %q, Got: %q %v", tu.name, tu.out, line, err)
+			errCnt++
+		}
+		ed.addHistory(line)
+	}
+	if errCnt > 0 {
+		t.Errorf("Failed %v of %v test cases", errCnt, len(tt))
+	}
+}
@@ -0,0 +1,282 @@
+// Copyright © 2019 Praveen Tirumandyam praveen.tirumandyam@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/praveentiru/efp"
+)
+
+// maxRequestBody limits the size of request bodies accepted by the server
+const maxRequestBody = 1 << 20
+
+var errTimeout = errors.New("evaluation timed out")
+
+// workbookFlags collects repeated -workbook id=file.xlsx flags
+type workbookFlags map[string]*efp.Workbook
+
+func (w workbookFlags) String() string {
+	return ""
+}
+
+func (w workbookFlags) Set(s string) error {
+	i := strings.IndexByte(s, '=')
+	if i <= 0 {
+		return fmt.Errorf("workbook %q is not of the form id=file", s)
+	}
+	wb, err := efp.OpenXLSX(s[i+1:])
+	if err != nil {
+		return err
+	}
+	w[s[:i]] = wb
+	return nil
+}
+
+// evalRequest is the body of /evaluate and an item of /batch. Formulas are
+// evaluated on the first sheet of the workbook unless Sheet is given
+type evalRequest struct {
+	Formula   string                 `json:"formula"`
+	Vars      map[string]interface{} `json:"vars,omitempty"`
+	Workbook  string                 `json:"workbook,omitempty"`
+	Sheet     string                 `json:"sheet,omitempty"`
+	TimeoutMS int                    `json:"timeout_ms,omitempty"`
+}
+
+type batchRequest struct {
+	Requests  []evalRequest `json:"requests"`
+	TimeoutMS int           `json:"timeout_ms,omitempty"`
+}
+
+type batchResponse struct {
+	Results []result `json:"results"`
+}
+
+type validateRequest struct {
+	Formula string `json:"formula"`
+}
+
+type validateResponse struct {
+	Valid bool     `json:"valid"`
+	Refs  []string `json:"refs,omitempty"`
+	Error string   `json:"error,omitempty"`
+}
+
+// server evaluates formulas sent as JSON within limits. Workbooks are loaded
+// when the server starts and are only read while serving
+type server struct {
+	workbooks map[string]*efp.Workbook
+	timeout   time.Duration
+	limits    efp.Limits
+}
+
+func runServe(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: efp serve [flags]")
+		fs.PrintDefaults()
+	}
+	books := make(workbookFlags)
+	addr := fs.String("addr", "localhost:8080", "listen on `address`")
+	timeout := fs.Duration("timeout", 5*time.Second, "longest time a request may evaluate; requests may ask for less")
+	fs.Var(books, "workbook", "serve .xlsx workbook as `id=file`, may be repeated")
+	if pos, err := parseArgs(fs, args); err != nil || len(pos) > 0 {
+		if err == nil {
+			fs.Usage()
+		}
+		return exitUsage
+	}
+
+	srv := &http.Server{Addr: *addr, Handler: newServer(books, *timeout)}
+	done := make(chan struct{})
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt)
+		<-sig
+		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+		defer cancel()
+		srv.Shutdown(ctx)
+		close(done)
+	}()
+	fmt.Fprintf(stdout, "efp serving on %s\n", *addr)
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		fmt.Fprintf(stderr, "efp serve: %v\n", err)
+		return exitError
+	}
+	<-done
+	return exitOK
+}
+
+// newServer returns the handler of the JSON API. Formulas are evaluated
+// within efp.DefaultLimits:
+//
+//	POST /evaluate	evaluate one formula
+//	POST /batch	evaluate several formulas
+//	POST /validate	parse a formula without evaluating it
+func newServer(workbooks map[string]*efp.Workbook, timeout time.Duration) http.Handler {
+	s := &server{workbooks: workbooks, timeout: timeout, limits: efp.DefaultLimits}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/evaluate", s.handleEvaluate)
+	mux.HandleFunc("/batch", s.handleBatch)
+	mux.HandleFunc("/validate", s.handleValidate)
+	return mux
+}
+
+func (s *server) handleEvaluate(w http.ResponseWriter, r *http.Request) {
+	var req evalRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+	c, cancel := s.context(r.Context(), req.TimeoutMS)
+	defer cancel()
+	res, status := s.evaluate(c, req)
+	writeJSON(w, status, res)
+}
+
+func (s *server) handleBatch(w http.ResponseWriter, r *http.Request) {
+	var req batchRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+	c, cancel := s.context(r.Context(), req.TimeoutMS)
+	defer cancel()
+	resp := batchResponse{Results: make([]result, len(req.Requests))}
+	for i, er := range req.Requests {
+		resp.Results[i], _ = s.evaluate(c, er)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *server) handleValidate(w http.ResponseWriter, r *http.Request) {
+	var req validateRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+	resp := validateResponse{Valid: true}
+	if _, err := s.limits.Parse(strings.NewReader(req.Formula)); err != nil {
+		resp = validateResponse{Error: err.Error()}
+	} else if f, err := efp.ParseFormula(req.Formula); err == nil {
+		for _, ref := range f.Refs() {
+			resp.Refs = append(resp.Refs, ref.String())
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// context limits c to the server timeout, or to ms milliseconds when the
+// request asks for less
+func (s *server) context(c context.Context, ms int) (context.Context, context.CancelFunc) {
+	d := s.timeout
+	if t := time.Duration(ms) * time.Millisecond; t > 0 && (d <= 0 || t < d) {
+		d = t
+	}
+	if d <= 0 {
+		return context.WithCancel(c)
+	}
+	return context.WithTimeout(c, d)
+}
+
+// evaluate computes the formula of req and returns the result with the HTTP
+// status it should be sent with. Excel errors are results, not failures
+func (s *server) evaluate(c context.Context, req evalRequest) (result, int) {
+	if err := c.Err(); err != nil {
+		return result{Error: errTimeout.Error()}, http.StatusServiceUnavailable
+	}
+	var wb *efp.Workbook
+	if req.Workbook != "" {
+		if wb = s.workbooks[req.Workbook]; wb == nil {
+			return result{Error: fmt.Sprintf("unknown workbook %s", req.Workbook)}, http.StatusNotFound
+		}
+	}
+	eval, err := s.limits.Parse(strings.NewReader(req.Formula))
+	if err != nil {
+		return result{Error: err.Error()}, http.StatusBadRequest
+	}
+	c = efp.WithLimits(c, s.limits)
+
+	type outcome struct {
+		v   interface{}
+		err error
+	}
+	// Evaluation runs apart from the request so the response is sent when the
+	// deadline passes even if a function does not stop on cancellation
+	ch := make(chan outcome, 1)
+	go func() {
+		var o outcome
+		if wb == nil {
+			o.v, o.err = eval(c, req.Vars)
+		} else {
+			sheet := req.Sheet
+			if sheet == "" && len(wb.Sheets) > 0 {
+				sheet = wb.Sheets[0].Name
+			}
+			o.v, o.err = wb.EvaluateFormula(c, sheet, req.Formula, req.Vars)
+		}
+		ch <- o
+	}()
+	select {
+	case o := <-ch:
+		res := newResult(o.v, o.err)
+		if res.Type == "" {
+			return res, http.StatusUnprocessableEntity
+		}
+		return res, http.StatusOK
+	case <-c.Done():
+		return result{Error: errTimeout.Error()}, http.StatusServiceUnavailable
+	}
+}
+
+// decodeRequest reads the JSON body of a POST request into v. Writes the
+// error response and returns false if the request is not valid
+func decodeRequest(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSON(w, http.StatusMethodNotAllowed, result{Error: "method not allowed"})
+		return false
+	}
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBody))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		writeJSON(w, http.StatusBadRequest, result{Error: fmt.Sprintf("invalid request: %v", err)})
+		return false
+	}
+	return true
+}
+
+// writeJSON writes v as the response. Values JSON cannot represent, like an
+// infinite number, give an internal server error
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(v); err != nil {
+		buf.Reset()
+		json.NewEncoder(&buf).Encode(result{Error: fmt.Sprintf("encoding response: %v", err)})
+		status = http.StatusInternalServerError
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+}
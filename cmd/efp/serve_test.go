@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/praveentiru/efp"
+)
+
+func TestServe(t *testing.T) {
+	wb := efp.NewWorkbook()
+	s := wb.AddSheet("Sheet1")
+	s.SetValue("A1", 10.0)
+	s.SetFormula("B1", "A1*rate")
+	ts := httptest.NewServer(newServer(map[string]*efp.Workbook{"book": wb}, time.Second))
+	defer ts.Close()
+
+	tt := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+		out    string
+	}{
+		{"Evaluate", "POST", "/evaluate", `{"formula": "=LEFT(\"abc\",2)"}`, http.StatusOK, `{"value":"ab","type":"text"}`},
+		{"Evaluate with variables", "POST", "/evaluate", `{"formula": "SUM(items)*qty", "vars": {"items": [1, 2], "qty": 2}}`, http.StatusOK, `{"value":6,"type":"number"}`},
+		{"Excel error", "POST", "/evaluate", `{"formula": "1/x", "vars": {"x": 0}}`, http.StatusOK, `{"value":"#DIV/0!","type":"error","error":"#DIV/0!"}`},
+		{"Workbook", "POST", "/evaluate", `{"formula": "B1+1", "workbook": "book", "vars": {"rate": 2}}`, http.StatusOK, `{"value":21,"type":"number"}`},
+		{"Unknown workbook", "POST", "/evaluate", `{"formula": "1", "workbook": "other"}`, http.StatusNotFound, `{"value":null,"error":"unknown workbook other"}`},
+		{"Parse error", "POST", "/evaluate", `{"formula": "LEFT("}`, http.StatusBadRequest, ""},
+		{"Invalid JSON", "POST", "/evaluate", `{"formula": 1}`, http.StatusBadRequest, ""},
+		{"Unknown field", "POST", "/evaluate", `{"expr": "1"}`, http.StatusBadRequest, ""},
+		{"Wrong method", "GET", "/evaluate", "", http.StatusMethodNotAllowed, ""},
+		{"Limit exceeded", "POST", "/evaluate", `{"formula": "REPT(\"x\", 1e9)"}`, http.StatusUnprocessableEntity, `{"value":null,"error":"formula exceeds MaxStringLength of 32767"}`},
+		{"Batch", "POST", "/batch", `{"requests": [{"formula": "1+1"}, {"formula": "LEFT("}, {"formula": "NA", "vars": {"NA": "x"}}]}`, http.StatusOK, `{"results":[{"value":2,"type":"number"},{"value":null,"error":"parsing error: LEFT(\t:1:6 - 1:6 unexpected EOF while scanning extensions"},{"value":"x","type":"text"}]}`},
+		{"Validate", "POST", "/validate", `{"formula": "=SUM(A1:B2)+Sheet2!C3"}`, http.StatusOK, `{"valid":true,"refs":["A1:B2","Sheet2!C3"]}`},
+		{"Validate error", "POST", "/validate", `{"formula": "SUM(("}`, http.StatusOK, ""},
+	}
+	var errCnt int
+	for _, tu := range tt {
+		req, err := http.NewRequest(tu.method, ts.URL+tu.path, strings.NewReader(tu.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var body strings.Builder
+		_, err = io.Copy(&body, resp.Body)
+		resp.Body.Close()
+		got := strings.TrimSpace(body.String())
+		if err != nil || resp.StatusCode != tu.status || (tu.out != "" && got != tu.out) {
+			t.Logf("Test: %v, Expected: %d %s, Got: %d %s", tu.name, tu.status, tu.out, resp.StatusCode, got)
+			errCnt++
+		}
+	}
+	if errCnt > 0 {
+		t.Errorf("Failed %v of %v test cases", errCnt, len(tt))
+	}
+}
+
+func TestServeTimeout(t *testing.T) {
+	s := &server{timeout: time.Second}
+	c, cancel := s.context(context.Background(), 1)
+	defer cancel()
+	if d, ok := c.Deadline(); !ok || time.Until(d) > time.Millisecond {
+		t.Errorf("Request timeout not applied, Deadline: %v", d)
+	}
+	<-c.Done()
+	res, status := s.evaluate(c, evalRequest{Formula: "1+1"})
+	if status != http.StatusServiceUnavailable || res.Error != errTimeout.Error() {
+		t.Errorf("Expected: %d %v, Got: %d %v", http.StatusServiceUnavailable, errTimeout, status, res.Error)
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	w := httptest.NewRecorder()
+	writeJSON(w, http.StatusOK, result{Value: math.Inf(1), Type: "number"})
+	got := strings.TrimSpace(w.Body.String())
+	if w.Code != http.StatusInternalServerError || !strings.HasPrefix(got, `{"value":null,"error":"encoding response:`) {
+		t.Errorf("Expected: %d encoding error, Got: %d %s", http.StatusInternalServerError, w.Code, got)
+	}
+}
@@ -0,0 +1,266 @@
+// Copyright © 2019 Praveen Tirumandyam praveen.tirumandyam@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package efp
+
+import (
+	"math"
+	"strings"
+)
+
+// records returns the values of field in the records of database matching
+// criteria, the way Excel's database functions like DSUM select them. The
+// first row of database and criteria holds the column labels. Field is a
+// label or 1 based column number; nil selects whole records so only their
+// count is of use. Each row of criteria below the labels is a set of
+// conditions which must all hold, and a record matches if any row holds.
+// Blank conditions always hold. Text without an operator matches text
+// starting with it
+func records(database Array, field interface{}, crit Array) ([]interface{}, error) {
+	if len(database) == 0 || len(crit) == 0 {
+		return nil, ErrValue
+	}
+	col := -1
+	if field != nil {
+		var ok bool
+		if col, ok = databaseColumn(database[0], field); !ok {
+			return nil, ErrValue
+		}
+	}
+	type condition struct {
+		col   int
+		match func(v interface{}) bool
+	}
+	var rows [][]condition
+	for _, row := range crit[1:] {
+		var conds []condition
+		for j, v := range row {
+			if v == nil || v == "" {
+				continue
+			}
+			if j >= len(crit[0]) {
+				return nil, ErrValue
+			}
+			c, ok := databaseColumn(database[0], crit[0][j])
+			if !ok {
+				return nil, ErrValue
+			}
+			conds = append(conds, condition{c, databaseCriteria(v)})
+		}
+		rows = append(rows, conds)
+	}
+	var out []interface{}
+	for _, rec := range database[1:] {
+		matched := false
+		for _, conds := range rows {
+			all := true
+			for _, cond := range conds {
+				if cond.col >= len(rec) || !cond.match(rec[cond.col]) {
+					all = false
+					break
+				}
+			}
+			if all {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+		switch {
+		case col < 0:
+			out = append(out, rec)
+		case col < len(rec):
+			out = append(out, rec[col])
+		default:
+			out = append(out, nil)
+		}
+	}
+	return out, nil
+}
+
+// databaseColumn returns the index of the column of database labelled by
+// field or numbered by it
+func databaseColumn(labels []interface{}, field interface{}) (int, bool) {
+	if n, ok := asNumber(field); ok {
+		if n < 1 || int(n) > len(labels) {
+			return 0, false
+		}
+		return int(n) - 1, true
+	}
+	name, ok := field.(string)
+	if !ok {
+		return 0, false
+	}
+	for i, l := range labels {
+		if strings.EqualFold(strings.TrimSpace(toString(l)), strings.TrimSpace(name)) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// databaseCriteria is criteria except that text without an operator matches
+// text starting with it
+func databaseCriteria(crit interface{}) func(v interface{}) bool {
+	if s, ok := crit.(string); ok && s != "" && !strings.ContainsAny(s[:1], "<>=") {
+		if _, isText := criteriaOperand(s).(string); isText {
+			return criteria(s + "*")
+		}
+	}
+	return criteria(crit)
+}
+
+// numbers returns the numbers among values
+func numbers(values []interface{}) []float64 {
+	var out []float64
+	for _, v := range values {
+		if n, ok := asNumber(v); ok {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+// DSum implements Excel's DSUM function
+func DSum(database Array, field interface{}, crit Array) (float64, error) {
+	vals, err := records(database, field, crit)
+	if err != nil {
+		return 0, err
+	}
+	var total float64
+	for _, n := range numbers(vals) {
+		total += n
+	}
+	return total, nil
+}
+
+// DCount implements Excel's DCOUNT function. Without field the matching
+// records are counted
+func DCount(database Array, field interface{}, crit Array) (int, error) {
+	vals, err := records(database, field, crit)
+	if err != nil {
+		return 0, err
+	}
+	if field == nil {
+		return len(vals), nil
+	}
+	return len(numbers(vals)), nil
+}
+
+// DAverage implements Excel's DAVERAGE function
+func DAverage(database Array, field interface{}, crit Array) (float64, error) {
+	vals, err := records(database, field, crit)
+	if err != nil {
+		return 0, err
+	}
+	nums := numbers(vals)
+	if len(nums) == 0 {
+		return 0, ErrDiv0
+	}
+	var total float64
+	for _, n := range nums {
+		total += n
+	}
+	return total / float64(len(nums)), nil
+}
+
+// DGet implements Excel's DGET function. Returns ErrValue if no record matches
+// and ErrNum if several do
+func DGet(database Array, field interface{}, crit Array) (interface{}, error) {
+	if field == nil {
+		return nil, ErrValue
+	}
+	vals, err := records(database, field, crit)
+	if err != nil {
+		return nil, err
+	}
+	switch len(vals) {
+	case 0:
+		return nil, ErrValue
+	case 1:
+		return vals[0], nil
+	}
+	return nil, ErrNum
+}
+
+// DMax implements Excel's DMAX function. Returns 0 if no number matches
+func DMax(database Array, field interface{}, crit Array) (float64, error) {
+	return databaseExtreme(database, field, crit, func(a, b float64) bool { return a > b })
+}
+
+// DMin implements Excel's DMIN function. Returns 0 if no number matches
+func DMin(database Array, field interface{}, crit Array) (float64, error) {
+	return databaseExtreme(database, field, crit, func(a, b float64) bool { return a < b })
+}
+
+func databaseExtreme(database Array, field interface{}, crit Array, better func(a, b float64) bool) (float64, error) {
+	vals, err := records(database, field, crit)
+	if err != nil {
+		return 0, err
+	}
+	nums := numbers(vals)
+	if len(nums) == 0 {
+		return 0, nil
+	}
+	best := nums[0]
+	for _, n := range nums[1:] {
+		if better(n, best) {
+			best = n
+		}
+	}
+	return best, nil
+}
+
+// DProduct implements Excel's DPRODUCT function. Returns 0 if no number
+// matches
+func DProduct(database Array, field interface{}, crit Array) (float64, error) {
+	vals, err := records(database, field, crit)
+	if err != nil {
+		return 0, err
+	}
+	nums := numbers(vals)
+	if len(nums) == 0 {
+		return 0, nil
+	}
+	product := 1.0
+	for _, n := range nums {
+		product *= n
+	}
+	return product, nil
+}
+
+// DStdev implements Excel's DSTDEV function, the standard deviation of the
+// matching numbers taken as a sample
+func DStdev(database Array, field interface{}, crit Array) (float64, error) {
+	vals, err := records(database, field, crit)
+	if err != nil {
+		return 0, err
+	}
+	nums := numbers(vals)
+	if len(nums) < 2 {
+		return 0, ErrDiv0
+	}
+	var mean float64
+	for _, n := range nums {
+		mean += n
+	}
+	mean /= float64(len(nums))
+	var sq float64
+	for _, n := range nums {
+		sq += (n - mean) * (n - mean)
+	}
+	return math.Sqrt(sq / float64(len(nums)-1)), nil
+}
@@ -0,0 +1,116 @@
+package efp
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+// orchard is the sample database of the Excel documentation
+var orchard = Array{
+	{"Tree", "Height", "Age", "Yield", "Profit"},
+	{"Apple", 18.0, 20.0, 14.0, 105.0},
+	{"Pear", 12.0, 12.0, 10.0, 96.0},
+	{"Cherry", 13.0, 14.0, 9.0, 105.0},
+	{"Apple", 14.0, 15.0, 10.0, 75.0},
+	{"Pear", 9.0, 8.0, 8.0, 76.8},
+	{"Apple", 8.0, 9.0, 6.0, 45.0},
+}
+
+func TestDatabaseFunctions(t *testing.T) {
+	apples := Array{{"Tree", "Height", "Height"}, {"=Apple", ">10", "<16"}}
+	applesOrPears := Array{{"Tree"}, {"=Apple"}, {"=Pear"}}
+	all := Array{{"Tree"}, {nil}}
+	prefix := Array{{"tree"}, {"Ch"}}
+	tt := []struct {
+		testName string
+		fn       func(Array, interface{}, Array) (interface{}, error)
+		field    interface{}
+		crit     Array
+		out      interface{}
+		err      error
+	}{
+		{"DCOUNT with two conditions on a column", wrapInt(DCount), "Age", apples, 1, nil},
+		{"DCOUNT without field", wrapInt(DCount), nil, applesOrPears, 5, nil},
+		{"DGET of several records", DGet, "Yield", applesOrPears, nil, ErrNum},
+		{"DGET of one record", DGet, "Profit", apples, 75.0, nil},
+		{"DGET of no record", DGet, "Profit", Array{{"Tree"}, {"=Plum"}}, nil, ErrValue},
+		{"DMAX over OR rows", wrapFloat(DMax), "Profit", applesOrPears, 105.0, nil},
+		{"DMIN", wrapFloat(DMin), "Profit", Array{{"Tree", "Height"}, {"=Apple", ">10"}}, 75.0, nil},
+		{"DSUM", wrapFloat(DSum), "Profit", Array{{"Tree"}, {"=Apple"}}, 225.0, nil},
+		{"DSUM with AND", wrapFloat(DSum), "Profit", apples, 75.0, nil},
+		{"DPRODUCT", wrapFloat(DProduct), "Yield", apples, 10.0, nil},
+		{"DAVERAGE", wrapFloat(DAverage), "Yield", Array{{"Tree", "Height"}, {"=Apple", ">10"}}, 12.0, nil},
+		{"DAVERAGE by column number", wrapFloat(DAverage), 3.0, all, 13.0, nil},
+		{"DAVERAGE of nothing", wrapFloat(DAverage), "Yield", Array{{"Age"}, {">100"}}, 0.0, ErrDiv0},
+		{"Text matches the start", wrapFloat(DSum), "Yield", prefix, 9.0, nil},
+		{"Unknown field", wrapFloat(DSum), "Weight", all, 0.0, ErrValue},
+		{"Unknown criteria label", wrapFloat(DSum), "Yield", Array{{"Weight"}, {1.0}}, 0.0, ErrValue},
+	}
+	var errCnt int
+	for _, tu := range tt {
+		out, err := tu.fn(orchard, tu.field, tu.crit)
+		if out != tu.out || err != tu.err {
+			t.Logf("Test: %v, Expected: %v %v, Got: %v %v", tu.testName, tu.out, tu.err, out, err)
+			errCnt++
+		}
+	}
+	if n, err := DStdev(orchard, "Yield", applesOrPears); math.Abs(n-2.96648) > 1e-5 || err != nil {
+		t.Logf("Test: DSTDEV, Expected: %v, Got: %v %v", 2.96648, n, err)
+		errCnt++
+	}
+	if errCnt > 0 {
+		t.Errorf("Failed %v of %v test cases", errCnt, len(tt)+1)
+	}
+}
+
+func TestDatabaseFormulas(t *testing.T) {
+	wb := NewWorkbook()
+	s := wb.AddSheet("Sheet1")
+	for i, row := range orchard {
+		for j, v := range row {
+			s.SetValue(ColumnName(j+1)+string(rune('1'+i)), v)
+		}
+	}
+	s.SetValue("G1", "Tree")
+	s.SetValue("H1", "Height")
+	s.SetValue("G2", "=Apple")
+	s.SetValue("H2", ">10")
+	s.SetValue("G3", "=Pear")
+	s.SetFormula("J1", "DSUM(A1:E7,\"Profit\",G1:H3)")
+	s.SetFormula("J2", "DCOUNT(A1:E7,\"Age\",G1:H2)")
+	s.SetFormula("J3", "DCOUNT(A1:E7,,G1:H3)")
+	if err := wb.Recalculate(context.Background()); err != nil {
+		t.Fatalf("Recalculate failed, Error: %v", err)
+	}
+	tt := []struct {
+		cell string
+		out  interface{}
+	}{
+		{"J1", 105.0 + 75.0 + 96.0 + 76.8},
+		{"J2", 2.0},
+		{"J3", 4.0},
+	}
+	var errCnt int
+	for _, tu := range tt {
+		if v := s.Cell(tu.cell).Value; v != tu.out {
+			t.Logf("Test: %v, Expected: %v, Got: %v", tu.cell, tu.out, v)
+			errCnt++
+		}
+	}
+	if errCnt > 0 {
+		t.Errorf("Failed %v of %v test cases", errCnt, len(tt))
+	}
+}
+
+func wrapInt(fn func(Array, interface{}, Array) (int, error)) func(Array, interface{}, Array) (interface{}, error) {
+	return func(db Array, field interface{}, crit Array) (interface{}, error) {
+		return fn(db, field, crit)
+	}
+}
+
+func wrapFloat(fn func(Array, interface{}, Array) (float64, error)) func(Array, interface{}, Array) (interface{}, error) {
+	return func(db Array, field interface{}, crit Array) (interface{}, error) {
+		return fn(db, field, crit)
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright © 2019 Praveen Tirumandyam praveen.tirumandyam@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package efp
+
+import (
+	"encoding/csv"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dateLayouts are the date formats recognised when inferring types of text
+var dateLayouts = []string{
+	"2006-01-02",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	time.RFC3339,
+	"2006/01/02",
+	"1/2/2006",
+	"01/02/2006",
+}
+
+// numberPattern matches numbers typed in a cell. Commas may only group the
+// digits before the decimal point in thousands
+var numberPattern = regexp.MustCompile(`^[+-]?(\d{1,3}(,\d{3})+(\.\d*)?|\d+(\.\d*)?|\.\d+)([eE][+-]?\d+)?$`)
+
+// parseNumber converts text matching numberPattern to a number
+func parseNumber(t string) (float64, bool) {
+	if !numberPattern.MatchString(t) {
+		return 0, false
+	}
+	n, err := strconv.ParseFloat(strings.ReplaceAll(t, ",", ""), 64)
+	if err != nil || math.IsInf(n, 0) {
+		return 0, false
+	}
+	return n, true
+}
+
+// AddCSV reads CSV data from r into sheet called name. The first record lands
+// in row 1 so a header row is addressed as row 1 like in Excel. Field types
+// are inferred with InferValue
+func (wb *Workbook) AddCSV(name string, r io.Reader) (*Sheet, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	return wb.AddRecords(name, records), nil
+}
+
+// AddRecords stores text records as sheet called name, inferring the type of
+// each field. Existing cells of the sheet are replaced
+func (wb *Workbook) AddRecords(name string, records [][]string) *Sheet {
+	s := wb.AddSheet(name)
+	s.Cells = make(map[CellRef]*Cell)
+	for i, rec := range records {
+		for j, field := range rec {
+			v, numFmt := InferValue(field)
+			if v == nil {
+				continue
+			}
+			s.Cells[CellRef{Row: i + 1, Col: j + 1}] = &Cell{Value: v, NumFmt: numFmt}
+		}
+	}
+	return s
+}
+
+// AddRows stores rows of Go values as sheet called name. Integers are stored
+// as numbers and time.Time as dates. Existing cells of the sheet are replaced
+func (wb *Workbook) AddRows(name string, rows [][]interface{}) *Sheet {
+	s := wb.AddSheet(name)
+	s.Cells = make(map[CellRef]*Cell)
+	for i, row := range rows {
+		for j, v := range row {
+			c := &Cell{}
+			switch val := v.(type) {
+			case nil:
+				continue
+			case string, bool, float64, ErrorValue:
+				c.Value = val
+			case time.Time:
+				c.Value, c.NumFmt = SerialDate(val), defaultDateFmt
+			default:
+				if n, ok := asNumber(val); ok {
+					c.Value = n
+				} else {
+					c.Value = toString(val)
+				}
+			}
+			s.Cells[CellRef{Row: i + 1, Col: j + 1}] = c
+		}
+	}
+	return s
+}
+
+// InferValue converts text to the value Excel would store when the text is
+// typed in a cell: numbers, percentages, booleans and dates are recognised.
+// Dates become serial numbers and the returned number format marks them as
+// dates. Empty text returns nil
+func InferValue(s string) (interface{}, string) {
+	t := strings.TrimSpace(s)
+	if t == "" {
+		return nil, ""
+	}
+	switch {
+	case strings.EqualFold(t, "TRUE"):
+		return true, ""
+	case strings.EqualFold(t, "FALSE"):
+		return false, ""
+	}
+	if n, ok := parseNumber(t); ok {
+		return n, ""
+	}
+	if strings.HasSuffix(t, "%") {
+		if n, ok := parseNumber(strings.TrimSpace(t[:len(t)-1])); ok {
+			return n / 100, "0%"
+		}
+	}
+	for _, layout := range dateLayouts {
+		if d, err := time.Parse(layout, t); err == nil {
+			return SerialDate(d), defaultDateFmt
+		}
+	}
+	return s, ""
+}
@@ -0,0 +1,99 @@
+package efp
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testCSV = `Region,Sales,Commission,Date,Active
+North,100,10,2019-01-15,TRUE
+South,-20,5,2019-02-01,false
+East,"1,250",7.5,03/01/2019,TRUE
+West,,2,,
+`
+
+func TestInferValue(t *testing.T) {
+	tt := []struct {
+		testName string
+		in       string
+		out      interface{}
+		numFmt   string
+	}{
+		{"Integer", "42", 42.0, ""},
+		{"Thousands separator", "1,250.5", 1250.5, ""},
+		{"Percent", "12.5%", 0.125, "0%"},
+		{"Boolean", "false", false, ""},
+		{"ISO date", "2019-01-01", 43466.0, defaultDateFmt},
+		{"US date", "1/2/2019", 43467.0, defaultDateFmt},
+		{"Text", "North", "North", ""},
+		{"Not a number", "NaN", "NaN", ""},
+		{"Negative with exponent", "-1.5E3", -1500.0, ""},
+		{"Thousands of thousands", "1,234,567", 1234567.0, ""},
+		{"Commas not grouping thousands", "1,2,3", "1,2,3", ""},
+		{"Comma between pairs of digits", "12,34", "12,34", ""},
+		{"Underscore between digits", "1_000", "1_000", ""},
+		{"Hexadecimal", "0x1F", "0x1F", ""},
+		{"Leading comma", ",100", ",100", ""},
+		{"Empty", " ", nil, ""},
+	}
+	var errCnt int
+	for _, tu := range tt {
+		v, numFmt := InferValue(tu.in)
+		if v != tu.out || numFmt != tu.numFmt {
+			t.Logf("Test: %v, Expected: %v %q, Got: %v %q", tu.testName, tu.out, tu.numFmt, v, numFmt)
+			errCnt++
+		}
+	}
+	if errCnt > 0 {
+		t.Errorf("Failed %v of %v test cases", errCnt, len(tt))
+	}
+}
+
+func TestCSVAsRange(t *testing.T) {
+	wb := NewWorkbook()
+	if _, err := wb.AddCSV("Data", strings.NewReader(testCSV)); err != nil {
+		t.Fatalf("AddCSV failed, Error: %v", err)
+	}
+	wb.AddRows("Rates", [][]interface{}{
+		{"Region", "Rate", "Since"},
+		{"North", 3, time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)},
+	})
+	s := wb.AddSheet("Report")
+	tt := []struct {
+		formula string
+		out     interface{}
+	}{
+		{`SUMIF(Data!B:B,">0",Data!C:C)`, 17.5},
+		{`SUMIF(Data!B:B,">0")`, 1350.0},
+		{`SUMIF(Data!B2:B5,">0",Data!C2)`, 17.5},
+		{`SUMIF(Data!B2:B5,">0",Data!$C$2:C3)`, 17.5},
+		{`SUMIF(Data!B:B,">0",Data!C1)`, 17.5},
+		{`COUNTIF(Data!A:A,"?o*")`, 2.0},
+		{`COUNTIF(Data!E:E,TRUE)`, 2.0},
+		{`COUNT(Data!B2:B5)`, 3.0},
+		{`SUM(Data!B2:C5)`, 1354.5},
+		{`Data!D2`, 43480.0},
+		{`Rates!B2*Rates!C2`, 130398.0},
+		{`LEN(Data!B5)`, 0.0},
+	}
+	var errCnt int
+	for i, tu := range tt {
+		ref := CellRef{Row: i + 1, Col: 1}.String()
+		s.SetFormula(ref, tu.formula)
+		v, err := wb.Evaluate(context.Background(), "Report", ref)
+		if err != nil {
+			t.Logf("Formula: %v, Evaluation failed, Error: %v", tu.formula, err)
+			errCnt++
+			continue
+		}
+		if v != tu.out {
+			t.Logf("Formula: %v, Expected: %v, Got: %v", tu.formula, tu.out, v)
+			errCnt++
+		}
+	}
+	if errCnt > 0 {
+		t.Errorf("Failed %v of %v test cases", errCnt, len(tt))
+	}
+}
@@ -0,0 +1,43 @@
+// Copyright © 2019 Praveen Tirumandyam praveen.tirumandyam@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package efp
+
+import (
+	"math"
+	"time"
+)
+
+// excelEpoch is day zero of Excel's 1900 date system. Using 30 Dec 1899
+// instead of 31 Dec accounts for Excel treating 1900 as a leap year
+var excelEpoch = time.Date(1899, time.December, 30, 0, 0, 0, 0, time.UTC)
+
+// date1904Offset is the number of days between day zero of the 1900 date
+// system and 1 Jan 1904, day zero of the 1904 date system
+const date1904Offset = 1462
+
+// SerialDate converts time to Excel's serial date number. The serial is
+// computed from Unix seconds as time.Duration only spans about 292 years
+func SerialDate(t time.Time) float64 {
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+	secs := float64(t.Unix()-excelEpoch.Unix()) + float64(t.Nanosecond())/1e9
+	return secs / 86400
+}
+
+// DateFromSerial converts Excel's serial date number to time in UTC
+func DateFromSerial(serial float64) time.Time {
+	days := math.Floor(serial)
+	secs := math.Round((serial - days) * 86400)
+	return excelEpoch.AddDate(0, 0, int(days)).Add(time.Duration(secs) * time.Second)
+}
@@ -15,40 +15,135 @@
 package efp
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"math"
+	"math/cmplx"
+	"math/rand"
+	"strconv"
 	"strings"
+	"text/scanner"
 
 	"github.com/PaesslerAG/gval"
 )
 
 var excelLanguage = gval.NewLanguage(
+	gval.Base(),
+	gval.PrefixMetaPrefix(scanner.Ident, parseIdent),
+	excelOperators,
 	excelLogical,
+	excelMath,
 	excelText,
-	gval.Base(),
+	excelDateTime,
+	excelLookup,
+	excelDatabase,
+	excelEngineering,
+	excelArray,
+	excelPrecedence,
+	gval.VariableSelector(selectVariable),
+)
+
+var excelOperators = gval.NewLanguage(
+	operator("+", arithmetic(func(a, b float64) (interface{}, error) { return a + b, nil })),
+	operator("-", arithmetic(func(a, b float64) (interface{}, error) { return a - b, nil })),
+	operator("*", arithmetic(func(a, b float64) (interface{}, error) { return a * b, nil })),
+	operator("/", arithmetic(func(a, b float64) (interface{}, error) {
+		if b == 0 {
+			return nil, ErrDiv0
+		}
+		return a / b, nil
+	})),
+	operator("^", arithmetic(func(a, b float64) (interface{}, error) {
+		switch {
+		case a == 0 && b == 0:
+			return nil, ErrNum
+		case a == 0 && b < 0:
+			return nil, ErrDiv0
+		}
+		return math.Pow(a, b), nil
+	})),
+	operator("&", func(a, b interface{}) (interface{}, error) {
+		return toString(a) + toString(b), nil
+	}),
+	operator("<", comparison(func(c int) bool { return c < 0 })),
+	operator("<=", comparison(func(c int) bool { return c <= 0 })),
+	operator(">", comparison(func(c int) bool { return c > 0 })),
+	operator(">=", comparison(func(c int) bool { return c >= 0 })),
+	operator("<>", comparison(func(c int) bool { return c != 0 })),
+	gval.PrefixOperator("-", func(c context.Context, v interface{}) (interface{}, error) {
+		if err := step(c); err != nil {
+			return nil, err
+		}
+		return broadcast(c, v, nil, func(a, _ interface{}) (interface{}, error) {
+			n, err := toNumber(a)
+			if err != nil {
+				return operatorError(nil, err)
+			}
+			return -n, nil
+		})
+	}),
+	gval.PrefixOperator("@", func(c context.Context, v interface{}) (interface{}, error) {
+		return implicitValue(v)
+	}),
+	// Files store the @ operator as the SINGLE function
+	function("SINGLE", implicitValue),
+	gval.PostfixOperator("%", func(c context.Context, p *gval.Parser, eval gval.Evaluable) (gval.Evaluable, error) {
+		return func(c context.Context, v interface{}) (interface{}, error) {
+			a, err := eval(c, v)
+			if err != nil {
+				return nil, err
+			}
+			return broadcast(c, a, nil, func(a, _ interface{}) (interface{}, error) {
+				n, err := toNumber(a)
+				if err != nil {
+					return nil, err
+				}
+				return n / 100, nil
+			})
+		}, nil
+	}),
+)
+
+// excelPrecedence sets the precedence of operators that differs from gval.
+// gval replaces the precedence of operators registered with operator by the
+// one of the language they are merged into, so it is applied last
+var excelPrecedence = gval.NewLanguage(
+	gval.Precedence("=", 40),
+	gval.Precedence("<>", 40),
+	gval.Precedence("&", 100),
+	gval.Precedence("^", 200),
+	gval.Precedence("%", 250),
 )
 
 var excelText = gval.NewLanguage(
-	gval.Function("CONCAT", func(args ...interface{}) string {
+	function("ARRAYTOTEXT", func(v interface{}, format ...float64) (string, error) {
+		strict, err := textFormat(format)
+		if err != nil {
+			return "", err
+		}
+		return ArrayToText(toArray(v), strict), nil
+	}),
+	function("CONCAT", func(args ...interface{}) string {
 		str := make([]string, 0)
 		for _, arg := range args {
 			str = append(str, toString(arg))
 		}
 		return concat(str...)
 	}),
-	gval.Function("CONCATENATE", func(args ...interface{}) string {
+	function("CONCATENATE", func(args ...interface{}) string {
 		str := make([]string, 0)
 		for _, arg := range args {
 			str = append(str, toString(arg))
 		}
 		return concat(str...)
 	}),
-	gval.Function("EXACT", func(a, b interface{}) bool {
+	function("EXACT", func(a, b interface{}) bool {
 		aStr := toString(a)
 		bStr := toString(b)
 		return Exact(aStr, bStr)
 	}),
-	gval.Function("FIND", func(src, fnd interface{}, num ...float64) float64 {
+	function("FIND", func(src, fnd interface{}, num ...float64) float64 {
 		srcStr := toString(src)
 		fndStr := toString(fnd)
 		startPos := 1
@@ -57,7 +152,7 @@ var excelText = gval.NewLanguage(
 		}
 		return float64(Find(srcStr, fndStr, startPos))
 	}),
-	gval.Function("LEFT", func(s interface{}, num ...float64) string {
+	function("LEFT", func(s interface{}, num ...float64) string {
 		str := toString(s)
 		l := 1
 		if len(num) > 0 {
@@ -65,32 +160,64 @@ var excelText = gval.NewLanguage(
 		}
 		return Left(str, l)
 	}),
-	gval.Function("LEN", func(s interface{}) float64 {
+	function("LEN", func(s interface{}) float64 {
 		str := toString(s)
 		return float64(Len(str))
 	}),
-	gval.Function("LOWER", func(s interface{}) string {
+	function("LOWER", func(s interface{}) string {
 		str := toString(s)
 		return Lower(str)
 	}),
-	gval.Function("MID", func(s interface{}, strt, num float64) string {
+	function("MID", func(s interface{}, strt, num float64) string {
 		str := toString(s)
 		return Mid(str, int(strt), int(num))
 	}),
-	gval.Function("PROPER", func(a interface{}) string {
+	function("PROPER", func(a interface{}) string {
 		str := toString(a)
 		return Proper(str)
 	}),
-	gval.Function("REPLACE", func(a interface{}, strt, num float64, b interface{}) string {
+	function("REGEXEXTRACT", func(s, pattern interface{}, opt ...float64) (interface{}, error) {
+		mode := 0.0
+		if len(opt) > 0 {
+			mode = opt[0]
+		}
+		cs, err := regexCaseSensitive(opt, 1)
+		if err != nil {
+			return nil, err
+		}
+		return RegexExtract(toString(s), toString(pattern), int(mode), cs)
+	}),
+	function("REGEXREPLACE", func(s, pattern, replacement interface{}, opt ...float64) (string, error) {
+		occurrence := 0.0
+		if len(opt) > 0 {
+			occurrence = opt[0]
+		}
+		cs, err := regexCaseSensitive(opt, 1)
+		if err != nil {
+			return "", err
+		}
+		return RegexReplace(toString(s), toString(pattern), toString(replacement), int(occurrence), cs)
+	}),
+	function("REGEXTEST", func(s, pattern interface{}, opt ...float64) (bool, error) {
+		cs, err := regexCaseSensitive(opt, 0)
+		if err != nil {
+			return false, err
+		}
+		return RegexTest(toString(s), toString(pattern), cs)
+	}),
+	function("REPLACE", func(a interface{}, strt, num float64, b interface{}) string {
 		aStr := toString(a)
 		bStr := toString(b)
 		return Replace(aStr, int(strt), int(num), bStr)
 	}),
-	gval.Function("REPT", func(s interface{}, num float64) string {
+	function("REPT", func(c context.Context, s interface{}, num float64) (string, error) {
 		str := toString(s)
-		return Rept(str, int(num))
+		if err := checkStringLength(c, float64(len(str))*num); err != nil {
+			return "", err
+		}
+		return Rept(str, int(num)), nil
 	}),
-	gval.Function("RIGHT", func(s interface{}, num ...float64) string {
+	function("RIGHT", func(s interface{}, num ...float64) string {
 		str := toString(s)
 		l := 1
 		if len(num) > 0 {
@@ -98,7 +225,7 @@ var excelText = gval.NewLanguage(
 		}
 		return Right(str, l)
 	}),
-	gval.Function("SEARCH", func(fnd, src interface{}, strt ...float64) float64 {
+	function("SEARCH", func(fnd, src interface{}, strt ...float64) float64 {
 		fndStr := toString(fnd)
 		srcStr := toString(src)
 		l := 1
@@ -107,7 +234,7 @@ var excelText = gval.NewLanguage(
 		}
 		return float64(Search(fndStr, srcStr, l))
 	}),
-	gval.Function("SUBSTITUTE", func(src, old, new interface{}, num ...float64) string {
+	function("SUBSTITUTE", func(src, old, new interface{}, num ...float64) string {
 		srcStr := toString(src)
 		oldStr := toString(old)
 		newStr := toString(new)
@@ -117,31 +244,459 @@ var excelText = gval.NewLanguage(
 		}
 		return Substitute(srcStr, oldStr, newStr, n)
 	}),
-	gval.Function("TRIM", func(s interface{}) string {
+	function("TEXTAFTER", func(text, delims interface{}, opt ...interface{}) (interface{}, error) {
+		return textAround(text, delims, opt, TextAfter)
+	}),
+	function("TEXTBEFORE", func(text, delims interface{}, opt ...interface{}) (interface{}, error) {
+		return textAround(text, delims, opt, TextBefore)
+	}),
+	function("TEXTSPLIT", func(text, colDelims interface{}, opt ...interface{}) (Array, error) {
+		var rowDelims []string
+		if len(opt) > 0 {
+			rowDelims = textList(opt[0])
+		}
+		var ignoreEmpty, ignoreCase bool
+		var err error
+		if len(opt) > 1 {
+			if ignoreEmpty, err = toBool(opt[1]); err != nil {
+				return nil, err
+			}
+		}
+		if len(opt) > 2 {
+			if ignoreCase, err = toBool(opt[2]); err != nil {
+				return nil, err
+			}
+		}
+		var pad interface{} = ErrNA
+		if len(opt) > 3 && opt[3] != nil {
+			pad = opt[3]
+		}
+		if len(opt) > 4 {
+			return nil, ErrValue
+		}
+		return TextSplit(toString(text), textList(colDelims), rowDelims, ignoreEmpty, ignoreCase, pad), nil
+	}),
+	function("TRIM", func(s interface{}) string {
 		str := toString(s)
 		return Trim(str)
 	}),
-	gval.Function("UPPER", func(s interface{}) string {
+	function("UPPER", func(s interface{}) string {
 		str := toString(s)
 		return Upper(str)
 	}),
+	function("VALUETOTEXT", func(v interface{}, format ...float64) (string, error) {
+		strict, err := textFormat(format)
+		if err != nil {
+			return "", err
+		}
+		return ValueToText(v, strict), nil
+	}),
+)
+
+var excelMath = gval.NewLanguage(
+	function("COUNT", func(args ...interface{}) float64 {
+		return float64(Count(args...))
+	}),
+	function("COUNTIF", func(rng, crit interface{}) float64 {
+		return float64(CountIf(toArray(rng), crit))
+	}),
+	function("MDETERM", MDeterm),
+	function("MINVERSE", MInverse),
+	function("MMULT", func(c context.Context, a, b Array) (Array, error) {
+		rows, _ := a.size()
+		_, cols := b.size()
+		if err := checkArraySize(c, float64(rows)*float64(cols)); err != nil {
+			return nil, err
+		}
+		return MMult(a, b)
+	}),
+	function("MUNIT", func(c context.Context, n float64) (Array, error) {
+		if err := checkArraySize(c, n*n); err != nil {
+			return nil, err
+		}
+		return MUnit(int(n))
+	}),
+	function("SUM", func(args ...interface{}) (float64, error) {
+		return Sum(args...)
+	}),
+	function("SUMPRODUCT", SumProduct),
+	function("SUMX2MY2", SumX2MY2),
+	function("SUMX2PY2", SumX2PY2),
+	function("SUMXMY2", SumXMY2),
+	function("SUMIF", func(rng, crit interface{}, sumRng ...interface{}) (float64, error) {
+		var sr Array
+		if len(sumRng) > 0 {
+			sr = toArray(sumRng[0])
+		}
+		return SumIf(toArray(rng), crit, sr)
+	}),
+	volatileFunction("RAND", func() float64 {
+		return rand.Float64()
+	}),
+	volatileFunction("RANDBETWEEN", func(bottom, top float64) (float64, error) {
+		lo, hi := math.Ceil(bottom), math.Floor(top)
+		if lo > hi {
+			return 0, ErrNum
+		}
+		return lo + math.Floor(rand.Float64()*(hi-lo+1)), nil
+	}),
+)
+
+// excelDateTime holds the functions returning the current date and time. All
+// cells of a recalculation see the same time, see withNow
+var excelDateTime = gval.NewLanguage(
+	volatileFunction("NOW", func(c context.Context) float64 {
+		return SerialDate(now(c))
+	}),
+	volatileFunction("TODAY", func(c context.Context) float64 {
+		return math.Floor(SerialDate(now(c)))
+	}),
+)
+
+// excelLookup holds the functions working on references. The reference forms
+// prefixed by '_' are called for OFFSET and INDIRECT given to a reference
+// parameter, see referenceOperators
+var excelLookup = gval.NewLanguage(
+	function("ADDRESS", func(row, col float64, opt ...interface{}) (string, error) {
+		abs, a1, sheet := 1.0, true, ""
+		var err error
+		if len(opt) > 0 && opt[0] != nil {
+			if abs, err = toNumber(opt[0]); err != nil {
+				return "", err
+			}
+		}
+		if len(opt) > 1 && opt[1] != nil {
+			if a1, err = toBool(opt[1]); err != nil {
+				return "", err
+			}
+		}
+		if len(opt) > 2 {
+			sheet = toString(opt[2])
+		}
+		if len(opt) > 3 {
+			return "", ErrValue
+		}
+		return Address(int(row), int(col), int(abs), a1, sheet)
+	}),
+	function("CHOOSE", func(index float64, values ...interface{}) (interface{}, error) {
+		return Choose(int(index), values...)
+	}),
+	function("COLUMN", func(c context.Context, ref ...interface{}) (interface{}, error) {
+		return lines(c, ref, false)
+	}),
+	function("COLUMNS", func(v interface{}) (float64, error) {
+		return dimension(v, false)
+	}),
+	referenceFunction("INDIRECT", func(c context.Context, text string, a1 ...bool) (interface{}, error) {
+		refs, err := indirect(c, text, a1)
+		if err != nil {
+			return nil, err
+		}
+		return resolveRefs(c, c.Value(paramKey{}), refs)
+	}),
+	volatileFunction("_INDIRECT", func(c context.Context, text string, a1 ...bool) (interface{}, error) {
+		refs, err := indirect(c, text, a1)
+		if err != nil {
+			return nil, err
+		}
+		if len(refs) != 1 {
+			return nil, ErrRef
+		}
+		return refs[0], nil
+	}),
+	referenceFunction("OFFSET", func(c context.Context, ref interface{}, rows, cols float64, dims ...float64) (interface{}, error) {
+		r, err := offset(ref, rows, cols, dims)
+		if err != nil {
+			return nil, err
+		}
+		return resolveIn(c, r)
+	}),
+	volatileFunction("_OFFSET", func(ref interface{}, rows, cols float64, dims ...float64) (interface{}, error) {
+		return offset(ref, rows, cols, dims)
+	}),
+	function("ROW", func(c context.Context, ref ...interface{}) (interface{}, error) {
+		return lines(c, ref, true)
+	}),
+	function("ROWS", func(v interface{}) (float64, error) {
+		return dimension(v, true)
+	}),
+)
+
+// excelDatabase holds the functions selecting the records of a database
+// range with a criteria range, see records
+var excelDatabase = gval.NewLanguage(
+	function("DAVERAGE", DAverage),
+	function("DCOUNT", func(database Array, field interface{}, crit Array) (float64, error) {
+		n, err := DCount(database, field, crit)
+		return float64(n), err
+	}),
+	function("DGET", DGet),
+	function("DMAX", DMax),
+	function("DMIN", DMin),
+	function("DPRODUCT", DProduct),
+	function("DSTDEV", DStdev),
+	function("DSUM", DSum),
+)
+
+// excelArray holds the functions reshaping arrays
+var excelArray = gval.NewLanguage(
+	function(arrayFunc, func(rows ...Array) (Array, error) {
+		arr := make(Array, len(rows))
+		for i, row := range rows {
+			if len(row[0]) == 0 || len(row[0]) != len(rows[0][0]) {
+				return nil, fmt.Errorf("rows of array constant differ in length")
+			}
+			arr[i] = row[0]
+		}
+		return arr, nil
+	}),
+	function(arrayRowFunc, func(values ...lazy) (Array, error) {
+		// Error literals are values of the array like #N/A in {1,#N/A}
+		row := make([]interface{}, len(values))
+		for i, value := range values {
+			v, err := value()
+			if e, ok := err.(ErrorValue); ok {
+				v, err = e, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			row[i] = v
+		}
+		return Array{row}, nil
+	}),
+	function("CHOOSECOLS", func(arr Array, idx ...float64) (Array, error) {
+		return ChooseCols(arr, indexes(idx)...)
+	}),
+	function("CHOOSEROWS", func(arr Array, idx ...float64) (Array, error) {
+		return ChooseRows(arr, indexes(idx)...)
+	}),
+	function("DROP", func(arr Array, n ...float64) (Array, error) {
+		rows, cols := 0, 0
+		if len(n) > 0 {
+			rows = int(n[0])
+		}
+		if len(n) > 1 {
+			cols = int(n[1])
+		}
+		return Drop(arr, rows, cols)
+	}),
+	function("EXPAND", func(c context.Context, arr Array, rows float64, opt ...interface{}) (Array, error) {
+		_, cols := arr.size()
+		if len(opt) > 0 && opt[0] != nil {
+			n, err := toNumber(opt[0])
+			if err != nil {
+				return nil, err
+			}
+			cols = int(n)
+		}
+		var pad interface{} = ErrNA
+		if len(opt) > 1 && opt[1] != nil {
+			pad = opt[1]
+		}
+		if err := checkArraySize(c, rows*float64(cols)); err != nil {
+			return nil, err
+		}
+		return Expand(arr, int(rows), cols, pad)
+	}),
+	function("HSTACK", func(args ...interface{}) Array {
+		return HStack(arrays(args)...)
+	}),
+	function("TAKE", func(arr Array, n ...interface{}) (Array, error) {
+		rows, cols := arr.size()
+		for i, p := range []*int{&rows, &cols} {
+			if i >= len(n) || n[i] == nil {
+				continue
+			}
+			v, err := toNumber(n[i])
+			if err != nil {
+				return nil, err
+			}
+			*p = int(v)
+		}
+		return Take(arr, rows, cols)
+	}),
+	function("TOCOL", func(arr Array, opt ...interface{}) (Array, error) {
+		ignore, byCol, err := flattenOptions(opt)
+		if err != nil {
+			return nil, err
+		}
+		return ToCol(arr, ignore, byCol)
+	}),
+	function("TOROW", func(arr Array, opt ...interface{}) (Array, error) {
+		ignore, byCol, err := flattenOptions(opt)
+		if err != nil {
+			return nil, err
+		}
+		return ToRow(arr, ignore, byCol)
+	}),
+	function("TRANSPOSE", Transpose),
+	function("VSTACK", func(args ...interface{}) Array {
+		return VStack(arrays(args)...)
+	}),
+	function("WRAPCOLS", func(c context.Context, vector Array, wrap float64, pad ...interface{}) (Array, error) {
+		if err := checkArraySize(c, wrapSize(vector, wrap)); err != nil {
+			return nil, err
+		}
+		return WrapCols(vector, int(wrap), padding(pad))
+	}),
+	function("WRAPROWS", func(c context.Context, vector Array, wrap float64, pad ...interface{}) (Array, error) {
+		if err := checkArraySize(c, wrapSize(vector, wrap)); err != nil {
+			return nil, err
+		}
+		return WrapRows(vector, int(wrap), padding(pad))
+	}),
+)
+
+// wrapSize returns the number of values WRAPROWS and WRAPCOLS make of vector
+// including the padding
+func wrapSize(vector Array, wrap float64) float64 {
+	if wrap < 1 {
+		return 0
+	}
+	rows, cols := vector.size()
+	return math.Ceil(float64(rows*cols)/wrap) * wrap
+}
+
+// arrays returns the arguments of VSTACK and HSTACK as arrays. Each area of
+// a multi-area reference is an array of its own
+func arrays(args []interface{}) []Array {
+	out := make([]Array, 0, len(args))
+	for _, a := range args {
+		if areas, ok := a.(Areas); ok {
+			out = append(out, areas...)
+			continue
+		}
+		out = append(out, toArray(a))
+	}
+	return out
+}
+
+// indexes converts the row or column numbers of CHOOSEROWS and CHOOSECOLS
+func indexes(idx []float64) []int {
+	out := make([]int, len(idx))
+	for i, n := range idx {
+		out[i] = int(n)
+	}
+	if len(out) == 0 {
+		// At least one number is required, 0 is never valid
+		out = append(out, 0)
+	}
+	return out
+}
+
+// flattenOptions reads the optional ignore and scan by column arguments of
+// TOCOL and TOROW
+func flattenOptions(opt []interface{}) (int, bool, error) {
+	ignore, byCol := 0.0, false
+	var err error
+	if len(opt) > 0 && opt[0] != nil {
+		if ignore, err = toNumber(opt[0]); err != nil {
+			return 0, false, err
+		}
+	}
+	if len(opt) > 1 {
+		if byCol, err = toBool(opt[1]); err != nil {
+			return 0, false, err
+		}
+	}
+	return int(ignore), byCol, nil
+}
+
+// padding returns the optional pad argument, #N/A when omitted
+func padding(pad []interface{}) interface{} {
+	if len(pad) == 0 || pad[0] == nil {
+		return ErrNA
+	}
+	return pad[0]
+}
+
+// excelEngineering holds the base conversions, bitwise functions, CONVERT and
+// the IM functions working on complex numbers written like 3+4i
+var excelEngineering = gval.NewLanguage(
+	baseFunctions(),
+	function("BITAND", func(a, b float64) (float64, error) {
+		return Bitwise(a, b, func(x, y uint64) uint64 { return x & y })
+	}),
+	function("BITOR", func(a, b float64) (float64, error) {
+		return Bitwise(a, b, func(x, y uint64) uint64 { return x | y })
+	}),
+	function("BITXOR", func(a, b float64) (float64, error) {
+		return Bitwise(a, b, func(x, y uint64) uint64 { return x ^ y })
+	}),
+	function("BITLSHIFT", BitShift),
+	function("BITRSHIFT", func(n, shift float64) (float64, error) {
+		return BitShift(n, -shift)
+	}),
+	function("CONVERT", Convert),
+	function("DELTA", func(a float64, b ...float64) float64 {
+		if len(b) == 0 {
+			return Delta(a, 0)
+		}
+		return Delta(a, b[0])
+	}),
+	function("GESTEP", func(n float64, step ...float64) float64 {
+		if len(step) == 0 {
+			return GeStep(n, 0)
+		}
+		return GeStep(n, step[0])
+	}),
+	function("COMPLEX", func(re, im float64, suffix ...string) (string, error) {
+		if len(suffix) == 0 {
+			return Complex(re, im, "")
+		}
+		return Complex(re, im, suffix[0])
+	}),
+	function("IMABS", imReal(func(z complex128) (float64, error) { return cmplx.Abs(z), nil })),
+	function("IMAGINARY", imReal(func(z complex128) (float64, error) { return imag(z), nil })),
+	function("IMARGUMENT", imReal(func(z complex128) (float64, error) {
+		if z == 0 {
+			return 0, ErrDiv0
+		}
+		return cmplx.Phase(z), nil
+	})),
+	function("IMREAL", imReal(func(z complex128) (float64, error) { return real(z), nil })),
+	function("IMCONJUGATE", imUnary(cmplx.Conj, nil)),
+	function("IMCOS", imUnary(cmplx.Cos, nil)),
+	function("IMCOSH", imUnary(cmplx.Cosh, nil)),
+	function("IMCOT", imUnary(cmplx.Cot, nonZero)),
+	function("IMCSC", imUnary(func(z complex128) complex128 { return 1 / cmplx.Sin(z) }, nonZero)),
+	function("IMCSCH", imUnary(func(z complex128) complex128 { return 1 / cmplx.Sinh(z) }, nonZero)),
+	function("IMEXP", imUnary(cmplx.Exp, nil)),
+	function("IMLN", imUnary(cmplx.Log, nonZero)),
+	function("IMLOG10", imUnary(cmplx.Log10, nonZero)),
+	function("IMLOG2", imUnary(func(z complex128) complex128 { return cmplx.Log(z) / math.Ln2 }, nonZero)),
+	function("IMSEC", imUnary(func(z complex128) complex128 { return 1 / cmplx.Cos(z) }, nil)),
+	function("IMSECH", imUnary(func(z complex128) complex128 { return 1 / cmplx.Cosh(z) }, nil)),
+	function("IMSIN", imUnary(cmplx.Sin, nil)),
+	function("IMSINH", imUnary(cmplx.Sinh, nil)),
+	function("IMSQRT", imUnary(cmplx.Sqrt, nil)),
+	function("IMTAN", imUnary(cmplx.Tan, nil)),
+	function("IMDIV", imBinary(imDiv)),
+	function("IMSUB", imBinary(imSub)),
+	function("IMPOWER", imPower),
+	function("IMPRODUCT", imFunction(imProduct)),
+	function("IMSUM", imFunction(imSum)),
 )
 
 // TODO: Implement XOR
 var excelLogical = gval.NewLanguage(
-	gval.InfixTextOperator("=", func(a, b string) (interface{}, error) {
-		if strings.Compare(a, b) != 0 {
+	operator("=", comparison(func(c int) bool { return c == 0 })),
+	function("IF", func(cond bool, branches ...lazy) (interface{}, error) {
+		i := 0
+		if !cond {
+			i = 1
+		}
+		if i >= len(branches) {
 			return false, nil
 		}
-		return true, nil
-	}),
-	gval.Function("IF", func(cond bool, valTrue, valFalse string) string {
-		if !cond {
-			return valFalse
+		v, err := branches[i]()
+		if v == nil && err == nil {
+			return 0.0, nil
 		}
-		return valTrue
+		return v, err
 	}),
-	gval.Function("AND", func(args ...bool) bool {
+	function("AND", func(args ...bool) bool {
 		for _, arg := range args {
 			if !arg {
 				return false
@@ -149,7 +704,7 @@ var excelLogical = gval.NewLanguage(
 		}
 		return true
 	}),
-	gval.Function("OR", func(args ...bool) bool {
+	function("OR", func(args ...bool) bool {
 		for _, arg := range args {
 			if arg {
 				return true
@@ -157,28 +712,325 @@ var excelLogical = gval.NewLanguage(
 		}
 		return false
 	}),
-	gval.Function("FALSE", func() bool {
+	function("FALSE", func() bool {
 		return false
 	}),
-	gval.Function("NOT", func(a bool) bool {
+	function("NOT", func(a bool) bool {
 		return !a
 	}),
-	gval.Function("TRUE", func() bool {
+	function("TRUE", func() bool {
 		return true
 	}),
 )
 
-// toString leverages fmt library to convert values to string
+// toString leverages fmt library to convert values to string. Empty values
+// and booleans are converted the way Excel displays them
 func toString(v interface{}) string {
+	switch b := v.(type) {
+	case nil:
+		return ""
+	case bool:
+		if b {
+			return "TRUE"
+		}
+		return "FALSE"
+	}
 	return fmt.Sprint(v)
 }
 
-// Parse parses the excel formula provided and returns the Eval interface which can be used to evaluate formula
+// operator registers infix operator name. Each evaluation of the operator is
+// a step of the evaluation and text it produces must be within limits.
+// Operators on arrays apply to each of their values, see broadcast
+func operator(name string, f func(a, b interface{}) (interface{}, error)) gval.Language {
+	return gval.InfixEvalOperator(name, func(a, b gval.Evaluable) (gval.Evaluable, error) {
+		return func(c context.Context, v interface{}) (interface{}, error) {
+			if err := step(c); err != nil {
+				return nil, err
+			}
+			x, err := a(c, v)
+			if err != nil {
+				return nil, err
+			}
+			y, err := b(c, v)
+			if err != nil {
+				return nil, err
+			}
+			r, err := broadcast(c, x, y, f)
+			if err != nil {
+				return nil, err
+			}
+			return r, checkValue(c, r)
+		}, nil
+	})
+}
+
+// broadcast applies op to the values of a and b at the same position when
+// either is an Array, the way Excel evaluates operators on arrays. Single
+// values and arrays of one row or column are repeated to the size of the
+// other operand; positions beyond an array are #N/A
+func broadcast(c context.Context, a, b interface{}, op func(a, b interface{}) (interface{}, error)) (interface{}, error) {
+	x, isArr := a.(Array)
+	y, ok := b.(Array)
+	if !isArr && !ok {
+		return op(a, b)
+	}
+	if !isArr {
+		x = Array{{a}}
+	}
+	if !ok {
+		y = Array{{b}}
+	}
+	xr, xc := x.size()
+	yr, yc := y.size()
+	rows, cols := maxInt(xr, yr), maxInt(xc, yc)
+	if err := checkArraySize(c, float64(rows)*float64(cols)); err != nil {
+		return nil, err
+	}
+	at := func(arr Array, h, w, i, j int) interface{} {
+		if h == 1 {
+			i = 0
+		}
+		if w == 1 {
+			j = 0
+		}
+		if i >= h || j >= w {
+			return ErrNA
+		}
+		return arr.at(i, j)
+	}
+	out := make(Array, rows)
+	for i := range out {
+		out[i] = make([]interface{}, cols)
+		for j := range out[i] {
+			v, err := op(at(x, xr, xc, i, j), at(y, yr, yc, i, j))
+			if err != nil {
+				return nil, err
+			}
+			out[i][j] = v
+		}
+	}
+	return out, nil
+}
+
+// textAround evaluates TEXTBEFORE and TEXTAFTER with fn. The optional
+// arguments are the instance, the match mode, match end and the value
+// returned when the delimiter is not found
+func textAround(text, delims interface{}, opt []interface{}, fn func(string, []string, int, bool, bool) (string, error)) (interface{}, error) {
+	instance := 1.0
+	var ignoreCase, matchEnd bool
+	var err error
+	if len(opt) > 0 && opt[0] != nil {
+		if instance, err = toNumber(opt[0]); err != nil {
+			return nil, err
+		}
+	}
+	if len(opt) > 1 {
+		if ignoreCase, err = toBool(opt[1]); err != nil {
+			return nil, err
+		}
+	}
+	if len(opt) > 2 {
+		if matchEnd, err = toBool(opt[2]); err != nil {
+			return nil, err
+		}
+	}
+	if len(opt) > 4 {
+		return nil, ErrValue
+	}
+	s, err := fn(toString(text), textList(delims), int(instance), ignoreCase, matchEnd)
+	if err == ErrNA && len(opt) > 3 && opt[3] != nil {
+		return opt[3], nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// textList returns the texts of an argument that is either a single text or
+// an array of them, like the delimiters of TEXTSPLIT. Omitted arguments have
+// none
+func textList(v interface{}) []string {
+	if v == nil {
+		return nil
+	}
+	arr, ok := v.(Array)
+	if !ok {
+		return []string{toString(v)}
+	}
+	var out []string
+	for _, row := range arr {
+		for _, e := range row {
+			out = append(out, toString(e))
+		}
+	}
+	return out
+}
+
+// textFormat reads the format argument of VALUETOTEXT and ARRAYTOTEXT: 0,
+// the default, for concise and 1 for strict
+func textFormat(format []float64) (bool, error) {
+	if len(format) == 0 || format[0] == 0 {
+		return false, nil
+	}
+	if format[0] == 1 {
+		return true, nil
+	}
+	return false, ErrValue
+}
+
+// regexCaseSensitive reads the case sensitivity argument of the REGEX
+// functions at index i of opt: 0, the default, for case sensitive matching
+// and 1 for matching ignoring case
+func regexCaseSensitive(opt []float64, i int) (bool, error) {
+	if len(opt) <= i {
+		return true, nil
+	}
+	switch opt[i] {
+	case 0:
+		return true, nil
+	case 1:
+		return false, nil
+	}
+	return false, ErrValue
+}
+
+// implicitValue returns the top left value of an array for the @ operator
+// applied to values other than references
+func implicitValue(v interface{}) (interface{}, error) {
+	switch a := v.(type) {
+	case Areas:
+		return nil, ErrValue
+	case Array:
+		if len(a) == 0 || len(a[0]) == 0 {
+			return nil, nil
+		}
+		return a[0][0], nil
+	}
+	return v, nil
+}
+
+// operatorError returns Excel errors raised by an operator as its value.
+// gval evaluates operators on constants while parsing, so an error like the
+// #DIV/0! of 1/0 would otherwise fail the parse
+func operatorError(v interface{}, err error) (interface{}, error) {
+	if e, ok := err.(ErrorValue); ok {
+		return e, nil
+	}
+	return v, err
+}
+
+// arithmetic converts both operands to numbers before applying the operator.
+// Results too large for a number or not a real number are #NUM!
+func arithmetic(op func(a, b float64) (interface{}, error)) func(a, b interface{}) (interface{}, error) {
+	return func(a, b interface{}) (interface{}, error) {
+		x, err := toNumber(a)
+		if err != nil {
+			return operatorError(nil, err)
+		}
+		y, err := toNumber(b)
+		if err != nil {
+			return operatorError(nil, err)
+		}
+		r, err := op(x, y)
+		if n, ok := r.(float64); ok && (math.IsInf(n, 0) || math.IsNaN(n)) {
+			return ErrNum, nil
+		}
+		return operatorError(r, err)
+	}
+}
+
+// comparison orders operands the way Excel does: numbers sort before text and
+// text before booleans. Text is compared ignoring case
+func comparison(ok func(c int) bool) func(a, b interface{}) (interface{}, error) {
+	return func(a, b interface{}) (interface{}, error) {
+		c, err := compareValues(a, b)
+		if err != nil {
+			return operatorError(nil, err)
+		}
+		return ok(c), nil
+	}
+}
+
+func compareValues(a, b interface{}) (int, error) {
+	for _, v := range []interface{}{a, b} {
+		if e, ok := v.(ErrorValue); ok {
+			return 0, e
+		}
+	}
+	rank := func(v interface{}) int {
+		switch v.(type) {
+		case string:
+			return 1
+		case bool:
+			return 2
+		}
+		return 0
+	}
+	// Empty cell takes the type of the other operand
+	if a == nil {
+		a = zeroLike(b)
+	}
+	if b == nil {
+		b = zeroLike(a)
+	}
+	ra, rb := rank(a), rank(b)
+	if ra != rb {
+		return ra - rb, nil
+	}
+	switch ra {
+	case 1:
+		return strings.Compare(strings.ToLower(a.(string)), strings.ToLower(b.(string))), nil
+	case 2:
+		return strings.Compare(strconv.FormatBool(a.(bool)), strconv.FormatBool(b.(bool))), nil
+	}
+	x, err := toNumber(a)
+	if err != nil {
+		return 0, err
+	}
+	y, err := toNumber(b)
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case x < y:
+		return -1, nil
+	case x > y:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// zeroLike returns the empty value of the same kind as v
+func zeroLike(v interface{}) interface{} {
+	switch v.(type) {
+	case string:
+		return ""
+	case bool:
+		return false
+	}
+	return 0.0
+}
+
+// Parse parses the excel formula provided and returns the Eval interface which can be used to evaluate formula.
+// Leading '=' is optional. Formula referring to cells must be evaluated with a Resolver as parameter
 func Parse(r io.WriterTo) (gval.Evaluable, error) {
 	var sb strings.Builder
 	var wrTo io.Writer = &sb
 	r.WriteTo(wrTo)
-	exp := sb.String()
+	return parse(sb.String(), 0)
+}
 
-	return excelLanguage.NewEvaluable(exp)
+// parse translates formula to gval and parses it. Formulas nested deeper
+// than maxDepth are rejected unless maxDepth is 0
+func parse(formula string, maxDepth int) (gval.Evaluable, error) {
+	exp := strings.TrimPrefix(formula, "=")
+	toks, err := lex(exp)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkNesting(nesting(toks), maxDepth); err != nil {
+		return nil, err
+	}
+	return excelLanguage.NewEvaluable(translate(toks))
 }
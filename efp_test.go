@@ -2,6 +2,7 @@ package efp_test
 
 import (
 	"context"
+	"fmt"
 	"reflect"
 	"strings"
 	"testing"
@@ -136,11 +137,11 @@ func TestNestedStringFunc(t *testing.T) {
 	}{
 		{"CONCAT with LEFT, MID and RIGHT", `SUBSTITUTE(CONCATENATE(LEFT("Hello World", 5),MID("Hello World", 6, 1),RIGHT("Hello World", 5)), "World", "India")`, "Hello India"},
 		{"IF with true return", `IF("Hello" = "Hello", "Hello World", "Hello India")`, "Hello World"},
-		{"IF with false return", `IF("Hello" = "hello", "Hello World", "Hello India")`, "Hello India"},
+		{"IF with false return", `IF("Hello" = "World", "Hello World", "Hello India")`, "Hello India"},
 		// {"IF with numerical compariso", `IF(10000 > 1000, "Hello World", "Hello India")`, "Hello World"},
 		// {"IF with numerical compariso", `IF(10000 > 1000, 45, 35)`, "45"},
-		{"Nested IFs", `IF("Hello" = "hello", "Bah!!!", IF(TRUE, "Hello India", "Bah!!!"))`, "Hello India"},
-		{"NOT and False", `IF("Hello" = "hello", "Bah!!!", IF(NOT(FALSE), "Hello India", "Bah!!!"))`, "Hello India"},
+		{"Nested IFs", `IF("Hello" = "World", "Bah!!!", IF(TRUE, "Hello India", "Bah!!!"))`, "Hello India"},
+		{"NOT and False", `IF("Hello" = "World", "Bah!!!", IF(NOT(FALSE), "Hello India", "Bah!!!"))`, "Hello India"},
 	}
 	var errCnt int
 	for _, tu := range tt {
@@ -174,11 +175,15 @@ func TestBoolFunctions(t *testing.T) {
 	}{
 		{"Equality operator for strings", `("Hello" = "Hello")`, true},
 		{"Equality check for numbers", `(1 = 1)`, true},
-		{"Case mis-match in equality check", `("Hello" = "hello")`, false},
+		{"Case ignored in equality check", `("Hello" = "hello")`, true},
+		{"Number is not equal to text", `(1 = "1")`, false},
+		{"Boolean is not equal to number", `(TRUE = 1)`, false},
+		{"Not equal ignores case", `("a" <> "A")`, false},
+		{"Not equal across types", `(1 <> "1")`, true},
 		{"AND with true return", `AND("Hello" = "Hello", 1=1)`, true},
-		{"AND with false return", `AND(1=1, "Hello" = "hello")`, false},
+		{"AND with false return", `AND(1=1, "Hello" = "World")`, false},
 		{"OR with true return", `OR("Hello" = "hello", 1=1)`, true},
-		{"OR with false return", `OR(1=5, "Hello" = "hello")`, false},
+		{"OR with false return", `OR(1=5, "Hello" = "World")`, false},
 	}
 	var errCnt int
 	for _, tu := range tt {
@@ -242,6 +247,64 @@ func TestParameterExpressions(t *testing.T) {
 	}
 }
 
+func TestOperators(t *testing.T) {
+	tt := []struct {
+		name string
+		exp  string
+		in   map[string]interface{}
+		out  interface{}
+	}{
+		{"Leading equal sign", `=1+2`, nil, 3.0},
+		{"Precedence of multiplication", `1+2*3`, nil, 7.0},
+		{"Negation before power", `-2^2`, nil, 4.0},
+		{"Percent", `50%*2`, nil, 1.0},
+		{"Concatenation", `"Total: "&10`, nil, "Total: 10"},
+		{"Numeric comparison", `10000 > 1000`, nil, true},
+		{"Text comparison ignores case", `"b" > "A"`, nil, true},
+		{"Not equal", `"a" <> "b"`, nil, true},
+		{"Doubled quotes in string", `"say ""hi"""`, nil, `say "hi"`},
+		{"Reference looked up in parameters", `A1*$B$2`, map[string]interface{}{"A1": 2.0, "B2": 3.0}, 6.0},
+		{"Power before addition", `2^3+1`, nil, 9.0},
+		{"Addition before concatenation", `1+2&3`, nil, "33"},
+		{"Division by zero", `1/0`, nil, efp.ErrDiv0},
+		{"Product too large", `1E308*10`, nil, efp.ErrNum},
+		{"Power too large", `2^2000`, nil, efp.ErrNum},
+		{"Root of negative number", `(-8)^(1/3)`, nil, efp.ErrNum},
+		{"Zero to the power of zero", `0^0`, nil, efp.ErrNum},
+		{"Zero to a negative power", `0^-1`, nil, efp.ErrDiv0},
+		{"Unknown function", `NOSUCH(1)+1`, nil, efp.ErrName},
+		{"IF returns numbers", `IF(A1>1,A1*2,0)+1`, map[string]interface{}{"A1": 2.0}, 5.0},
+		{"IF without false branch", `IF(A1>1,1)`, map[string]interface{}{"A1": 0.0}, false},
+		{"IF with empty false branch", `IF(A1>1,1,)`, map[string]interface{}{"A1": 0.0}, 0.0},
+		{"IF with numerical comparison", `IF(10000 > 1000, "Hello World", "Hello India")`, nil, "Hello World"},
+		{"IF ignores error in other branch", `IF(TRUE,1,1/0)`, nil, 1.0},
+		{"IF evaluates only the chosen branch", `IF(TRUE,1,REGEXTEST("a","("))`, nil, 1.0},
+		{"IF guards a division", `IF(B1=0,0,A1/B1)`, map[string]interface{}{"A1": 2.0, "B1": 0.0}, 0.0},
+	}
+	var errCnt int
+	for _, tu := range tt {
+		eval, err := efp.Parse(strings.NewReader(tu.exp))
+		if err != nil {
+			t.Logf("Test Case: %v, Expression parse failed, Error: %v", tu.name, err.Error())
+			errCnt++
+			continue
+		}
+		v, err := eval(context.Background(), tu.in)
+		if err != nil {
+			t.Logf("Test Case: %v, Expression evaluation failed, Error: %v", tu.name, err.Error())
+			errCnt++
+			continue
+		}
+		if v != tu.out {
+			t.Logf("Test Case: %v, Expected: %v, Got: %v", tu.name, tu.out, v)
+			errCnt++
+		}
+	}
+	if errCnt > 0 {
+		t.Errorf("Failed %v of %v cases", errCnt, len(tt))
+	}
+}
+
 func BenchmarkParse(b *testing.B) {
 	tt := []struct {
 		name string
@@ -283,3 +346,79 @@ func BenchmarkParse(b *testing.B) {
 		b.Errorf("Failed %v of %v cases", errCnt, len(tt))
 	}
 }
+
+// benchmarkColumns are the inputs of the batch evaluation benchmarks
+func benchmarkColumns(rows int) efp.Columns {
+	qty := make([]float64, rows)
+	price := make([]float64, rows)
+	region := make([]string, rows)
+	for i := range qty {
+		qty[i] = float64(i % 17)
+		price[i] = float64(i%101) / 4
+		region[i] = []string{"North", "South", "East", "West"}[i%4]
+	}
+	return efp.Columns{"qty": qty, "price": price, "region": region}
+}
+
+const benchmarkFormula = `qty*price*(1+(region="North")/10)`
+
+// BenchmarkEvaluateRows evaluates row by row with a map per row, the way
+// callers did before EvaluateColumns
+func BenchmarkEvaluateRows(b *testing.B) {
+	cols := benchmarkColumns(10000)
+	eval, err := efp.Parse(strings.NewReader(benchmarkFormula))
+	if err != nil {
+		b.Fatal(err)
+	}
+	qty, price, region := cols["qty"].([]float64), cols["price"].([]float64), cols["region"].([]string)
+	out := make([]interface{}, len(qty))
+	c := context.Background()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for i := range qty {
+			v, err := eval(c, map[string]interface{}{"qty": qty[i], "price": price[i], "region": region[i]})
+			if err != nil {
+				b.Fatal(err)
+			}
+			out[i] = v
+		}
+	}
+}
+
+// BenchmarkEvaluateColumns reports the allocations left per batch: reading
+// the columns does not allocate but the numbers computed for each row are
+// still boxed by the formula engine
+func BenchmarkEvaluateColumns(b *testing.B) {
+	for _, workers := range []int{1, 4, -1} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			cols := benchmarkColumns(10000)
+			eval, err := efp.Parse(strings.NewReader(benchmarkFormula))
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				if _, err := efp.EvaluateColumns(context.Background(), eval, cols, efp.BatchOptions{Workers: workers}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkEvaluateNumbers(b *testing.B) {
+	cols := benchmarkColumns(10000)
+	eval, err := efp.Parse(strings.NewReader(benchmarkFormula))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if _, err := efp.EvaluateNumbers(context.Background(), eval, cols, efp.BatchOptions{Workers: 1}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,686 @@
+// Copyright © 2019 Praveen Tirumandyam praveen.tirumandyam@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package efp
+
+import (
+	"math"
+	"math/cmplx"
+	"strconv"
+	"strings"
+
+	"github.com/PaesslerAG/gval"
+)
+
+// digitBits is the number of bits each digit of a base holds. Numbers in
+// these bases have up to 10 digits, the top bit being the sign in two's
+// complement
+var digitBits = map[int]uint{2: 1, 8: 3, 16: 4}
+
+// BaseToDecimal implements Excel's BIN2DEC, OCT2DEC and HEX2DEC functions.
+// Numbers of 10 digits with the top bit set are negative in two's complement.
+// Returns ErrNum if s is not a number of base
+func BaseToDecimal(s string, base int) (float64, error) {
+	s = strings.TrimSpace(s)
+	if len(s) > 10 {
+		return 0, ErrNum
+	}
+	if s == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseInt(s, base, 64)
+	if err != nil || n < 0 {
+		return 0, ErrNum
+	}
+	bits := 10 * digitBits[base]
+	if n >= 1<<(bits-1) {
+		n -= 1 << bits
+	}
+	return float64(n), nil
+}
+
+// DecimalToBase implements Excel's DEC2BIN, DEC2OCT and DEC2HEX functions.
+// Negative numbers are written as 10 digits of two's complement. Positive
+// numbers are padded with zeros to places digits when places is not 0.
+// Returns ErrNum if n does not fit in 10 digits or in places
+func DecimalToBase(n float64, base int, places int) (string, error) {
+	bits := 10 * digitBits[base]
+	i := int64(n)
+	if n < 0 {
+		i = int64(math.Floor(n))
+	}
+	if i < -(1<<(bits-1)) || i >= 1<<(bits-1) || places < 0 || places > 10 {
+		return "", ErrNum
+	}
+	if i < 0 {
+		return strings.ToUpper(strconv.FormatInt(i+1<<bits, base)), nil
+	}
+	s := strings.ToUpper(strconv.FormatInt(i, base))
+	if places == 0 {
+		return s, nil
+	}
+	if len(s) > places {
+		return "", ErrNum
+	}
+	return strings.Repeat("0", places-len(s)) + s, nil
+}
+
+// ConvertBase implements Excel's functions converting between binary, octal
+// and hexadecimal like HEX2BIN
+func ConvertBase(s string, from, to int, places int) (string, error) {
+	n, err := BaseToDecimal(s, from)
+	if err != nil {
+		return "", err
+	}
+	return DecimalToBase(n, to, places)
+}
+
+// baseFunctions registers the functions converting between the bases like
+// DEC2BIN and HEX2OCT
+func baseFunctions() gval.Language {
+	names := map[int]string{2: "BIN", 8: "OCT", 10: "DEC", 16: "HEX"}
+	var langs []gval.Language
+	for from, f := range names {
+		for to, t := range names {
+			from, to := from, to
+			switch {
+			case from == to:
+				continue
+			case from == 10:
+				langs = append(langs, function(f+"2"+t, func(n float64, places ...float64) (string, error) {
+					return DecimalToBase(n, to, basePlaces(places))
+				}))
+			case to == 10:
+				langs = append(langs, function(f+"2"+t, func(v interface{}) (float64, error) {
+					return BaseToDecimal(baseText(v), from)
+				}))
+			default:
+				langs = append(langs, function(f+"2"+t, func(v interface{}, places ...float64) (string, error) {
+					return ConvertBase(baseText(v), from, to, basePlaces(places))
+				}))
+			}
+		}
+	}
+	return gval.NewLanguage(langs...)
+}
+
+// baseText returns the digits of a number in some base given as v. Numbers
+// like 1001 stand for their digits
+func baseText(v interface{}) string {
+	if n, ok := asNumber(v); ok {
+		return strconv.FormatFloat(n, 'f', -1, 64)
+	}
+	return toString(v)
+}
+
+// basePlaces returns the optional places argument of the base conversions
+func basePlaces(places []float64) int {
+	if len(places) == 0 {
+		return 0
+	}
+	if places[0] < 1 {
+		// Explicit places must be at least 1
+		return -1
+	}
+	return int(places[0])
+}
+
+// maxBitwise is the limit of the numbers Excel's bitwise functions accept
+const maxBitwise = 1 << 48
+
+// bitwiseOperand returns n as an integer for the bitwise functions. Returns
+// ErrNum if n is negative, not whole or too large
+func bitwiseOperand(n float64) (uint64, error) {
+	if n < 0 || n >= maxBitwise || n != math.Trunc(n) {
+		return 0, ErrNum
+	}
+	return uint64(n), nil
+}
+
+// Bitwise implements Excel's BITAND, BITOR and BITXOR functions applying op
+// to a and b
+func Bitwise(a, b float64, op func(a, b uint64) uint64) (float64, error) {
+	x, err := bitwiseOperand(a)
+	if err != nil {
+		return 0, err
+	}
+	y, err := bitwiseOperand(b)
+	if err != nil {
+		return 0, err
+	}
+	return float64(op(x, y)), nil
+}
+
+// BitShift implements Excel's BITLSHIFT function. Negative shift moves the
+// bits right as BITRSHIFT does. Returns ErrNum if the result is too large
+func BitShift(n, shift float64) (float64, error) {
+	x, err := bitwiseOperand(n)
+	if err != nil {
+		return 0, err
+	}
+	if math.Abs(shift) > 53 {
+		return 0, ErrNum
+	}
+	s := int(shift)
+	if s < 0 {
+		return float64(x >> uint(-s)), nil
+	}
+	r := float64(x) * math.Pow(2, float64(s))
+	if r >= maxBitwise {
+		return 0, ErrNum
+	}
+	return r, nil
+}
+
+// Delta implements Excel's DELTA function
+func Delta(a, b float64) float64 {
+	if a == b {
+		return 1
+	}
+	return 0
+}
+
+// GeStep implements Excel's GESTEP function
+func GeStep(n, step float64) float64 {
+	if n >= step {
+		return 1
+	}
+	return 0
+}
+
+// unit is a unit of measure CONVERT knows. Values are converted to the base
+// unit of the quantity by multiplying with factor; temperatures are converted
+// to kelvin by toBase and back by fromBase instead
+type unit struct {
+	quantity string
+	factor   float64
+	// prefixed is set for units taking metric prefixes like the k of km.
+	// power is 2 or 3 for areas and volumes like m2 whose prefix is squared
+	// or cubed
+	prefixed bool
+	power    int
+	binary   bool
+	toBase   func(v float64) float64
+	fromBase func(v float64) float64
+}
+
+const (
+	inch = 0.0254
+	foot = 12 * inch
+	yard = 3 * foot
+	mile = 1760 * yard
+	pica = inch / 6
+	// point is the Picapt unit, 1/72 inch
+	point     = inch / 72
+	nautMile  = 1852.0
+	lightYear = 9460730472580800.0
+	parsec    = 3.08567758128155e16
+	usGallon  = 231 * inch * inch * inch
+	ukGallon  = 4.54609e-3
+	pound     = 453.59237
+	gravity   = 9.80665
+)
+
+func units(quantity string, factor float64, prefixed bool, names ...string) map[string]unit {
+	m := make(map[string]unit, len(names))
+	for _, n := range names {
+		m[n] = unit{quantity: quantity, factor: factor, prefixed: prefixed}
+	}
+	return m
+}
+
+func temperature(toKelvin, fromKelvin func(v float64) float64, prefixed bool, names ...string) map[string]unit {
+	m := make(map[string]unit, len(names))
+	for _, n := range names {
+		m[n] = unit{quantity: "temperature", factor: 1, prefixed: prefixed, toBase: toKelvin, fromBase: fromKelvin}
+	}
+	return m
+}
+
+// powerUnits returns the square or cube of length units
+func powerUnits(quantity string, power int, lengths map[string]float64, prefixed map[string]bool) map[string]unit {
+	m := make(map[string]unit, len(lengths))
+	for n, f := range lengths {
+		m[n+strconv.Itoa(power)] = unit{quantity: quantity, factor: math.Pow(f, float64(power)), prefixed: prefixed[n], power: power}
+	}
+	return m
+}
+
+// measures holds the units of CONVERT by name. Units of a quantity have
+// factors relative to the same base unit: grams, meters, seconds, pascals,
+// newtons, joules, watts, teslas, kelvin, cubic meters, square meters, bits
+// and meters per second
+var measures = mergeUnits(
+	units("mass", 1, true, "g"),
+	units("mass", 14593.902937206364, false, "sg"),
+	units("mass", pound, false, "lbm"),
+	units("mass", 1.66053906660e-24, true, "u"),
+	units("mass", pound/16, false, "ozm"),
+	units("mass", pound/7000, false, "grain"),
+	units("mass", 100*pound, false, "cwt", "shweight"),
+	units("mass", 112*pound, false, "uk_cwt", "lcwt", "hweight"),
+	units("mass", 14*pound, false, "stone"),
+	units("mass", 2000*pound, false, "ton"),
+	units("mass", 2240*pound, false, "uk_ton", "LTON", "brton"),
+
+	units("distance", 1, true, "m"),
+	units("distance", mile, false, "mi"),
+	units("distance", nautMile, false, "Nmi"),
+	units("distance", inch, false, "in"),
+	units("distance", foot, false, "ft"),
+	units("distance", yard, false, "yd"),
+	units("distance", 1e-10, true, "ang"),
+	units("distance", 45*inch, false, "ell"),
+	units("distance", lightYear, true, "ly"),
+	units("distance", parsec, false, "parsec", "pc"),
+	units("distance", point, false, "Picapt", "Pica"),
+	units("distance", pica, false, "pica"),
+	units("distance", 5280*1200.0/3937, false, "survey_mi"),
+
+	units("time", 365.25*86400, false, "yr"),
+	units("time", 86400, false, "day", "d"),
+	units("time", 3600, false, "hr"),
+	units("time", 60, false, "mn", "min"),
+	units("time", 1, true, "sec", "s"),
+
+	units("pressure", 1, true, "Pa", "p"),
+	units("pressure", 101325, true, "atm", "at"),
+	units("pressure", 133.322, true, "mmHg"),
+	units("pressure", pound*gravity/(inch*inch)/1000, false, "psi"),
+	units("pressure", 101325.0/760, false, "Torr"),
+
+	units("force", 1, true, "N"),
+	units("force", 1e-5, true, "dyn", "dy"),
+	units("force", pound*gravity/1000, false, "lbf"),
+	units("force", gravity/1000, true, "pond"),
+
+	units("energy", 1, true, "J"),
+	units("energy", 1e-7, true, "e"),
+	units("energy", 4.184, true, "c"),
+	units("energy", 4.1868, true, "cal"),
+	units("energy", 1.602176634e-19, true, "eV", "ev"),
+	units("energy", 2684519.5376961677, false, "HPh", "hh"),
+	units("energy", 3600, true, "Wh", "wh"),
+	units("energy", pound*gravity/1000*foot, false, "flb"),
+	units("energy", 1055.05585262, false, "BTU", "btu"),
+
+	units("power", 745.69987158227, false, "HP", "h"),
+	units("power", 735.49875, false, "PS"),
+	units("power", 1, true, "W", "w"),
+
+	units("magnetism", 1, true, "T"),
+	units("magnetism", 1e-4, true, "ga"),
+
+	temperature(func(v float64) float64 { return v + 273.15 }, func(v float64) float64 { return v - 273.15 }, false, "C", "cel"),
+	temperature(func(v float64) float64 { return (v-32)*5/9 + 273.15 }, func(v float64) float64 { return (v-273.15)*9/5 + 32 }, false, "F", "fah"),
+	temperature(func(v float64) float64 { return v }, func(v float64) float64 { return v }, true, "K", "kel"),
+	temperature(func(v float64) float64 { return v * 5 / 9 }, func(v float64) float64 { return v * 9 / 5 }, false, "Rank"),
+	temperature(func(v float64) float64 { return v*1.25 + 273.15 }, func(v float64) float64 { return (v - 273.15) * 0.8 }, false, "Reau"),
+
+	units("volume", usGallon/768, false, "tsp"),
+	units("volume", 5e-6, false, "tspm"),
+	units("volume", usGallon/256, false, "tbs"),
+	units("volume", usGallon/128, false, "oz"),
+	units("volume", usGallon/16, false, "cup"),
+	units("volume", usGallon/8, false, "pt", "us_pt"),
+	units("volume", ukGallon/8, false, "uk_pt"),
+	units("volume", usGallon/4, false, "qt"),
+	units("volume", ukGallon/4, false, "uk_qt"),
+	units("volume", usGallon, false, "gal"),
+	units("volume", ukGallon, false, "uk_gal"),
+	units("volume", 1e-3, true, "l", "L", "lt"),
+	units("volume", 42*usGallon, false, "barrel"),
+	units("volume", 0.03523907016688, false, "bushel"),
+	units("volume", 100*foot*foot*foot, false, "GRT", "regton"),
+	units("volume", 40*foot*foot*foot, false, "MTON"),
+	powerUnits("volume", 3, map[string]float64{
+		"m": 1, "ang": 1e-10, "ft": foot, "in": inch, "yd": yard, "mi": mile,
+		"Nmi": nautMile, "ly": lightYear, "Picapt": point, "Pica": point,
+	}, map[string]bool{"m": true, "ang": true}),
+
+	units("area", 1e4, false, "ha"),
+	units("area", 100, true, "ar"),
+	units("area", 4046.8564224, false, "uk_acre"),
+	units("area", 4046.872609874252, false, "us_acre"),
+	units("area", 2500, false, "Morgen"),
+	powerUnits("area", 2, map[string]float64{
+		"m": 1, "ang": 1e-10, "ft": foot, "in": inch, "yd": yard, "mi": mile,
+		"Nmi": nautMile, "ly": lightYear, "Picapt": point, "Pica": point,
+	}, map[string]bool{"m": true, "ang": true}),
+
+	map[string]unit{
+		"bit":  {quantity: "information", factor: 1, prefixed: true, binary: true},
+		"byte": {quantity: "information", factor: 8, prefixed: true, binary: true},
+	},
+
+	units("speed", 1, true, "m/s", "m/sec"),
+	units("speed", 1.0/3600, true, "m/h", "m/hr"),
+	units("speed", mile/3600, false, "mph"),
+	units("speed", nautMile/3600, false, "kn"),
+	units("speed", 6080*foot/3600, false, "admkn"),
+)
+
+func mergeUnits(all ...map[string]unit) map[string]unit {
+	m := make(map[string]unit)
+	for _, u := range all {
+		for n, v := range u {
+			m[n] = v
+		}
+	}
+	return m
+}
+
+// metricPrefixes and binaryPrefixes are the prefixes CONVERT accepts before
+// the units taking them
+var (
+	metricPrefixes = map[string]float64{
+		"Y": 1e24, "Z": 1e21, "E": 1e18, "P": 1e15, "T": 1e12, "G": 1e9, "M": 1e6,
+		"k": 1e3, "h": 1e2, "da": 1e1, "e": 1e1, "d": 1e-1, "c": 1e-2, "m": 1e-3,
+		"u": 1e-6, "n": 1e-9, "p": 1e-12, "f": 1e-15, "a": 1e-18, "z": 1e-21, "y": 1e-24,
+	}
+	binaryPrefixes = map[string]float64{
+		"Ki": 1 << 10, "Mi": 1 << 20, "Gi": 1 << 30, "Ti": 1 << 40,
+		"Pi": 1 << 50, "Ei": 1 << 60, "Zi": math.Pow(2, 70), "Yi": math.Pow(2, 80),
+	}
+)
+
+// lookupUnit finds unit name, possibly prefixed, for CONVERT
+func lookupUnit(name string) (unit, bool) {
+	if u, ok := measures[name]; ok {
+		return u, true
+	}
+	for _, n := range []int{2, 1} {
+		if len(name) <= n {
+			continue
+		}
+		u, ok := measures[name[n:]]
+		if !ok || !u.prefixed {
+			continue
+		}
+		f, ok := metricPrefixes[name[:n]]
+		if u.binary {
+			if bf, bok := binaryPrefixes[name[:n]]; bok {
+				f, ok = bf, true
+			}
+		}
+		if !ok {
+			continue
+		}
+		if u.power > 0 {
+			f = math.Pow(f, float64(u.power))
+		}
+		u.factor *= f
+		return u, true
+	}
+	return unit{}, false
+}
+
+// Convert implements Excel's CONVERT function. Returns ErrNA for unknown
+// units and units of different quantities
+func Convert(n float64, from, to string) (float64, error) {
+	f, ok := lookupUnit(from)
+	if !ok {
+		return 0, ErrNA
+	}
+	t, ok := lookupUnit(to)
+	if !ok || f.quantity != t.quantity {
+		return 0, ErrNA
+	}
+	if f.toBase != nil {
+		return t.fromBase(f.toBase(n*f.factor) / t.factor), nil
+	}
+	return n * f.factor / t.factor, nil
+}
+
+// parseComplex reads a complex number in Excel's text form like 3+4i, -2.5j
+// or i. Numbers are complex numbers without imaginary part. Returns the
+// number and its suffix, 0 when it has no imaginary part. Returns ErrNum if
+// v is not a complex number
+func parseComplex(v interface{}) (complex128, byte, error) {
+	switch val := v.(type) {
+	case nil:
+		return 0, 0, nil
+	case ErrorValue:
+		return 0, 0, val
+	case bool:
+		return 0, 0, ErrValue
+	}
+	if n, ok := asNumber(v); ok {
+		return complex(n, 0), 0, nil
+	}
+	s := strings.TrimSpace(toString(v))
+	if s == "" {
+		return 0, 0, nil
+	}
+	if n, err := strconv.ParseFloat(s, 64); err == nil {
+		return complex(n, 0), 0, nil
+	}
+	suffix := s[len(s)-1]
+	if suffix != 'i' && suffix != 'j' {
+		return 0, 0, ErrNum
+	}
+	body := s[:len(s)-1]
+	// The imaginary part starts at the last sign not following an exponent
+	split := 0
+	for i := len(body) - 1; i > 0; i-- {
+		if (body[i] == '+' || body[i] == '-') && body[i-1] != 'e' && body[i-1] != 'E' {
+			split = i
+			break
+		}
+	}
+	var re float64
+	if split > 0 {
+		var err error
+		if re, err = strconv.ParseFloat(body[:split], 64); err != nil {
+			return 0, 0, ErrNum
+		}
+	}
+	im, err := imaginaryPart(body[split:])
+	if err != nil {
+		return 0, 0, err
+	}
+	return complex(re, im), suffix, nil
+}
+
+func imaginaryPart(s string) (float64, error) {
+	switch s {
+	case "", "+":
+		return 1, nil
+	case "-":
+		return -1, nil
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, ErrNum
+	}
+	return n, nil
+}
+
+// formatComplex writes z in Excel's text form with suffix i or j
+func formatComplex(z complex128, suffix byte) (string, error) {
+	re, im := real(z), imag(z)
+	if math.IsNaN(re) || math.IsNaN(im) || math.IsInf(re, 0) || math.IsInf(im, 0) {
+		return "", ErrNum
+	}
+	if suffix == 0 {
+		suffix = 'i'
+	}
+	num := func(f float64) string { return strconv.FormatFloat(f, 'G', 15, 64) }
+	if im == 0 {
+		return num(re), nil
+	}
+	var sb strings.Builder
+	if re != 0 {
+		sb.WriteString(num(re))
+		if im > 0 {
+			sb.WriteByte('+')
+		}
+	}
+	switch im {
+	case 1:
+	case -1:
+		sb.WriteByte('-')
+	default:
+		sb.WriteString(num(im))
+	}
+	sb.WriteByte(suffix)
+	return sb.String(), nil
+}
+
+// Complex implements Excel's COMPLEX function. Suffix is "i", "j" or empty
+// for i
+func Complex(re, im float64, suffix string) (string, error) {
+	switch suffix {
+	case "", "i", "j":
+	default:
+		return "", ErrValue
+	}
+	var s byte
+	if suffix != "" {
+		s = suffix[0]
+	}
+	return formatComplex(complex(re, im), s)
+}
+
+// complexArgs parses the complex numbers passed to an IM function. Returns
+// ErrValue if they mix the suffixes i and j
+func complexArgs(args []interface{}) ([]complex128, byte, error) {
+	zs := make([]complex128, 0, len(args))
+	var suffix byte
+	for _, a := range args {
+		vals := []interface{}{a}
+		if arr, ok := a.(Array); ok {
+			vals = vals[:0]
+			for _, row := range arr {
+				vals = append(vals, row...)
+			}
+		}
+		for _, v := range vals {
+			z, s, err := parseComplex(v)
+			if err != nil {
+				return nil, 0, err
+			}
+			if s != 0 && suffix != 0 && s != suffix {
+				return nil, 0, ErrValue
+			}
+			if s != 0 {
+				suffix = s
+			}
+			zs = append(zs, z)
+		}
+	}
+	return zs, suffix, nil
+}
+
+// imFunction returns the implementation of an IM function computing a
+// complex number from any number of complex numbers
+func imFunction(fn func(zs []complex128) complex128) func(args ...interface{}) (string, error) {
+	return func(args ...interface{}) (string, error) {
+		zs, suffix, err := complexArgs(args)
+		if err != nil {
+			return "", err
+		}
+		return formatComplex(fn(zs), suffix)
+	}
+}
+
+// imBinary returns the implementation of an IM function of two complex
+// numbers
+func imBinary(fn func(a, b complex128) (complex128, error)) func(a, b interface{}) (string, error) {
+	return func(a, b interface{}) (string, error) {
+		zs, suffix, err := complexArgs([]interface{}{a, b})
+		if err != nil {
+			return "", err
+		}
+		if len(zs) != 2 {
+			return "", ErrValue
+		}
+		z, err := fn(zs[0], zs[1])
+		if err != nil {
+			return "", err
+		}
+		return formatComplex(z, suffix)
+	}
+}
+
+// imUnary returns the implementation of an IM function of a single complex
+// number. Numbers outside domain give ErrNum
+func imUnary(fn func(z complex128) complex128, domain func(z complex128) bool) func(v interface{}) (string, error) {
+	return func(v interface{}) (string, error) {
+		z, suffix, err := parseComplex(v)
+		if err != nil {
+			return "", err
+		}
+		if domain != nil && !domain(z) {
+			return "", ErrNum
+		}
+		return formatComplex(fn(z), suffix)
+	}
+}
+
+func nonZero(z complex128) bool {
+	return z != 0
+}
+
+// imReal returns the implementation of an IM function with a real result
+func imReal(fn func(z complex128) (float64, error)) func(v interface{}) (float64, error) {
+	return func(v interface{}) (float64, error) {
+		z, _, err := parseComplex(v)
+		if err != nil {
+			return 0, err
+		}
+		return fn(z)
+	}
+}
+
+// imSum, imSub, imProduct and imDiv implement the IM functions combining
+// complex numbers
+func imSum(zs []complex128) complex128 {
+	var r complex128
+	for _, z := range zs {
+		r += z
+	}
+	return r
+}
+
+func imSub(a, b complex128) (complex128, error) {
+	return a - b, nil
+}
+
+func imProduct(zs []complex128) complex128 {
+	r := complex(1, 0)
+	for _, z := range zs {
+		r *= z
+	}
+	return r
+}
+
+func imDiv(a, b complex128) (complex128, error) {
+	if b == 0 {
+		return 0, ErrNum
+	}
+	return a / b, nil
+}
+
+// imPower raises a complex number to a real power
+func imPower(v interface{}, n float64) (string, error) {
+	z, suffix, err := parseComplex(v)
+	if err != nil {
+		return "", err
+	}
+	if z == 0 && n <= 0 {
+		return "", ErrNum
+	}
+	return formatComplex(cmplx.Pow(z, complex(n, 0)), suffix)
+}
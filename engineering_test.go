@@ -0,0 +1,103 @@
+package efp
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+func TestEngineeringFunctions(t *testing.T) {
+	tt := []struct {
+		exp string
+		out interface{}
+	}{
+		{`DEC2BIN(9, 4)`, "1001"},
+		{`DEC2BIN(-100)`, "1110011100"},
+		{`DEC2BIN(512)`, ErrNum},
+		{`DEC2BIN(9, 2)`, ErrNum},
+		{`DEC2HEX(-54)`, "FFFFFFFFCA"},
+		{`DEC2OCT(58, 3)`, "072"},
+		{`BIN2DEC("1111111111")`, -1.0},
+		{`BIN2DEC(1100100)`, 100.0},
+		{`BIN2DEC("12")`, ErrNum},
+		{`HEX2DEC("FFFFFFFF5B")`, -165.0},
+		{`HEX2BIN("FFFFFFFE00")`, "1000000000"},
+		{`HEX2BIN("200")`, ErrNum},
+		{`OCT2HEX("7777777533")`, "FFFFFFFF5B"},
+		{`BIN2OCT("1001", 3)`, "011"},
+		{`BITAND(13, 25)`, 9.0},
+		{`BITOR(23, 10)`, 31.0},
+		{`BITXOR(5, 3)`, 6.0},
+		{`BITLSHIFT(4, 2)`, 16.0},
+		{`BITRSHIFT(13, 2)`, 3.0},
+		{`BITLSHIFT(4, -1)`, 2.0},
+		{`BITAND(-1, 3)`, ErrNum},
+		{`BITAND(1.5, 3)`, ErrNum},
+		{`CONVERT(1, "lbm", "kg")`, 0.45359237},
+		{`CONVERT(68, "F", "C")`, 20.0},
+		{`CONVERT(2.5, "ft", "sec")`, ErrNA},
+		{`CONVERT(1, "km", "m")`, 1000.0},
+		{`CONVERT(1, "km2", "m2")`, 1e6},
+		{`CONVERT(1, "kibyte", "bit")`, ErrNA},
+		{`CONVERT(1, "Kibyte", "bit")`, 8192.0},
+		{`CONVERT(1, "kft", "m")`, ErrNA},
+		{`CONVERT(1, "mi", "yd")`, 1760.0},
+		{`CONVERT(1, "gal", "l")`, 3.785411784},
+		{`DELTA(5, 5)`, 1.0},
+		{`DELTA(0.5)`, 0.0},
+		{`GESTEP(5, 4)`, 1.0},
+		{`GESTEP(-1)`, 0.0},
+		{`COMPLEX(3, 4)`, "3+4i"},
+		{`COMPLEX(3, -1, "j")`, "3-j"},
+		{`COMPLEX(0, 1)`, "i"},
+		{`COMPLEX(1, 1, "k")`, ErrValue},
+		{`IMABS("3+4i")`, 5.0},
+		{`IMREAL("6-9i")`, 6.0},
+		{`IMAGINARY("-i")`, -1.0},
+		{`IMAGINARY("4")`, 0.0},
+		{`IMCONJUGATE("3+4i")`, "3-4i"},
+		{`IMSUM("3+4i", "5-3i")`, "8+i"},
+		{`IMSUB("13+4j", "5+3j")`, "8+j"},
+		{`IMSUM("1+i", "1+j")`, ErrValue},
+		{`IMPRODUCT("3+4i", "5-3i")`, "27+11i"},
+		{`IMPRODUCT("1+2i", 30)`, "30+60i"},
+		{`IMDIV("-238+240i", "10+24i")`, "5+12i"},
+		{`IMDIV("1", "0")`, ErrNum},
+		{`IMSQRT("-4")`, "2i"},
+		{`IMPOWER("i", 2)`, "-1+1.22464679914735E-16i"},
+		{`IMLN(0)`, ErrNum},
+		{`IMEXP(0)`, "1"},
+		{`IMREAL("1.5e2-3e-1i")`, 150.0},
+		{`IMREAL("3+4x")`, ErrNum},
+		{`IMARGUMENT("0")`, ErrDiv0},
+	}
+	var errCnt int
+	for _, tu := range tt {
+		eval, err := parse(tu.exp, 0)
+		if err != nil {
+			t.Logf("Test: %v, Parse Error: %v", tu.exp, err)
+			errCnt++
+			continue
+		}
+		out, err := eval(context.Background(), nil)
+		if e, ok := err.(ErrorValue); ok {
+			out = e
+		} else if err != nil {
+			t.Logf("Test: %v, Error: %v", tu.exp, err)
+			errCnt++
+			continue
+		}
+		if f, ok := out.(float64); ok {
+			if want, ok := tu.out.(float64); ok && math.Abs(f-want) <= 1e-9*math.Max(1, math.Abs(want)) {
+				continue
+			}
+		}
+		if out != tu.out {
+			t.Logf("Test: %v, Expected: %v, Got: %v", tu.exp, tu.out, out)
+			errCnt++
+		}
+	}
+	if errCnt > 0 {
+		t.Errorf("Failed %v of %v test cases", errCnt, len(tt))
+	}
+}
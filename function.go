@@ -0,0 +1,383 @@
+// Copyright © 2019 Praveen Tirumandyam praveen.tirumandyam@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package efp
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"text/scanner"
+
+	"github.com/PaesslerAG/gval"
+)
+
+var (
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+	arrayType   = reflect.TypeOf(Array(nil))
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	lazyType    = reflect.TypeOf(lazy(nil))
+
+	// builtins holds every function registered with function by name
+	builtins = make(map[string]*builtin)
+)
+
+// Functions returns the names of the Excel functions formulas can call in
+// alphabetical order
+func Functions() []string {
+	names := make([]string, 0, len(builtins))
+	for name := range builtins {
+		if strings.HasPrefix(name, "_") {
+			// Reference forms, see referenceForms
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// lazy is the type of parameters evaluated only when the function calls
+// them, like the branches of IF
+type lazy func() (interface{}, error)
+
+// builtin is an Excel function implemented by a Go function
+type builtin struct {
+	name string
+	fn   reflect.Value
+	// ctx is set when the first parameter of fn is a context.Context
+	ctx bool
+	// volatile is set for functions whose result changes without their
+	// arguments changing, like NOW and RAND
+	volatile bool
+	// param is set for functions resolving references with resolveIn
+	param bool
+}
+
+// function registers fn as the Excel function name. Unlike gval.Function the
+// arguments are converted to the parameter types of fn the way Excel converts
+// them: empty cells become the zero value, and numbers, text and booleans are
+// converted to each other. Single values passed for Array parameters are
+// wrapped in a 1x1 Array. When the first parameter of fn is a
+// context.Context it receives the context of the evaluation. Arguments for
+// lazy parameters are only evaluated when fn calls them.
+//
+// Calls are parsed by parseIdent rather than by gval so the returned
+// Language only groups the function with the others of its kind
+func function(name string, fn interface{}) gval.Language {
+	fv := reflect.ValueOf(fn)
+	ft := fv.Type()
+	builtins[name] = &builtin{
+		name: name,
+		fn:   fv,
+		ctx:  ft.NumIn() > 0 && ft.In(0) == contextType,
+	}
+	return gval.NewLanguage()
+}
+
+// volatileFunction registers fn like function and marks it volatile. Cells
+// calling a volatile function are recalculated after the cells whose
+// dependencies are known, see RecalculateParallel
+func volatileFunction(name string, fn interface{}) gval.Language {
+	l := function(name, fn)
+	builtins[name].volatile = true
+	return l
+}
+
+// referenceFunction registers fn like volatileFunction for functions which
+// compute references and resolve them with resolveIn, like OFFSET. The cells
+// they refer to are only known once evaluated so they are volatile
+func referenceFunction(name string, fn interface{}) gval.Language {
+	l := volatileFunction(name, fn)
+	builtins[name].param = true
+	return l
+}
+
+// parameterType returns the type of the parameter of function name given
+// argument arg, nil for unknown functions and surplus arguments
+func parameterType(name string, arg int) reflect.Type {
+	b, ok := builtins[name]
+	if !ok {
+		return nil
+	}
+	ft := b.fn.Type()
+	if b.ctx {
+		arg++
+	}
+	switch {
+	case ft.IsVariadic() && arg >= ft.NumIn()-1:
+		return ft.In(ft.NumIn() - 1).Elem()
+	case arg < ft.NumIn():
+		return ft.In(arg)
+	}
+	return nil
+}
+
+// isListParameter returns true if argument arg of function name is given
+// for its variadic parameter
+func isListParameter(name string, arg int) bool {
+	b, ok := builtins[name]
+	if !ok {
+		return false
+	}
+	ft := b.fn.Type()
+	if b.ctx {
+		arg++
+	}
+	return ft.IsVariadic() && arg >= ft.NumIn()-1
+}
+
+type paramKey struct{}
+
+// resolveIn returns the value of ref for functions registered with
+// referenceFunction
+func resolveIn(c context.Context, ref Ref) (interface{}, error) {
+	return resolveRef(c, c.Value(paramKey{}), ref)
+}
+
+// evaluable returns the Evaluable calling b with the values of args. Each
+// call is a step of the evaluation and its result must be within limits
+func (b *builtin) evaluable(args []gval.Evaluable) gval.Evaluable {
+	return func(c context.Context, v interface{}) (interface{}, error) {
+		if err := step(c); err != nil {
+			return nil, err
+		}
+		vals := make([]interface{}, len(args))
+		for i, arg := range args {
+			if parameterType(b.name, i) == lazyType {
+				arg := arg
+				vals[i] = lazy(func() (interface{}, error) { return arg(c, v) })
+				continue
+			}
+			val, err := arg(c, v)
+			if err != nil {
+				return nil, err
+			}
+			vals[i] = val
+		}
+		if b.param {
+			if c == nil {
+				c = context.Background()
+			}
+			c = context.WithValue(c, paramKey{}, v)
+		}
+		r, err := b.call(c, vals)
+		if err != nil {
+			return nil, err
+		}
+		return r, checkValue(c, r)
+	}
+}
+
+func (b *builtin) call(c context.Context, args []interface{}) (interface{}, error) {
+	ft := b.fn.Type()
+	var in []reflect.Value
+	if b.ctx {
+		if c == nil {
+			c = context.Background()
+		}
+		in = append(in, reflect.ValueOf(c))
+	}
+	rest, err := callArguments(ft, len(in), args)
+	if err != nil {
+		return nil, err
+	}
+	out := b.fn.Call(append(in, rest...))
+	if ft.NumOut() > 0 && ft.Out(ft.NumOut()-1) == errorType {
+		if e := out[len(out)-1]; !e.IsNil() {
+			return nil, e.Interface().(error)
+		}
+		out = out[:len(out)-1]
+	}
+	switch len(out) {
+	case 0:
+		return nil, nil
+	case 1:
+		return out[0].Interface(), nil
+	}
+	r := make([]interface{}, len(out))
+	for i, o := range out {
+		r[i] = o.Interface()
+	}
+	return r, nil
+}
+
+// parseIdent replaces the identifier handling of gval. Registered functions
+// are called through builtin so they see the context of the evaluation;
+// calls to unknown functions evaluate to #NAME? as in Excel. Other
+// identifiers are variables selected with selectVariable
+func parseIdent(c context.Context, p *gval.Parser) (string, func() (gval.Evaluable, error), error) {
+	token := p.TokenText()
+	return token, func() (gval.Evaluable, error) {
+		b, known := builtins[token]
+		if p.Scan() == '(' {
+			args, err := parseArguments(c, p)
+			if err != nil {
+				return nil, err
+			}
+			if !known {
+				return p.Const(ErrName), nil
+			}
+			return b.evaluable(args), nil
+		}
+		p.Camouflage("variable", '(', '.', '[')
+		if known {
+			return b.evaluable(nil), nil
+		}
+		keys := []gval.Evaluable{p.Const(token)}
+		for {
+			switch p.Scan() {
+			case '.':
+				if p.Scan() != scanner.Ident {
+					return nil, p.Expected("field", scanner.Ident)
+				}
+				keys = append(keys, p.Const(p.TokenText()))
+			case '[':
+				key, err := p.ParseExpression(c)
+				if err != nil {
+					return nil, err
+				}
+				if p.Scan() != ']' {
+					return nil, p.Expected("array key", ']')
+				}
+				keys = append(keys, key)
+			default:
+				p.Camouflage("variable", '.', '[')
+				return p.Var(keys...), nil
+			}
+		}
+	}, nil
+}
+
+func parseArguments(c context.Context, p *gval.Parser) ([]gval.Evaluable, error) {
+	var args []gval.Evaluable
+	if p.Scan() == ')' {
+		return args, nil
+	}
+	p.Camouflage("scan arguments", ')')
+	for {
+		// Omitted arguments like the second of TEXTSPLIT(A1,,";") are empty
+		arg := p.Const(nil)
+		r := p.Scan()
+		if r != ',' && r != ')' {
+			p.Camouflage("argument")
+			var err error
+			if arg, err = p.ParseExpression(c); err != nil {
+				return nil, err
+			}
+			r = p.Scan()
+		}
+		args = append(args, arg)
+		switch r {
+		case ')':
+			return args, nil
+		case ',':
+		default:
+			return nil, p.Expected("arguments", ')', ',')
+		}
+	}
+}
+
+// callArguments converts args to the parameters of function type t starting
+// at parameter first
+func callArguments(t reflect.Type, first int, args []interface{}) ([]reflect.Value, error) {
+	variadic := t.IsVariadic()
+	numIn := t.NumIn() - first
+	if (!variadic && len(args) != numIn) || (variadic && len(args) < numIn-1) {
+		return nil, fmt.Errorf("invalid number of parameters")
+	}
+	in := make([]reflect.Value, len(args))
+	for i, arg := range args {
+		var pt reflect.Type
+		if variadic && i >= numIn-1 {
+			pt = t.In(first + numIn - 1).Elem()
+		} else {
+			pt = t.In(first + i)
+		}
+		v, err := convertArgument(arg, pt)
+		if err != nil {
+			return nil, err
+		}
+		in[i] = v
+	}
+	return in, nil
+}
+
+// convertArgument converts a formula value to type t
+func convertArgument(arg interface{}, t reflect.Type) (reflect.Value, error) {
+	if _, ok := arg.(Areas); ok && t.Kind() != reflect.Interface {
+		return reflect.Value{}, ErrValue
+	}
+	switch {
+	case t == arrayType:
+		return reflect.ValueOf(toArray(arg)), nil
+	case t.Kind() == reflect.Interface:
+		if arg == nil {
+			return reflect.Zero(t), nil
+		}
+		return reflect.ValueOf(arg), nil
+	case t.Kind() == reflect.String:
+		if e, ok := arg.(ErrorValue); ok {
+			return reflect.Value{}, e
+		}
+		return reflect.ValueOf(toString(arg)).Convert(t), nil
+	case t.Kind() == reflect.Bool:
+		b, err := toBool(arg)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		return reflect.ValueOf(b).Convert(t), nil
+	case t.Kind() == reflect.Float64 || t.Kind() == reflect.Int:
+		n, err := toNumber(arg)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		return reflect.ValueOf(n).Convert(t), nil
+	}
+	if arg == nil {
+		return reflect.Zero(t), nil
+	}
+	v := reflect.ValueOf(arg)
+	if !v.Type().AssignableTo(t) {
+		return reflect.Value{}, fmt.Errorf("expected type %s but got %T", t, arg)
+	}
+	return v, nil
+}
+
+// toBool converts value to boolean the way Excel does for logical functions
+func toBool(v interface{}) (bool, error) {
+	switch b := v.(type) {
+	case nil:
+		return false, nil
+	case bool:
+		return b, nil
+	case string:
+		switch {
+		case strings.EqualFold(b, "TRUE"):
+			return true, nil
+		case strings.EqualFold(b, "FALSE"):
+			return false, nil
+		}
+		return false, ErrValue
+	case ErrorValue:
+		return false, b
+	}
+	n, err := toNumber(v)
+	if err != nil {
+		return false, err
+	}
+	return n != 0, nil
+}
@@ -15,7 +15,9 @@
 package efp
 
 import (
+	"regexp"
 	"strings"
+	"sync"
 	"text/scanner"
 	"unicode"
 )
@@ -111,6 +113,150 @@ func Proper(s string) string {
 	return sb.String()
 }
 
+// regexCacheSize bounds the patterns kept compiled by compileRegex
+const regexCacheSize = 256
+
+var regexCache = struct {
+	sync.Mutex
+	m map[string]*regexp.Regexp
+}{m: make(map[string]*regexp.Regexp)}
+
+// compileRegex returns pattern compiled, ignoring case unless caseSensitive.
+// Patterns are compiled once and kept for later calls; the cache is emptied
+// when it is full. Returns ErrValue for invalid patterns
+func compileRegex(pattern string, caseSensitive bool) (*regexp.Regexp, error) {
+	key := "c" + pattern
+	if !caseSensitive {
+		key = "i" + pattern
+	}
+	regexCache.Lock()
+	re, ok := regexCache.m[key]
+	regexCache.Unlock()
+	if ok {
+		return re, nil
+	}
+	expr := pattern
+	if !caseSensitive {
+		expr = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, ErrValue
+	}
+	regexCache.Lock()
+	if len(regexCache.m) >= regexCacheSize {
+		regexCache.m = make(map[string]*regexp.Regexp)
+	}
+	regexCache.m[key] = re
+	regexCache.Unlock()
+	return re, nil
+}
+
+// RegexTest implements Excel's REGEXTEST function
+func RegexTest(s, pattern string, caseSensitive bool) (bool, error) {
+	re, err := compileRegex(pattern, caseSensitive)
+	if err != nil {
+		return false, err
+	}
+	return re.MatchString(s), nil
+}
+
+// RegexExtract implements Excel's REGEXEXTRACT function. Mode 0 returns the
+// first match, 1 an Array with a row per match and 2 an Array holding the
+// capture groups of the first match in a row. Returns ErrNA if nothing
+// matches
+func RegexExtract(s, pattern string, mode int, caseSensitive bool) (interface{}, error) {
+	re, err := compileRegex(pattern, caseSensitive)
+	if err != nil {
+		return nil, err
+	}
+	switch mode {
+	case 0:
+		loc := re.FindStringIndex(s)
+		if loc == nil {
+			return nil, ErrNA
+		}
+		return s[loc[0]:loc[1]], nil
+	case 1:
+		matches := re.FindAllString(s, -1)
+		if len(matches) == 0 {
+			return nil, ErrNA
+		}
+		arr := make(Array, len(matches))
+		for i, m := range matches {
+			arr[i] = []interface{}{m}
+		}
+		return arr, nil
+	case 2:
+		groups := re.FindStringSubmatch(s)
+		if groups == nil {
+			return nil, ErrNA
+		}
+		if len(groups) > 1 {
+			groups = groups[1:]
+		}
+		row := make([]interface{}, len(groups))
+		for i, g := range groups {
+			row[i] = g
+		}
+		return Array{row}, nil
+	}
+	return nil, ErrValue
+}
+
+// RegexReplace implements Excel's REGEXREPLACE function. Replacement may
+// refer to capture groups as $1 or ${name} and writes $ as $$. Occurrence 0
+// replaces every match, a positive one the nth match and a negative one the
+// nth match counting from the end
+func RegexReplace(s, pattern, replacement string, occurrence int, caseSensitive bool) (string, error) {
+	re, err := compileRegex(pattern, caseSensitive)
+	if err != nil {
+		return "", err
+	}
+	replacement = regexTemplate(replacement)
+	if occurrence == 0 {
+		return re.ReplaceAllString(s, replacement), nil
+	}
+	matches := re.FindAllStringSubmatchIndex(s, -1)
+	i := occurrence - 1
+	if occurrence < 0 {
+		i = len(matches) + occurrence
+	}
+	if i < 0 || i >= len(matches) {
+		return s, nil
+	}
+	m := matches[i]
+	out := re.ExpandString(nil, replacement, s, m)
+	return s[:m[0]] + string(out) + s[m[1]:], nil
+}
+
+// regexTemplate converts the replacement of REGEXREPLACE to the template of
+// regexp. Excel ends a group number at the first character that is not a
+// digit, so $1x is group 1 followed by x where regexp reads group 1x
+func regexTemplate(replacement string) string {
+	var sb strings.Builder
+	for i := 0; i < len(replacement); i++ {
+		c := replacement[i]
+		sb.WriteByte(c)
+		if c != '$' || i+1 >= len(replacement) {
+			continue
+		}
+		switch next := replacement[i+1]; {
+		case next == '$':
+			sb.WriteByte('$')
+			i++
+		case next >= '0' && next <= '9':
+			j := i + 1
+			for j < len(replacement) && replacement[j] >= '0' && replacement[j] <= '9' {
+				j++
+			}
+			sb.WriteString("{" + replacement[i+1:j] + "}")
+			i = j - 1
+		}
+	}
+	return sb.String()
+}
+
 // Replace implements Excel's REPLACE function
 func Replace(old string, strt, num int, newStr string) string {
 	strt = strt - 1
@@ -182,6 +328,205 @@ func Substitute(src, old, new string, inst int) string {
 	return strings.ReplaceAll(src, old, new)
 }
 
+// delimiterMatches returns the start and end of the delimiters found in text
+// from left to right, in runes. Where several delimiters match the longest
+// is taken. Empty delimiters are ignored
+func delimiterMatches(text []rune, delims []string, ignoreCase bool) [][2]int {
+	fold := func(rs []rune) []rune {
+		if !ignoreCase {
+			return rs
+		}
+		out := make([]rune, len(rs))
+		for i, r := range rs {
+			out[i] = unicode.ToLower(r)
+		}
+		return out
+	}
+	text = fold(text)
+	ds := make([][]rune, 0, len(delims))
+	for _, d := range delims {
+		if d != "" {
+			ds = append(ds, fold([]rune(d)))
+		}
+	}
+	var out [][2]int
+	for i := 0; i < len(text); {
+		best := 0
+		for _, d := range ds {
+			if len(d) > best && len(d) <= len(text)-i && string(text[i:i+len(d)]) == string(d) {
+				best = len(d)
+			}
+		}
+		if best == 0 {
+			i++
+			continue
+		}
+		out = append(out, [2]int{i, i + best})
+		i += best
+	}
+	return out
+}
+
+// textDelimiter finds instance of delims in s for TextBefore and TextAfter.
+// Returns the start and end of the delimiter in runes
+func textDelimiter(s []rune, delims []string, instance int, ignoreCase, matchEnd bool) (int, int, error) {
+	if instance == 0 || instance > len(s) || -instance > len(s) {
+		return 0, 0, ErrValue
+	}
+	empty := len(delims) == 0
+	for _, d := range delims {
+		empty = empty || d == ""
+	}
+	if empty {
+		// An empty delimiter is found at the start searching from the start
+		// and at the end searching from the end
+		if instance > 0 {
+			return 0, 0, nil
+		}
+		return len(s), len(s), nil
+	}
+	matches := delimiterMatches(s, delims, ignoreCase)
+	if instance > 0 {
+		if matchEnd {
+			matches = append(matches, [2]int{len(s), len(s)})
+		}
+		if instance > len(matches) {
+			return 0, 0, ErrNA
+		}
+		m := matches[instance-1]
+		return m[0], m[1], nil
+	}
+	if matchEnd {
+		matches = append([][2]int{{0, 0}}, matches...)
+	}
+	if -instance > len(matches) {
+		return 0, 0, ErrNA
+	}
+	m := matches[len(matches)+instance]
+	return m[0], m[1], nil
+}
+
+// TextBefore implements Excel's TEXTBEFORE function returning the text of s
+// before the instance of any of delims. Negative instance counts from the
+// end. With matchEnd the ends of s count as delimiters. Returns ErrNA if
+// the delimiter is not found
+func TextBefore(s string, delims []string, instance int, ignoreCase, matchEnd bool) (string, error) {
+	rs := []rune(s)
+	start, _, err := textDelimiter(rs, delims, instance, ignoreCase, matchEnd)
+	if err != nil {
+		return "", err
+	}
+	return string(rs[:start]), nil
+}
+
+// TextAfter implements Excel's TEXTAFTER function returning the text of s
+// after the instance of any of delims. See TextBefore
+func TextAfter(s string, delims []string, instance int, ignoreCase, matchEnd bool) (string, error) {
+	rs := []rune(s)
+	_, end, err := textDelimiter(rs, delims, instance, ignoreCase, matchEnd)
+	if err != nil {
+		return "", err
+	}
+	return string(rs[end:]), nil
+}
+
+// splitText splits s at delims. Without delimiters s is not split
+func splitText(s string, delims []string, ignoreCase, ignoreEmpty bool) []string {
+	rs := []rune(s)
+	var parts []string
+	last := 0
+	for _, m := range delimiterMatches(rs, delims, ignoreCase) {
+		parts = append(parts, string(rs[last:m[0]]))
+		last = m[1]
+	}
+	parts = append(parts, string(rs[last:]))
+	if !ignoreEmpty {
+		return parts
+	}
+	out := parts[:0]
+	for _, p := range parts {
+		if p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// TextSplit implements Excel's TEXTSPLIT function. s is split into rows at
+// rowDelims and each row into columns at colDelims. Rows shorter than the
+// longest are padded with pad
+func TextSplit(s string, colDelims, rowDelims []string, ignoreEmpty, ignoreCase bool, pad interface{}) Array {
+	rows := splitText(s, rowDelims, ignoreCase, ignoreEmpty)
+	arr := make(Array, 0, len(rows))
+	width := 0
+	for _, r := range rows {
+		cols := splitText(r, colDelims, ignoreCase, ignoreEmpty)
+		row := make([]interface{}, len(cols))
+		for i, c := range cols {
+			row[i] = c
+		}
+		if len(row) > width {
+			width = len(row)
+		}
+		arr = append(arr, row)
+	}
+	if len(arr) == 0 {
+		return Array{{""}}
+	}
+	for i, row := range arr {
+		for len(row) < width {
+			row = append(row, pad)
+		}
+		arr[i] = row
+	}
+	return arr
+}
+
+// ValueToText implements Excel's VALUETOTEXT function. Strict format puts
+// text in double quotes the way it is written in formulas
+func ValueToText(v interface{}, strict bool) string {
+	if str, ok := v.(string); ok && strict {
+		return `"` + strings.ReplaceAll(str, `"`, `""`) + `"`
+	}
+	if arr, ok := v.(Array); ok {
+		return ArrayToText(arr, strict)
+	}
+	return FormatValue(v)
+}
+
+// ArrayToText implements Excel's ARRAYTOTEXT function. The concise format
+// lists the values separated by ", " and the strict format writes an array
+// constant like {1,"a";2,"b"}
+func ArrayToText(arr Array, strict bool) string {
+	var sb strings.Builder
+	if strict {
+		sb.WriteString("{")
+	}
+	for i, row := range arr {
+		if i > 0 {
+			if strict {
+				sb.WriteString(";")
+			} else {
+				sb.WriteString(", ")
+			}
+		}
+		for j, v := range row {
+			if j > 0 {
+				if strict {
+					sb.WriteString(",")
+				} else {
+					sb.WriteString(", ")
+				}
+			}
+			sb.WriteString(ValueToText(v, strict))
+		}
+	}
+	if strict {
+		sb.WriteString("}")
+	}
+	return sb.String()
+}
+
 // Trim implements Excel's TRIM function
 func Trim(s string) string {
 	s = strings.TrimSpace(s)
@@ -1,6 +1,8 @@
 package efp
 
 import (
+	"context"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -392,3 +394,252 @@ func TestUpper(t *testing.T) {
 		t.Errorf("Failed %v of %v test cases", errCnt, len(tt))
 	}
 }
+
+func TestRegexTest(t *testing.T) {
+	tt := []struct {
+		name          string
+		s, pattern    string
+		caseSensitive bool
+		out           bool
+		err           error
+	}{
+		{"Match", "alice@example.com", `^\S+@\S+\.\S+$`, true, true, nil},
+		{"Case sensitive", "Hello", "hello", true, false, nil},
+		{"Ignoring case", "Hello", "hello", false, true, nil},
+		{"Invalid pattern", "Hello", "(", true, false, ErrValue},
+	}
+	var errCnt int
+	for _, tu := range tt {
+		b, err := RegexTest(tu.s, tu.pattern, tu.caseSensitive)
+		if b != tu.out || err != tu.err {
+			t.Logf("Test Name: %v, Expected: %v %v, Got: %v %v", tu.name, tu.out, tu.err, b, err)
+			errCnt++
+		}
+	}
+	if errCnt > 0 {
+		t.Errorf("Failed %v of %v test cases", errCnt, len(tt))
+	}
+}
+
+func TestRegexExtract(t *testing.T) {
+	tt := []struct {
+		name       string
+		s, pattern string
+		mode       int
+		out        interface{}
+		err        error
+	}{
+		{"First match", "Order 42 of 7", `\d+`, 0, "42", nil},
+		{"All matches", "Order 42 of 7", `\d+`, 1, Array{{"42"}, {"7"}}, nil},
+		{"Capture groups", "John Smith", `(\w+) (\w+)`, 2, Array{{"John", "Smith"}}, nil},
+		{"No match", "none", `\d`, 0, nil, ErrNA},
+		{"Invalid mode", "1", `\d`, 3, nil, ErrValue},
+	}
+	var errCnt int
+	for _, tu := range tt {
+		v, err := RegexExtract(tu.s, tu.pattern, tu.mode, true)
+		if !reflect.DeepEqual(v, tu.out) || err != tu.err {
+			t.Logf("Test Name: %v, Expected: %v %v, Got: %v %v", tu.name, tu.out, tu.err, v, err)
+			errCnt++
+		}
+	}
+	if errCnt > 0 {
+		t.Errorf("Failed %v of %v test cases", errCnt, len(tt))
+	}
+}
+
+func TestRegexReplace(t *testing.T) {
+	tt := []struct {
+		name                    string
+		s, pattern, replacement string
+		occurrence              int
+		caseSensitive           bool
+		out                     string
+	}{
+		{"All matches", "a1b22c333", `\d+`, "#", 0, true, "a#b#c#"},
+		{"Second match", "a1b22c333", `\d+`, "#", 2, true, "a1b#c333"},
+		{"Last match", "a1b22c333", `\d+`, "#", -1, true, "a1b22c#"},
+		{"Missing occurrence", "a1", `\d+`, "#", 3, true, "a1"},
+		{"Capture groups", "Smith, John", `(\w+), (\w+)`, "$2 $1", 0, true, "John Smith"},
+		{"Ignoring case", "Abc abc", "ABC", "x", 0, false, "x x"},
+	}
+	var errCnt int
+	for _, tu := range tt {
+		s, err := RegexReplace(tu.s, tu.pattern, tu.replacement, tu.occurrence, tu.caseSensitive)
+		if s != tu.out || err != nil {
+			t.Logf("Test Name: %v, Expected: %v, Got: %v %v", tu.name, tu.out, s, err)
+			errCnt++
+		}
+	}
+	if errCnt > 0 {
+		t.Errorf("Failed %v of %v test cases", errCnt, len(tt))
+	}
+}
+
+func TestRegexFormulas(t *testing.T) {
+	tt := []struct {
+		exp string
+		out interface{}
+	}{
+		{`REGEXTEST("ABC", "abc", 1)`, true},
+		{`REGEXTEST("ABC", "abc")`, false},
+		{`REGEXTEST("ABC", "abc", 2)`, ErrValue},
+		{`REGEXEXTRACT("tel: 555-1234", "[0-9-]+")`, "555-1234"},
+		{`REGEXREPLACE("2024-01-31", "(\d+)-(\d+)-(\d+)", "$3/$2/$1")`, "31/01/2024"},
+		{`REGEXREPLACE("x", "[", "y")`, ErrValue},
+		{`REGEXREPLACE("ab", "(a)", "$1x")`, "axb"},
+		{`REGEXREPLACE("ab", "(?P<first>a)", "${first}$$")`, "a$b"},
+		{`REGEXREPLACE("a1b2", "\d", "#", 2)`, "a1b#"},
+	}
+	var errCnt int
+	for _, tu := range tt {
+		eval, err := parse(tu.exp, 0)
+		if err != nil {
+			t.Logf("Test: %v, Parse Error: %v", tu.exp, err)
+			errCnt++
+			continue
+		}
+		out, err := eval(context.Background(), nil)
+		if e, ok := err.(ErrorValue); ok {
+			out = e
+		}
+		if out != tu.out {
+			t.Logf("Test: %v, Expected: %v, Got: %v %v", tu.exp, tu.out, out, err)
+			errCnt++
+		}
+	}
+	if errCnt > 0 {
+		t.Errorf("Failed %v of %v test cases", errCnt, len(tt))
+	}
+}
+
+func TestTextBeforeAfter(t *testing.T) {
+	tt := []struct {
+		name       string
+		s          string
+		delims     []string
+		instance   int
+		ignoreCase bool
+		matchEnd   bool
+		before     string
+		after      string
+		err        error
+	}{
+		{"First instance", "Red riding hood's, red hood", []string{"hood"}, 1, false, false, "Red riding ", "'s, red hood", nil},
+		{"Second instance", "Red riding hood's, red hood", []string{"hood"}, 2, false, false, "Red riding hood's, red ", "", nil},
+		{"From the end", "a-b-c", []string{"-"}, -1, false, false, "a-b", "c", nil},
+		{"Ignoring case", "Red riding hood", []string{"RIDING"}, 1, true, false, "Red ", " hood", nil},
+		{"Case sensitive", "Red riding hood", []string{"RIDING"}, 1, false, false, "", "", ErrNA},
+		{"Any of several", "a,b;c", []string{";", ","}, 2, false, false, "a,b", "c", nil},
+		{"Match end", "a-b", []string{"-"}, 2, false, true, "a-b", "", nil},
+		{"Match start from the end", "a-b", []string{"-"}, -2, false, true, "", "a-b", nil},
+		{"Instance zero", "a-b", []string{"-"}, 0, false, false, "", "", ErrValue},
+		{"Empty delimiter", "abc", []string{""}, 1, false, false, "", "abc", nil},
+	}
+	var errCnt int
+	for _, tu := range tt {
+		b, errB := TextBefore(tu.s, tu.delims, tu.instance, tu.ignoreCase, tu.matchEnd)
+		a, errA := TextAfter(tu.s, tu.delims, tu.instance, tu.ignoreCase, tu.matchEnd)
+		if b != tu.before || a != tu.after || errB != tu.err || errA != tu.err {
+			t.Logf("Test Name: %v, Expected: %q %q %v, Got: %q %q %v %v", tu.name, tu.before, tu.after, tu.err, b, a, errB, errA)
+			errCnt++
+		}
+	}
+	if errCnt > 0 {
+		t.Errorf("Failed %v of %v test cases", errCnt, len(tt))
+	}
+}
+
+func TestTextSplit(t *testing.T) {
+	tt := []struct {
+		name        string
+		s           string
+		cols, rows  []string
+		ignoreEmpty bool
+		out         Array
+	}{
+		{"Columns", "a b c", []string{" "}, nil, false, Array{{"a", "b", "c"}}},
+		{"Rows", "a;b", nil, []string{";"}, false, Array{{"a"}, {"b"}}},
+		{"Padded", "1,2;3", []string{","}, []string{";"}, false, Array{{"1", "2"}, {"3", ErrNA}}},
+		{"Empty kept", "a,,b", []string{","}, nil, false, Array{{"a", "", "b"}}},
+		{"Empty ignored", "a,,b", []string{","}, nil, true, Array{{"a", "b"}}},
+		{"Several delimiters", "a-b.c", []string{"-", "."}, nil, false, Array{{"a", "b", "c"}}},
+	}
+	var errCnt int
+	for _, tu := range tt {
+		out := TextSplit(tu.s, tu.cols, tu.rows, tu.ignoreEmpty, false, ErrNA)
+		if !reflect.DeepEqual(out, tu.out) {
+			t.Logf("Test Name: %v, Expected: %v, Got: %v", tu.name, tu.out, out)
+			errCnt++
+		}
+	}
+	if errCnt > 0 {
+		t.Errorf("Failed %v of %v test cases", errCnt, len(tt))
+	}
+}
+
+func TestValueToText(t *testing.T) {
+	arr := Array{{1.0, "a"}, {true, ErrNA}}
+	tt := []struct {
+		name   string
+		in     interface{}
+		strict bool
+		out    string
+	}{
+		{"Number", 1234.5, false, "1234.5"},
+		{"Text", `say "hi"`, false, `say "hi"`},
+		{"Strict text", `say "hi"`, true, `"say ""hi"""`},
+		{"Boolean", true, true, "TRUE"},
+		{"Concise array", arr, false, "1, a, TRUE, #N/A"},
+		{"Strict array", arr, true, `{1,"a";TRUE,#N/A}`},
+	}
+	var errCnt int
+	for _, tu := range tt {
+		if s := ValueToText(tu.in, tu.strict); s != tu.out {
+			t.Logf("Test Name: %v, Expected: %v, Got: %v", tu.name, tu.out, s)
+			errCnt++
+		}
+	}
+	if errCnt > 0 {
+		t.Errorf("Failed %v of %v test cases", errCnt, len(tt))
+	}
+}
+
+func TestTextSplittingFormulas(t *testing.T) {
+	tt := []struct {
+		exp string
+		out interface{}
+	}{
+		{`TEXTBEFORE("john.smith@example.com", "@")`, "john.smith"},
+		{`TEXTAFTER("john.smith@example.com", ".", -1)`, "com"},
+		{`TEXTAFTER("no delimiter", "@", 1, 0, 0, "none")`, "none"},
+		{`TEXTBEFORE("no delimiter", "@")`, ErrNA},
+		{`TEXTBEFORE("A-B", "b", 1, 1)`, "A-"},
+		{`ARRAYTOTEXT(TEXTSPLIT("a,b;c", ",", ";", FALSE, 0, ""), 1)`, `{"a","b";"c",""}`},
+		{`ARRAYTOTEXT(TEXTSPLIT("a;b",,";"))`, "a, b"},
+		{`ARRAYTOTEXT(TEXTSPLIT("a,b;c", ",", ";", , , ), 1)`, `{"a","b";"c",#N/A}`},
+		{`TEXTAFTER("no delimiter", "@", , , , "none")`, "none"},
+		{`VALUETOTEXT("x", 1)`, `"x"`},
+		{`VALUETOTEXT("x", 2)`, ErrValue},
+	}
+	var errCnt int
+	for _, tu := range tt {
+		eval, err := parse(tu.exp, 0)
+		if err != nil {
+			t.Logf("Test: %v, Parse Error: %v", tu.exp, err)
+			errCnt++
+			continue
+		}
+		out, err := eval(context.Background(), nil)
+		if e, ok := err.(ErrorValue); ok {
+			out = e
+		}
+		if out != tu.out {
+			t.Logf("Test: %v, Expected: %v, Got: %v %v", tu.exp, tu.out, out, err)
+			errCnt++
+		}
+	}
+	if errCnt > 0 {
+		t.Errorf("Failed %v of %v test cases", errCnt, len(tt))
+	}
+}
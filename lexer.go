@@ -0,0 +1,515 @@
+// Copyright © 2019 Praveen Tirumandyam praveen.tirumandyam@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package efp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokOther tokenKind = iota
+	tokSpace
+	tokString
+	tokNumber
+	tokError
+	tokRef
+	tokFunc
+	tokName
+	tokTable
+	tokOp
+	tokSep
+	tokOpen
+	tokClose
+)
+
+// token is a lexical unit of an excel formula. text holds the token exactly as
+// it appeared in the formula so that untouched tokens round trip unchanged
+type token struct {
+	kind tokenKind
+	text string
+	ref  Ref
+}
+
+// errorLiterals are the error values Excel allows to be typed in formula
+var errorLiterals = []string{"#NULL!", "#DIV/0!", "#VALUE!", "#REF!", "#NAME?", "#NUM!", "#N/A", "#GETTING_DATA", "#SPILL!", "#CALC!"}
+
+// refLexer tries to read a reference for sheet starting at pos. Returns the
+// token without its text and the position following it
+type refLexer func(rs []rune, pos int, sheet string) (token, int, bool)
+
+// lex splits an excel formula into tokens. A leading '=' is not part of the
+// formula and must be removed by the caller
+func lex(s string) ([]token, error) {
+	return lexWith(s, lexA1)
+}
+
+// lexWith splits formula into tokens reading references with area
+func lexWith(s string, area refLexer) ([]token, error) {
+	rs := []rune(s)
+	toks := make([]token, 0)
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		switch {
+		case unicode.IsSpace(r):
+			j := i
+			for j < len(rs) && unicode.IsSpace(rs[j]) {
+				j++
+			}
+			toks = append(toks, token{kind: tokSpace, text: string(rs[i:j])})
+			i = j
+		case r == '"':
+			j := i + 1
+			for {
+				if j >= len(rs) {
+					return nil, fmt.Errorf("unterminated string in formula %q", s)
+				}
+				if rs[j] == '"' {
+					if j+1 < len(rs) && rs[j+1] == '"' {
+						j += 2
+						continue
+					}
+					break
+				}
+				j++
+			}
+			toks = append(toks, token{kind: tokString, text: string(rs[i : j+1])})
+			i = j + 1
+		case r == '#':
+			lit := ""
+			for _, e := range errorLiterals {
+				if strings.HasPrefix(strings.ToUpper(string(rs[i:])), e) {
+					lit = e
+					break
+				}
+			}
+			if lit == "" {
+				return nil, fmt.Errorf("unknown error literal in formula %q", s)
+			}
+			toks = append(toks, token{kind: tokError, text: lit})
+			i += len([]rune(lit))
+		case r == '\'':
+			j := i + 1
+			for {
+				if j >= len(rs) {
+					return nil, fmt.Errorf("unterminated sheet name in formula %q", s)
+				}
+				if rs[j] == '\'' {
+					if j+1 < len(rs) && rs[j+1] == '\'' {
+						j += 2
+						continue
+					}
+					break
+				}
+				j++
+			}
+			if j+1 >= len(rs) || rs[j+1] != '!' {
+				return nil, fmt.Errorf("quoted sheet name must be followed by '!' in formula %q", s)
+			}
+			sheet := strings.ReplaceAll(string(rs[i+1:j]), "''", "'")
+			var last string
+			if k := strings.IndexByte(sheet, ':'); k > 0 {
+				// 3D reference like 'Jan 2020:Mar 2020'!A1
+				sheet, last = sheet[:k], sheet[k+1:]
+			}
+			tok, n, err := lexQualified(rs, j+2, sheet, area)
+			if err != nil {
+				return nil, err
+			}
+			tok.ref.LastSheet = last
+			toks = append(toks, tok.withText(string(rs[i:n])))
+			i = n
+		case unicode.IsDigit(r) || (r == '.' && i+1 < len(rs) && unicode.IsDigit(rs[i+1])):
+			if tok, n, ok := area(rs, i, ""); ok {
+				toks = append(toks, tok.withText(string(rs[i:n])))
+				i = n
+				continue
+			}
+			j := i
+			for j < len(rs) && (unicode.IsDigit(rs[j]) || rs[j] == '.') {
+				j++
+			}
+			if j < len(rs) && (rs[j] == 'e' || rs[j] == 'E') {
+				k := j + 1
+				if k < len(rs) && (rs[k] == '+' || rs[k] == '-') {
+					k++
+				}
+				if k < len(rs) && unicode.IsDigit(rs[k]) {
+					j = k
+					for j < len(rs) && unicode.IsDigit(rs[j]) {
+						j++
+					}
+				}
+			}
+			toks = append(toks, token{kind: tokNumber, text: string(rs[i:j])})
+			i = j
+		case isWordStart(r):
+			j := i
+			for j < len(rs) && isWordRune(rs[j]) {
+				j++
+			}
+			word := string(rs[i:j])
+			last, k := lexLastSheet(rs, j)
+			switch {
+			case k > 0:
+				tok, n, err := lexQualified(rs, k, word, area)
+				if err != nil {
+					return nil, err
+				}
+				tok.ref.LastSheet = last
+				toks = append(toks, tok.withText(string(rs[i:n])))
+				i = n
+				continue
+			case j < len(rs) && rs[j] == '!':
+				tok, n, err := lexQualified(rs, j+1, word, area)
+				if err != nil {
+					return nil, err
+				}
+				toks = append(toks, tok.withText(string(rs[i:n])))
+				i = n
+				continue
+			case j < len(rs) && rs[j] == '(':
+				toks = append(toks, token{kind: tokFunc, text: word})
+			default:
+				if tok, n, ok := area(rs, i, ""); ok {
+					toks = append(toks, tok.withText(string(rs[i:n])))
+					i = n
+					continue
+				}
+				if n := lexBrackets(rs, j); n > 0 && isStructured(rs, j, n) {
+					toks = append(toks, token{kind: tokTable, text: string(rs[i:n])})
+					i = n
+					continue
+				}
+				toks = append(toks, token{kind: tokName, text: word})
+			}
+			i = j
+		case r == '<' || r == '>':
+			if i+1 < len(rs) && (rs[i+1] == '=' || (r == '<' && rs[i+1] == '>')) {
+				toks = append(toks, token{kind: tokOp, text: string(rs[i : i+2])})
+				i += 2
+				continue
+			}
+			toks = append(toks, token{kind: tokOp, text: string(r)})
+			i++
+		case strings.ContainsRune("+-*/^&=%:@", r):
+			toks = append(toks, token{kind: tokOp, text: string(r)})
+			i++
+		case r == ',' || r == ';':
+			toks = append(toks, token{kind: tokSep, text: string(r)})
+			i++
+		case r == '[' && (i == 0 || !(isWordRune(rs[i-1]) || rs[i-1] == ']')) && isStructured(rs, i, lexBrackets(rs, i)):
+			// Structured reference to the table holding the formula
+			n := lexBrackets(rs, i)
+			toks = append(toks, token{kind: tokTable, text: string(rs[i:n])})
+			i = n
+		case r == '(' || r == '{':
+			toks = append(toks, token{kind: tokOpen, text: string(r)})
+			i++
+		case r == ')' || r == '}':
+			toks = append(toks, token{kind: tokClose, text: string(r)})
+			i++
+		default:
+			toks = append(toks, token{kind: tokOther, text: string(r)})
+			i++
+		}
+	}
+	return toks, nil
+}
+
+// lexQualified lexes the part of a reference following the "Sheet!" prefix.
+// pos is the position just after '!'. Returns the token and the position
+// following it
+func lexQualified(rs []rune, pos int, sheet string, area refLexer) (token, int, error) {
+	if tok, n, ok := area(rs, pos, sheet); ok {
+		return tok, n, nil
+	}
+	if strings.HasPrefix(strings.ToUpper(string(rs[pos:])), "#REF!") {
+		return token{kind: tokError}, pos + len("#REF!"), nil
+	}
+	j := pos
+	for j < len(rs) && isWordRune(rs[j]) {
+		j++
+	}
+	if j == pos {
+		return token{}, 0, fmt.Errorf("invalid reference to sheet %q", sheet)
+	}
+	return token{kind: tokName}, j, nil
+}
+
+// lexLastSheet reads the ":Sheet3!" part of a 3D reference like
+// Sheet1:Sheet3!A1 starting at pos. Returns the last sheet and the position
+// following '!', 0 if there is no such part
+func lexLastSheet(rs []rune, pos int) (string, int) {
+	if pos >= len(rs) || rs[pos] != ':' || pos+1 >= len(rs) || !isWordStart(rs[pos+1]) {
+		return "", 0
+	}
+	j := pos + 1
+	for j < len(rs) && isWordRune(rs[j]) {
+		j++
+	}
+	if j >= len(rs) || rs[j] != '!' {
+		return "", 0
+	}
+	return string(rs[pos+1 : j]), j + 1
+}
+
+// lexBrackets returns the position following the ']' closing the '[' at pos,
+// -1 if it is not closed. Brackets nest and a ' escapes the next character
+func lexBrackets(rs []rune, pos int) int {
+	depth := 0
+	for j := pos; j < len(rs); j++ {
+		switch rs[j] {
+		case '\'':
+			j++
+		case '[':
+			depth++
+		case ']':
+			if depth--; depth == 0 {
+				return j + 1
+			}
+		}
+	}
+	return -1
+}
+
+// isStructured tells a structured reference like Orders[Amount] apart from
+// the index of a variable like lines[1].item. The brackets run from pos up
+// to end, which is negative if they are not closed
+func isStructured(rs []rune, pos, end int) bool {
+	if end < 0 || (end < len(rs) && (rs[end] == '.' || rs[end] == '[')) {
+		return false
+	}
+	inner := strings.TrimSpace(string(rs[pos+1 : end-1]))
+	return inner == "" || !(unicode.IsDigit([]rune(inner)[0]) || inner[0] == '"' || inner[0] == '-')
+}
+
+// withText returns t holding the formula text it was read from. References
+// which fall outside the sheet are written as #REF! keeping the sheet
+func (t token) withText(text string) token {
+	t.text = text
+	if t.kind == tokError {
+		t.text = refErrorText(t)
+	}
+	return t
+}
+
+// lexA1 reads references in A1 notation
+func lexA1(rs []rune, pos int, sheet string) (token, int, bool) {
+	ref, n, ok := lexArea(rs, pos, sheet)
+	if !ok {
+		return token{}, 0, false
+	}
+	return token{kind: tokRef, ref: ref}, n, true
+}
+
+// lexR1C1 returns a refLexer reading references in R1C1 notation relative to
+// host. References falling outside the sheet become #REF! errors
+func lexR1C1(host CellRef) refLexer {
+	return func(rs []rune, pos int, sheet string) (token, int, bool) {
+		from, n, inside, ok := lexR1C1Cell(rs, pos, host)
+		if !ok {
+			return token{}, 0, false
+		}
+		to := from
+		if n < len(rs) && rs[n] == ':' {
+			c, m, in, ok := lexR1C1Cell(rs, n+1, host)
+			if ok && (c.Row == 0) == (from.Row == 0) && (c.Col == 0) == (from.Col == 0) {
+				to, n, inside = c, m, inside && in
+			}
+		}
+		if !inside {
+			return token{kind: tokError}, n, true
+		}
+		return token{kind: tokRef, ref: Ref{Sheet: sheet, From: from, To: to}.normalize()}, n, true
+	}
+}
+
+// lexR1C1Cell tries to read a cell like R[-1]C2 relative to host starting at
+// pos. R or C alone with its number is a whole row or column. inside is
+// false when the cell falls outside the sheet
+func lexR1C1Cell(rs []rune, pos int, host CellRef) (c CellRef, n int, inside bool, ok bool) {
+	j := pos
+	inside = true
+	// axis reads the row or column part starting with letter. Returns 0 when
+	// the part is missing and false when it is malformed
+	axis := func(letter rune, h, max int, abs *bool) (int, bool) {
+		if j >= len(rs) || unicode.ToUpper(rs[j]) != letter {
+			return 0, true
+		}
+		k, v := j+1, h
+		if k < len(rs) && rs[k] == '[' {
+			end := k + 1
+			if end < len(rs) && (rs[end] == '-' || rs[end] == '+') {
+				end++
+			}
+			for end < len(rs) && unicode.IsDigit(rs[end]) {
+				end++
+			}
+			if end >= len(rs) || rs[end] != ']' {
+				return 0, false
+			}
+			d, err := strconv.Atoi(string(rs[k+1 : end]))
+			if err != nil {
+				return 0, false
+			}
+			v, k = h+d, end+1
+		} else {
+			start := k
+			for k < len(rs) && unicode.IsDigit(rs[k]) {
+				k++
+			}
+			if k > start {
+				a, err := strconv.Atoi(string(rs[start:k]))
+				if err != nil {
+					return 0, false
+				}
+				v, *abs = a, true
+			}
+		}
+		if v < 1 || v > max {
+			inside = false
+		}
+		j = k
+		return v, true
+	}
+	if c.Row, ok = axis('R', host.Row, MaxRows, &c.RowAbs); !ok {
+		return CellRef{}, 0, false, false
+	}
+	if c.Col, ok = axis('C', host.Col, MaxColumns, &c.ColAbs); !ok {
+		return CellRef{}, 0, false, false
+	}
+	if j == pos || (j < len(rs) && (isWordRune(rs[j]) || rs[j] == '(' || rs[j] == '!')) {
+		return CellRef{}, 0, false, false
+	}
+	return c, j, inside, true
+}
+
+// lexArea tries to read a cell, an area or whole columns or rows reference
+// starting at pos
+func lexArea(rs []rune, pos int, sheet string) (Ref, int, bool) {
+	from, n, ok := lexCell(rs, pos)
+	if !ok {
+		from, to, n, ok := lexLines(rs, pos)
+		if !ok {
+			return Ref{}, 0, false
+		}
+		return Ref{Sheet: sheet, From: from, To: to}.normalize(), n, true
+	}
+	ref := Ref{Sheet: sheet, From: from, To: from}
+	if n < len(rs) && rs[n] == ':' {
+		if to, m, ok := lexCell(rs, n+1); ok {
+			ref.To = to
+			n = m
+		}
+	}
+	return ref.normalize(), n, true
+}
+
+// lexCell tries to read a cell reference like $A$1 starting at pos. The cell
+// must not be followed by characters which would make it a longer name
+func lexCell(rs []rune, pos int) (CellRef, int, bool) {
+	j := pos
+	if j < len(rs) && rs[j] == '$' {
+		j++
+	}
+	for j < len(rs) && isASCIILetter(rs[j]) {
+		j++
+	}
+	if j < len(rs) && rs[j] == '$' {
+		j++
+	}
+	for j < len(rs) && unicode.IsDigit(rs[j]) {
+		j++
+	}
+	if j < len(rs) && (isWordRune(rs[j]) || rs[j] == '(' || rs[j] == '!') {
+		return CellRef{}, 0, false
+	}
+	c, err := ParseCellRef(string(rs[pos:j]))
+	if err != nil {
+		return CellRef{}, 0, false
+	}
+	return c, j, true
+}
+
+// lexLines tries to read whole columns reference like $A:C or whole rows
+// reference like 1:$3 starting at pos
+func lexLines(rs []rune, pos int) (CellRef, CellRef, int, bool) {
+	from, n, ok := lexLine(rs, pos)
+	if !ok || n >= len(rs) || rs[n] != ':' {
+		return CellRef{}, CellRef{}, 0, false
+	}
+	to, m, ok := lexLine(rs, n+1)
+	if !ok || (from.Col == 0) != (to.Col == 0) {
+		return CellRef{}, CellRef{}, 0, false
+	}
+	return from, to, m, true
+}
+
+// lexLine reads one side of a whole columns or whole rows reference
+func lexLine(rs []rune, pos int) (CellRef, int, bool) {
+	j := pos
+	abs := j < len(rs) && rs[j] == '$'
+	if abs {
+		j++
+	}
+	start := j
+	for j < len(rs) && isASCIILetter(rs[j]) {
+		j++
+	}
+	if j > start {
+		col := ColumnIndex(string(rs[start:j]))
+		if col == 0 || (j < len(rs) && (isWordRune(rs[j]) || rs[j] == '(')) {
+			return CellRef{}, 0, false
+		}
+		return CellRef{Col: col, ColAbs: abs}, j, true
+	}
+	for j < len(rs) && unicode.IsDigit(rs[j]) {
+		j++
+	}
+	if j == start || (j < len(rs) && (isWordRune(rs[j]) || rs[j] == '(')) {
+		return CellRef{}, 0, false
+	}
+	row, err := strconv.Atoi(string(rs[start:j]))
+	if err != nil || row < 1 || row > MaxRows {
+		return CellRef{}, 0, false
+	}
+	return CellRef{Row: row, RowAbs: abs}, j, true
+}
+
+func isASCIILetter(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+}
+
+func isWordStart(r rune) bool {
+	return unicode.IsLetter(r) || r == '_' || r == '\\' || r == '$'
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '.' || r == '$' || r == '\\'
+}
+
+// joinTokens writes the tokens back as formula text
+func joinTokens(toks []token) string {
+	var sb strings.Builder
+	for _, t := range toks {
+		sb.WriteString(t.text)
+	}
+	return sb.String()
+}
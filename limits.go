@@ -0,0 +1,205 @@
+// Copyright © 2019 Praveen Tirumandyam praveen.tirumandyam@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package efp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+
+	"github.com/PaesslerAG/gval"
+)
+
+// Limits bounds the resources used to evaluate formulas. Formulas written by
+// untrusted users can otherwise build huge text with REPT, refer to whole
+// sheets or nest without end. Zero fields are not limited
+type Limits struct {
+	// MaxStringLength is the longest text a formula may produce
+	MaxStringLength int
+	// MaxArraySize is the most values an array or a referenced range may hold
+	MaxArraySize int
+	// MaxDepth is the deepest nesting of parentheses in a formula
+	MaxDepth int
+	// MaxChainDepth is the longest chain of cells and names, each referring
+	// to the next, followed while evaluating a workbook
+	MaxChainDepth int
+	// MaxSteps is the number of function calls, operators and references an
+	// evaluation may perform
+	MaxSteps int
+}
+
+// DefaultLimits use Excel's limits on text length and nesting along with
+// bounds on arrays and steps suitable for formulas from untrusted users
+var DefaultLimits = Limits{
+	MaxStringLength: 32767,
+	MaxArraySize:    1 << 20,
+	MaxDepth:        64,
+	MaxChainDepth:   10000,
+	MaxSteps:        1 << 20,
+}
+
+// LimitError is returned when evaluating a formula exceeds one of its Limits
+type LimitError struct {
+	// Limit is the name of the field of Limits that was exceeded
+	Limit string
+	Max   int
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("formula exceeds %s of %d", e.Limit, e.Max)
+}
+
+type limitsKey struct{}
+
+// limiter counts the steps taken under one set of limits
+type limiter struct {
+	Limits
+	steps int64
+}
+
+// WithLimits returns a copy of c under which formulas are evaluated within l.
+// Steps are counted across all evaluations done with the returned context,
+// so a workbook recalculation shares one budget
+func WithLimits(c context.Context, l Limits) context.Context {
+	return context.WithValue(c, limitsKey{}, &limiter{Limits: l})
+}
+
+// Parse parses formula like efp.Parse and checks its nesting against
+// MaxDepth. The returned Evaluable enforces l unless it is called with a
+// context that already carries limits
+func (l Limits) Parse(r io.WriterTo) (gval.Evaluable, error) {
+	var sb strings.Builder
+	r.WriteTo(&sb)
+	eval, err := parse(sb.String(), l.MaxDepth)
+	if err != nil {
+		return nil, err
+	}
+	return l.apply(eval), nil
+}
+
+// apply returns eval evaluating within l unless the context of the
+// evaluation already carries limits
+func (l Limits) apply(eval gval.Evaluable) gval.Evaluable {
+	return func(c context.Context, v interface{}) (interface{}, error) {
+		if c == nil {
+			c = context.Background()
+		}
+		if limiterFrom(c) == nil {
+			c = WithLimits(c, l)
+		}
+		return eval(c, v)
+	}
+}
+
+// checkNesting fails if a formula nesting depth deep is deeper than max. Zero
+// max is not limited
+func checkNesting(depth, max int) error {
+	if max > 0 && depth > max {
+		return &LimitError{Limit: "MaxDepth", Max: max}
+	}
+	return nil
+}
+
+func limiterFrom(c context.Context) *limiter {
+	if c == nil {
+		return nil
+	}
+	l, _ := c.Value(limitsKey{}).(*limiter)
+	return l
+}
+
+// step accounts for one step of evaluation. It fails once c is done or the
+// step budget is spent. Operators on constants are evaluated while parsing
+// with a nil context
+func step(c context.Context) error {
+	if c == nil {
+		return nil
+	}
+	if err := c.Err(); err != nil {
+		return err
+	}
+	if l := limiterFrom(c); l != nil && l.MaxSteps > 0 && atomic.AddInt64(&l.steps, 1) > int64(l.MaxSteps) {
+		return &LimitError{Limit: "MaxSteps", Max: l.MaxSteps}
+	}
+	return nil
+}
+
+// maxDepth returns the nesting limit formulas evaluated with c are parsed
+// with, 0 if there is none
+func maxDepth(c context.Context) int {
+	if l := limiterFrom(c); l != nil {
+		return l.MaxDepth
+	}
+	return 0
+}
+
+// checkStringLength fails if text of n bytes is longer than allowed
+func checkStringLength(c context.Context, n float64) error {
+	if l := limiterFrom(c); l != nil && l.MaxStringLength > 0 && n > float64(l.MaxStringLength) {
+		return &LimitError{Limit: "MaxStringLength", Max: l.MaxStringLength}
+	}
+	return nil
+}
+
+// checkArraySize fails if an array of n values is larger than allowed
+func checkArraySize(c context.Context, n float64) error {
+	if l := limiterFrom(c); l != nil && l.MaxArraySize > 0 && n > float64(l.MaxArraySize) {
+		return &LimitError{Limit: "MaxArraySize", Max: l.MaxArraySize}
+	}
+	return nil
+}
+
+// checkChainDepth fails if a chain of d cells referring to each other is
+// longer than allowed
+func checkChainDepth(c context.Context, d int) error {
+	if l := limiterFrom(c); l != nil && l.MaxChainDepth > 0 && d > l.MaxChainDepth {
+		return &LimitError{Limit: "MaxChainDepth", Max: l.MaxChainDepth}
+	}
+	return nil
+}
+
+// checkValue fails if text or array v is larger than allowed
+func checkValue(c context.Context, v interface{}) error {
+	switch val := v.(type) {
+	case string:
+		return checkStringLength(c, float64(len(val)))
+	case Array:
+		n := 0
+		for _, row := range val {
+			n += len(row)
+		}
+		return checkArraySize(c, float64(n))
+	}
+	return nil
+}
+
+// nesting returns the deepest nesting of parentheses and braces in toks
+func nesting(toks []token) int {
+	depth, max := 0, 0
+	for _, t := range toks {
+		switch t.kind {
+		case tokOpen:
+			depth++
+			if depth > max {
+				max = depth
+			}
+		case tokClose:
+			depth--
+		}
+	}
+	return max
+}
@@ -0,0 +1,72 @@
+package efp
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestLimits(t *testing.T) {
+	wb := NewWorkbook()
+	s := wb.AddSheet("Sheet1")
+	s.SetValue("A1", 1.0)
+	for i := 2; i <= 100; i++ {
+		s.SetFormula(fmt.Sprintf("A%d", i), fmt.Sprintf("A%d+1", i-1))
+	}
+	tt := []struct {
+		name    string
+		formula string
+		limits  Limits
+		limit   string
+	}{
+		{"Within limits", `LEN(REPT("x", 10))`, DefaultLimits, ""},
+		{"Long REPT", `REPT("x", 1e9)`, DefaultLimits, "MaxStringLength"},
+		{"Long concatenation", `REPT("x", 20000)&REPT("y", 20000)`, DefaultLimits, "MaxStringLength"},
+		{"Deep nesting", strings.Repeat("(", 65) + "1" + strings.Repeat(")", 65), DefaultLimits, "MaxDepth"},
+		{"Nesting within limit", strings.Repeat("(", 64) + "1" + strings.Repeat(")", 64), DefaultLimits, ""},
+		{"Running total", "A100", DefaultLimits, ""},
+		{"Long chain of references", "A100", Limits{MaxChainDepth: 64}, "MaxChainDepth"},
+		{"Chain within limit", "A50", Limits{MaxChainDepth: 64}, ""},
+		{"Large range", "SUM(A:XFD)", Limits{MaxArraySize: 100}, "MaxArraySize"},
+		{"Large identity matrix", "MUNIT(30000)", DefaultLimits, "MaxArraySize"},
+		{"Large matrix product", "MMULT(A1:A20,TRANSPOSE(A1:A20))", Limits{MaxArraySize: 100}, "MaxArraySize"},
+		{"Large expansion", "EXPAND(1,100000,16384)", DefaultLimits, "MaxArraySize"},
+		{"Wide wrap", "WRAPROWS(A1:A3,1e9)", DefaultLimits, "MaxArraySize"},
+		{"Tall wrap", "WRAPCOLS(A1:A3,1e9)", DefaultLimits, "MaxArraySize"},
+		{"Step budget", "1+A1+A1+A1+A1+A1", Limits{MaxSteps: 4}, "MaxSteps"},
+		{"No limits", `REPT("x", 100000)&A100`, Limits{}, ""},
+	}
+	var errCnt int
+	for _, tu := range tt {
+		eval, err := tu.limits.Parse(strings.NewReader(tu.formula))
+		if err == nil {
+			_, err = eval(context.Background(), &sheetScope{ch: newEvaluation(wb).newChain(), sheet: s})
+		}
+		got := ""
+		if le, ok := err.(*LimitError); ok {
+			got = le.Limit
+		} else if err != nil {
+			got = err.Error()
+		}
+		if got != tu.limit {
+			t.Logf("Test: %v, Expected: %v, Got: %v", tu.name, tu.limit, got)
+			errCnt++
+		}
+	}
+	if errCnt > 0 {
+		t.Errorf("Failed %v of %v test cases", errCnt, len(tt))
+	}
+}
+
+func TestCancel(t *testing.T) {
+	c, cancel := context.WithCancel(context.Background())
+	cancel()
+	eval, err := Parse(strings.NewReader(`LEN("abc")`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := eval(c, nil); err != context.Canceled {
+		t.Errorf("Expected: %v, Got: %v", context.Canceled, err)
+	}
+}
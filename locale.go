@@ -0,0 +1,391 @@
+// Copyright © 2019 Praveen Tirumandyam praveen.tirumandyam@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package efp
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+
+	"github.com/PaesslerAG/gval"
+)
+
+// Locale describes how formulas are written in a language version of Excel:
+// the separators used between arguments and in array constants, the decimal
+// separator of numbers and the names of functions
+type Locale struct {
+	// Name is the language code of the locale like "de"
+	Name string
+	// ArgSep separates the arguments of functions
+	ArgSep rune
+	// ColSep and RowSep separate the columns and rows of array constants
+	ColSep rune
+	RowSep rune
+	// Decimal is the decimal separator of numbers
+	Decimal rune
+	// Functions maps English function names to their name in the locale.
+	// Functions missing from the map have the same name in both
+	Functions map[string]string
+}
+
+// Locales supported out of the box by language code
+var Locales = map[string]*Locale{
+	"en": English,
+	"de": German,
+	"fr": French,
+	"es": Spanish,
+	"it": Italian,
+	"pt": Portuguese,
+}
+
+// English is the syntax formulas are parsed in by Parse
+var English = &Locale{Name: "en", ArgSep: ',', ColSep: ',', RowSep: ';', Decimal: '.'}
+
+// German locale
+var German = &Locale{Name: "de", ArgSep: ';', ColSep: '.', RowSep: ';', Decimal: ',', Functions: map[string]string{
+	"ADDRESS": "ADRESSE", "AND": "UND", "BIN2DEC": "BININDEZ", "BIN2HEX": "BININHEX",
+	"BIN2OCT": "BININOKT", "BITAND": "BITUND", "BITLSHIFT": "BITLVERSCHIEB", "BITOR": "BITODER",
+	"BITRSHIFT": "BITRVERSCHIEB", "BITXOR": "BITXODER", "CHOOSE": "WAHL", "CHOOSECOLS": "SPALTENWAHL",
+	"CHOOSEROWS": "ZEILENWAHL", "COLUMN": "SPALTE", "COLUMNS": "SPALTEN", "COMPLEX": "KOMPLEXE",
+	"CONCAT": "TEXTKETTE", "CONCATENATE": "VERKETTEN", "CONVERT": "UMWANDELN", "COUNT": "ANZAHL",
+	"COUNTIF": "ZÄHLENWENN", "DAVERAGE": "DBMITTELWERT", "DCOUNT": "DBANZAHL", "DEC2BIN": "DEZINBIN",
+	"DEC2HEX": "DEZINHEX", "DEC2OCT": "DEZINOKT", "DGET": "DBAUSZUG", "DMAX": "DBMAX", "DMIN": "DBMIN",
+	"DPRODUCT": "DBPRODUKT", "DROP": "WEGLASSEN", "DSTDEV": "DBSTDABW", "DSUM": "DBSUMME",
+	"EXACT": "IDENTISCH", "EXPAND": "ERWEITERN", "FALSE": "FALSCH", "FIND": "FINDEN",
+	"GESTEP": "GGANZZAHL", "HEX2BIN": "HEXINBIN", "HEX2DEC": "HEXINDEZ", "HEX2OCT": "HEXINOKT",
+	"HSTACK": "HSTAPELN", "IF": "WENN", "IMAGINARY": "IMAGINÄRTEIL", "IMCONJUGATE": "IMKONJUGIERTE",
+	"IMCOSH": "IMCOSHYP", "IMCSC": "IMCOSEC", "IMCSCH": "IMCOSECHYP", "IMPOWER": "IMAPOTENZ",
+	"IMPRODUCT": "IMPRODUKT", "IMREAL": "IMREALTEIL", "IMSECH": "IMSECHYP", "IMSINH": "IMSINHYP",
+	"IMSQRT": "IMWURZEL", "IMSUM": "IMSUMME", "INDIRECT": "INDIREKT", "LEFT": "LINKS", "LEN": "LÄNGE",
+	"LOWER": "KLEIN", "MDETERM": "MDET", "MID": "TEIL", "MINVERSE": "MINV", "MUNIT": "MEINHEIT",
+	"NOT": "NICHT", "NOW": "JETZT", "OCT2BIN": "OKTINBIN", "OCT2DEC": "OKTINDEZ", "OCT2HEX": "OKTINHEX",
+	"OFFSET": "BEREICH.VERSCHIEBEN", "OR": "ODER", "PROPER": "GROSS2", "RAND": "ZUFALLSZAHL",
+	"RANDBETWEEN": "ZUFALLSBEREICH", "REGEXEXTRACT": "REGEXEXTRAHIEREN",
+	"REGEXREPLACE": "REGEXERSETZEN", "REPLACE": "ERSETZEN", "REPT": "WIEDERHOLEN", "RIGHT": "RECHTS",
+	"ROW": "ZEILE", "ROWS": "ZEILEN", "SEARCH": "SUCHEN", "SUBSTITUTE": "WECHSELN", "SUM": "SUMME",
+	"SUMIF": "SUMMEWENN", "SUMPRODUCT": "SUMMENPRODUKT", "SUMX2MY2": "SUMMEX2MY2",
+	"SUMX2PY2": "SUMMEX2PY2", "SUMXMY2": "SUMMEXMY2", "TAKE": "ÜBERNEHMEN", "TEXTAFTER": "TEXTNACH",
+	"TEXTBEFORE": "TEXTVOR", "TEXTSPLIT": "TEXTTEILEN", "TOCOL": "ZUSPALTE", "TODAY": "HEUTE",
+	"TOROW": "ZUZEILE", "TRANSPOSE": "MTRANS", "TRIM": "GLÄTTEN", "TRUE": "WAHR", "UPPER": "GROSS",
+	"VALUETOTEXT": "WERTZUTEXT", "VSTACK": "VSTAPELN", "WRAPCOLS": "UMBRUCHSPALTEN",
+	"WRAPROWS": "UMBRUCHZEILEN",
+}}
+
+// French locale
+var French = &Locale{Name: "fr", ArgSep: ';', ColSep: '.', RowSep: ';', Decimal: ',', Functions: map[string]string{
+	"ADDRESS": "ADRESSE", "AND": "ET", "BIN2DEC": "BINDEC", "BIN2HEX": "BINHEX", "BIN2OCT": "BINOCT",
+	"BITAND": "BITET", "BITLSHIFT": "BITDECALG", "BITOR": "BITOU", "BITRSHIFT": "BITDECALD",
+	"BITXOR": "BITOUEXCLUSIF", "CHOOSE": "CHOISIR", "CHOOSECOLS": "CHOISIRCOLS",
+	"CHOOSEROWS": "CHOISIRLIGNES", "COLUMN": "COLONNE", "COLUMNS": "COLONNES", "COMPLEX": "COMPLEXE",
+	"CONCATENATE": "CONCATENER", "COUNT": "NB", "COUNTIF": "NB.SI", "DAVERAGE": "BDMOYENNE",
+	"DCOUNT": "BDNB", "DEC2BIN": "DECBIN", "DEC2HEX": "DECHEX", "DEC2OCT": "DECOCT", "DGET": "BDLIRE",
+	"DMAX": "BDMAX", "DMIN": "BDMIN", "DPRODUCT": "BDPRODUIT", "DROP": "EXCLURE",
+	"DSTDEV": "BDECARTYPE", "DSUM": "BDSOMME", "EXPAND": "DEVELOPPER", "FALSE": "FAUX",
+	"FIND": "TROUVE", "GESTEP": "SUP.SEUIL", "HEX2BIN": "HEXBIN", "HEX2DEC": "HEXDEC",
+	"HEX2OCT": "HEXOCT", "HSTACK": "ASSEMB.H", "IF": "SI", "IMABS": "COMPLEXE.MODULE",
+	"IMAGINARY": "COMPLEXE.IMAGINAIRE", "IMARGUMENT": "COMPLEXE.ARGUMENT",
+	"IMCONJUGATE": "COMPLEXE.CONJUGUE", "IMCOS": "COMPLEXE.COS", "IMCOSH": "COMPLEXE.COSH",
+	"IMCOT": "COMPLEXE.COT", "IMCSC": "COMPLEXE.CSC", "IMCSCH": "COMPLEXE.CSCH",
+	"IMDIV": "COMPLEXE.DIV", "IMEXP": "COMPLEXE.EXP", "IMLN": "COMPLEXE.LN",
+	"IMLOG10": "COMPLEXE.LOG10", "IMLOG2": "COMPLEXE.LOG2", "IMPOWER": "COMPLEXE.PUISSANCE",
+	"IMPRODUCT": "COMPLEXE.PRODUIT", "IMREAL": "COMPLEXE.REEL", "IMSEC": "COMPLEXE.SEC",
+	"IMSECH": "COMPLEXE.SECH", "IMSIN": "COMPLEXE.SIN", "IMSINH": "COMPLEXE.SINH",
+	"IMSQRT": "COMPLEXE.RACINE", "IMSUB": "COMPLEXE.DIFFERENCE", "IMSUM": "COMPLEXE.SOMME",
+	"IMTAN": "COMPLEXE.TAN", "LEFT": "GAUCHE", "LEN": "NBCAR", "LOWER": "MINUSCULE",
+	"MDETERM": "DETERMAT", "MID": "STXT", "MINVERSE": "INVERSEMAT", "MMULT": "PRODUITMAT",
+	"MUNIT": "MATRICE.UNITAIRE", "NOT": "NON", "NOW": "MAINTENANT", "OCT2BIN": "OCTBIN",
+	"OCT2DEC": "OCTDEC", "OCT2HEX": "OCTHEX", "OFFSET": "DECALER", "OR": "OU", "PROPER": "NOMPROPRE",
+	"RAND": "ALEA", "RANDBETWEEN": "ALEA.ENTRE.BORNES", "REGEXEXTRACT": "REGEX.EXTRAIRE",
+	"REGEXREPLACE": "REGEX.REMPLACER", "REGEXTEST": "REGEX.TEST", "REPLACE": "REMPLACER",
+	"RIGHT": "DROITE", "ROW": "LIGNE", "ROWS": "LIGNES", "SEARCH": "CHERCHE", "SUBSTITUTE": "SUBSTITUE",
+	"SUM": "SOMME", "SUMIF": "SOMME.SI", "SUMPRODUCT": "SOMMEPROD", "SUMX2MY2": "SOMME.X2MY2",
+	"SUMX2PY2": "SOMME.X2PY2", "SUMXMY2": "SOMME.XMY2", "TAKE": "PRENDRE", "TEXTAFTER": "TEXTE.APRES",
+	"TEXTBEFORE": "TEXTE.AVANT", "TEXTSPLIT": "FRACTIONNER.TEXTE", "TOCOL": "VERS.COL",
+	"TODAY": "AUJOURDHUI", "TOROW": "VERS.LIGNE", "TRIM": "SUPPRESPACE", "TRUE": "VRAI",
+	"UPPER": "MAJUSCULE", "VSTACK": "ASSEMB.V", "WRAPCOLS": "ORGA.COLS", "WRAPROWS": "ORGA.LIGNES",
+}}
+
+// Spanish locale
+var Spanish = &Locale{Name: "es", ArgSep: ';', ColSep: '\\', RowSep: ';', Decimal: ',', Functions: map[string]string{
+	"ADDRESS": "DIRECCION", "AND": "Y", "ARRAYTOTEXT": "MATRIZATEXTO", "BIN2DEC": "BIN.A.DEC",
+	"BIN2HEX": "BIN.A.HEX", "BIN2OCT": "BIN.A.OCT", "BITAND": "BIT.Y", "BITLSHIFT": "BIT.DESPLIZQDA",
+	"BITOR": "BIT.O", "BITRSHIFT": "BIT.DESPLDCHA", "BITXOR": "BIT.XO", "CHOOSE": "ELEGIR",
+	"CHOOSECOLS": "ELEGIRCOLS", "CHOOSEROWS": "ELEGIRFILAS", "COLUMN": "COLUMNA", "COLUMNS": "COLUMNAS",
+	"COMPLEX": "COMPLEJO", "CONCATENATE": "CONCATENAR", "CONVERT": "CONVERTIR", "COUNT": "CONTAR",
+	"COUNTIF": "CONTAR.SI", "DAVERAGE": "BDPROMEDIO", "DCOUNT": "BDCONTAR", "DEC2BIN": "DEC.A.BIN",
+	"DEC2HEX": "DEC.A.HEX", "DEC2OCT": "DEC.A.OCT", "DGET": "BDEXTRAER", "DMAX": "BDMAX",
+	"DMIN": "BDMIN", "DPRODUCT": "BDPRODUCTO", "DROP": "EXCLUIR", "DSTDEV": "BDDESVEST",
+	"DSUM": "BDSUMA", "EXACT": "IGUAL", "EXPAND": "EXPANDIR", "FALSE": "FALSO", "FIND": "ENCONTRAR",
+	"GESTEP": "MAYOR.O.IGUAL", "HEX2BIN": "HEX.A.BIN", "HEX2DEC": "HEX.A.DEC", "HEX2OCT": "HEX.A.OCT",
+	"HSTACK": "APILARH", "IF": "SI", "IMABS": "IM.ABS", "IMAGINARY": "IMAGINARIO",
+	"IMARGUMENT": "IM.ANGULO", "IMCONJUGATE": "IM.CONJUGADA", "IMCOS": "IM.COS", "IMCOSH": "IM.COSH",
+	"IMCOT": "IM.COT", "IMCSC": "IM.CSC", "IMCSCH": "IM.CSCH", "IMDIV": "IM.DIV", "IMEXP": "IM.EXP",
+	"IMLN": "IM.LN", "IMLOG10": "IM.LOG10", "IMLOG2": "IM.LOG2", "IMPOWER": "IM.POT",
+	"IMPRODUCT": "IM.PRODUCT", "IMREAL": "IM.REAL", "IMSEC": "IM.SEC", "IMSECH": "IM.SECH",
+	"IMSIN": "IM.SENO", "IMSINH": "IM.SENOH", "IMSQRT": "IM.RAIZ2", "IMSUB": "IM.SUSTR",
+	"IMSUM": "IM.SUM", "IMTAN": "IM.TAN", "INDIRECT": "INDIRECTO", "LEFT": "IZQUIERDA", "LEN": "LARGO",
+	"LOWER": "MINUSC", "MID": "EXTRAE", "MINVERSE": "MINVERSA", "MUNIT": "M.UNIDAD", "NOT": "NO",
+	"NOW": "AHORA", "OCT2BIN": "OCT.A.BIN", "OCT2DEC": "OCT.A.DEC", "OCT2HEX": "OCT.A.HEX",
+	"OFFSET": "DESREF", "OR": "O", "PROPER": "NOMPROPIO", "RAND": "ALEATORIO",
+	"RANDBETWEEN": "ALEATORIO.ENTRE", "REGEXEXTRACT": "REGEX.EXTRAER",
+	"REGEXREPLACE": "REGEX.REEMPLAZAR", "REGEXTEST": "REGEX.PRUEBA", "REPLACE": "REEMPLAZAR",
+	"REPT": "REPETIR", "RIGHT": "DERECHA", "ROW": "FILA", "ROWS": "FILAS", "SEARCH": "HALLAR",
+	"SUBSTITUTE": "SUSTITUIR", "SUM": "SUMA", "SUMIF": "SUMAR.SI", "SUMPRODUCT": "SUMAPRODUCTO",
+	"SUMX2MY2": "SUMAX2MENOSY2", "SUMX2PY2": "SUMAX2MASY2", "SUMXMY2": "SUMAXMENOSY2", "TAKE": "TOMAR",
+	"TEXTAFTER": "TEXTODESPUES", "TEXTBEFORE": "TEXTOANTES", "TEXTSPLIT": "DIVIDIRTEXTO",
+	"TOCOL": "ENCOL", "TODAY": "HOY", "TOROW": "ENFILA", "TRANSPOSE": "TRANSPONER", "TRIM": "ESPACIOS",
+	"TRUE": "VERDADERO", "UPPER": "MAYUSC", "VALUETOTEXT": "VALORATEXTO", "VSTACK": "APILARV",
+	"WRAPCOLS": "AJUSTARCOLS", "WRAPROWS": "AJUSTARFILAS",
+}}
+
+// Italian locale
+var Italian = &Locale{Name: "it", ArgSep: ';', ColSep: '.', RowSep: ';', Decimal: ',', Functions: map[string]string{
+	"ADDRESS": "INDIRIZZO", "AND": "E", "ARRAYTOTEXT": "MATRICE.A.TESTO", "BIN2DEC": "BINARIO.DECIMALE",
+	"BIN2HEX": "BINARIO.HEX", "BIN2OCT": "BINARIO.OCT", "BITAND": "BIT.AND",
+	"BITLSHIFT": "BIT.SPOSTA.SX", "BITOR": "BIT.OR", "BITRSHIFT": "BIT.SPOSTA.DX", "BITXOR": "BIT.XOR",
+	"CHOOSE": "SCEGLI", "CHOOSECOLS": "SCEGLI.COL", "CHOOSEROWS": "SCEGLI.RIGA",
+	"COLUMN": "RIF.COLONNA", "COLUMNS": "COLONNE", "COMPLEX": "COMPLESSO", "CONCATENATE": "CONCATENA",
+	"CONVERT": "CONVERTI", "COUNT": "CONTA.NUMERI", "COUNTIF": "CONTA.SE", "DAVERAGE": "DB.MEDIA",
+	"DCOUNT": "DB.CONTA.NUMERI", "DEC2BIN": "DECIMALE.BINARIO", "DEC2HEX": "DECIMALE.HEX",
+	"DEC2OCT": "DECIMALE.OCT", "DGET": "DB.VALORI", "DMAX": "DB.MAX", "DMIN": "DB.MIN",
+	"DPRODUCT": "DB.PRODOTTO", "DROP": "ESCLUDI", "DSTDEV": "DB.DEV.ST", "DSUM": "DB.SOMMA",
+	"EXACT": "IDENTICO", "EXPAND": "ESPANDI", "FALSE": "FALSO", "FIND": "TROVA", "GESTEP": "SOGLIA",
+	"HEX2BIN": "HEX.BINARIO", "HEX2DEC": "HEX.DECIMALE", "HEX2OCT": "HEX.OCT", "HSTACK": "STACK.ORIZ",
+	"IF": "SE", "IMABS": "COMP.MODULO", "IMAGINARY": "COMP.IMMAGINARIO", "IMARGUMENT": "COMP.ARGOMENTO",
+	"IMCONJUGATE": "COMP.CONIUGATO", "IMCOS": "COMP.COS", "IMCOSH": "COMP.COSH", "IMCOT": "COMP.COT",
+	"IMCSC": "COMP.CSC", "IMCSCH": "COMP.CSCH", "IMDIV": "COMP.DIV", "IMEXP": "COMP.EXP",
+	"IMLN": "COMP.LN", "IMLOG10": "COMP.LOG10", "IMLOG2": "COMP.LOG2", "IMPOWER": "COMP.POTENZA",
+	"IMPRODUCT": "COMP.PRODOTTO", "IMREAL": "COMP.PARTE.REALE", "IMSEC": "COMP.SEC",
+	"IMSECH": "COMP.SECH", "IMSIN": "COMP.SEN", "IMSINH": "COMP.SENH", "IMSQRT": "COMP.RADQ",
+	"IMSUB": "COMP.DIFF", "IMSUM": "COMP.SOMMA", "IMTAN": "COMP.TAN", "INDIRECT": "INDIRETTO",
+	"LEFT": "SINISTRA", "LEN": "LUNGHEZZA", "LOWER": "MINUSC", "MDETERM": "MATR.DETERM",
+	"MID": "STRINGA.ESTRAI", "MINVERSE": "MATR.INVERSA", "MMULT": "MATR.PRODOTTO", "MUNIT": "MATR.UNIT",
+	"NOT": "NON", "NOW": "ADESSO", "OCT2BIN": "OCT.BINARIO", "OCT2DEC": "OCT.DECIMALE",
+	"OCT2HEX": "OCT.HEX", "OFFSET": "SCARTO", "OR": "O", "PROPER": "MAIUSC.INIZ", "RAND": "CASUALE",
+	"RANDBETWEEN": "CASUALE.TRA", "REGEXEXTRACT": "REGEX.ESTRAI", "REGEXREPLACE": "REGEX.SOSTITUISCI",
+	"REGEXTEST": "REGEX.TEST", "REPLACE": "RIMPIAZZA", "REPT": "RIPETI", "RIGHT": "DESTRA",
+	"ROW": "RIF.RIGA", "ROWS": "RIGHE", "SEARCH": "RICERCA", "SUBSTITUTE": "SOSTITUISCI",
+	"SUM": "SOMMA", "SUMIF": "SOMMA.SE", "SUMPRODUCT": "MATR.SOMMA.PRODOTTO",
+	"SUMX2MY2": "SOMMA.DIFF.Q", "SUMX2PY2": "SOMMA.SOMMA.Q", "SUMXMY2": "SOMMA.Q.DIFF",
+	"TAKE": "INCLUDI", "TEXTAFTER": "TESTO.SUCCESSIVO", "TEXTBEFORE": "TESTO.PRECEDENTE",
+	"TEXTSPLIT": "DIVIDI.TESTO", "TOCOL": "A.COL", "TODAY": "OGGI", "TOROW": "A.RIGA",
+	"TRANSPOSE": "MATR.TRASPOSTA", "TRIM": "ANNULLA.SPAZI", "TRUE": "VERO", "UPPER": "MAIUSC",
+	"VALUETOTEXT": "VALORE.A.TESTO", "VSTACK": "STACK.VERT", "WRAPCOLS": "DISPONI.COL",
+	"WRAPROWS": "DISPONI.RIGA",
+}}
+
+// Portuguese locale as used in Brazil
+var Portuguese = &Locale{Name: "pt", ArgSep: ';', ColSep: '\\', RowSep: ';', Decimal: ',', Functions: map[string]string{
+	"ADDRESS": "ENDEREÇO", "AND": "E", "ARRAYTOTEXT": "MATRIZPARATEXTO", "BIN2DEC": "BINADEC",
+	"BIN2HEX": "BINAHEX", "BIN2OCT": "BINAOCT", "BITLSHIFT": "DESLOCESQBIT",
+	"BITRSHIFT": "DESLOCDIRBIT", "CHOOSE": "ESCOLHER", "CHOOSECOLS": "ESCOLHERCOLS",
+	"CHOOSEROWS": "ESCOLHERLINS", "COLUMN": "COL", "COLUMNS": "COLS", "COMPLEX": "COMPLEXO",
+	"CONCATENATE": "CONCATENAR", "CONVERT": "CONVERTER", "COUNT": "CONT.NÚM", "COUNTIF": "CONT.SE",
+	"DAVERAGE": "BDMÉDIA", "DCOUNT": "BDCONTAR", "DEC2BIN": "DECABIN", "DEC2HEX": "DECAHEX",
+	"DEC2OCT": "DECAOCT", "DGET": "BDEXTRAIR", "DMAX": "BDMÁX", "DMIN": "BDMÍN",
+	"DPRODUCT": "BDMULTIPL", "DROP": "DESCARTAR", "DSTDEV": "BDEST", "DSUM": "BDSOMA", "EXACT": "EXATO",
+	"EXPAND": "EXPANDIR", "FALSE": "FALSO", "FIND": "PROCURAR", "GESTEP": "DEGRAU",
+	"HEX2BIN": "HEXABIN", "HEX2DEC": "HEXADEC", "HEX2OCT": "HEXAOCT", "HSTACK": "EMPILHARH", "IF": "SE",
+	"IMAGINARY": "IMAGINÁRIO", "IMARGUMENT": "IMARG", "IMCONJUGATE": "IMCONJ", "IMCSC": "IMCOSEC",
+	"IMCSCH": "IMCOSECH", "IMPOWER": "IMPOT", "IMPRODUCT": "IMPROD", "IMSIN": "IMSENO",
+	"IMSINH": "IMSENH", "IMSQRT": "IMRAIZ", "IMSUB": "IMSUBTR", "IMSUM": "IMSOMA",
+	"INDIRECT": "INDIRETO", "LEFT": "ESQUERDA", "LEN": "NÚM.CARACT", "LOWER": "MINÚSCULA",
+	"MDETERM": "MATRIZ.DETERM", "MID": "EXT.TEXTO", "MINVERSE": "MATRIZ.INVERSO",
+	"MMULT": "MATRIZ.MULT", "NOT": "NÃO", "NOW": "AGORA", "OCT2BIN": "OCTABIN", "OCT2DEC": "OCTADEC",
+	"OCT2HEX": "OCTAHEX", "OFFSET": "DESLOC", "OR": "OU", "PROPER": "PRI.MAIÚSCULA",
+	"RAND": "ALEATÓRIO", "RANDBETWEEN": "ALEATÓRIOENTRE", "REGEXEXTRACT": "REGEX.EXTRAIR",
+	"REGEXREPLACE": "REGEX.SUBSTITUIR", "REGEXTEST": "REGEX.TESTE", "REPLACE": "MUDAR",
+	"RIGHT": "DIREITA", "ROW": "LIN", "ROWS": "LINS", "SEARCH": "LOCALIZAR", "SUBSTITUTE": "SUBSTITUIR",
+	"SUM": "SOMA", "SUMIF": "SOMASE", "SUMPRODUCT": "SOMARPRODUTO", "SUMX2MY2": "SOMAX2DY2",
+	"SUMX2PY2": "SOMAX2SY2", "SUMXMY2": "SOMAXMY2", "TAKE": "PEGAR", "TEXTAFTER": "TEXTODEPOIS",
+	"TEXTBEFORE": "TEXTOANTES", "TEXTSPLIT": "DIVIDIRTEXTO", "TOCOL": "PARACOL", "TODAY": "HOJE",
+	"TOROW": "PARALIN", "TRANSPOSE": "TRANSPOR", "TRIM": "ARRUMAR", "TRUE": "VERDADEIRO",
+	"UPPER": "MAIÚSCULA", "VALUETOTEXT": "VALORPARATEXTO", "VSTACK": "EMPILHARV",
+	"WRAPCOLS": "QUEBRARCOLS", "WRAPROWS": "QUEBRARLINS",
+}}
+
+// Parse parses formula written in the locale like efp.Parse does for English
+func (l *Locale) Parse(r io.WriterTo) (gval.Evaluable, error) {
+	var sb strings.Builder
+	r.WriteTo(&sb)
+	formula, err := l.Delocalize(sb.String())
+	if err != nil {
+		return nil, err
+	}
+	return parse(formula, 0)
+}
+
+// Localize converts formula from English to the locale
+func (l *Locale) Localize(formula string) (string, error) {
+	return convertLocale(formula, English, l)
+}
+
+// Delocalize converts formula written in the locale to English
+func (l *Locale) Delocalize(formula string) (string, error) {
+	return convertLocale(formula, l, English)
+}
+
+// FormatValue returns value as text like FormatValue using the decimal
+// separator of the locale
+func (l *Locale) FormatValue(v interface{}) string {
+	if arr, ok := v.(Array); ok {
+		local := make(Array, len(arr))
+		for i, row := range arr {
+			local[i] = make([]interface{}, len(row))
+			for j, e := range row {
+				if _, ok := asNumber(e); ok {
+					e = l.FormatValue(e)
+				}
+				local[i][j] = e
+			}
+		}
+		return FormatValue(local)
+	}
+	s := FormatValue(v)
+	if _, ok := asNumber(v); ok {
+		s = strings.Replace(s, ".", string(l.Decimal), 1)
+	}
+	return s
+}
+
+// function returns the name of function in the locale
+func (l *Locale) function(english string) string {
+	if name, ok := l.Functions[english]; ok {
+		return name
+	}
+	return english
+}
+
+// english returns the English name of function named name in the locale
+func (l *Locale) english(name string) string {
+	for en, local := range l.Functions {
+		if local == name {
+			return en
+		}
+	}
+	return name
+}
+
+// convertLocale rewrites formula written in locale from to locale to.
+// Strings, sheet names and the text between square brackets are copied as
+// they are
+func convertLocale(formula string, from, to *Locale) (string, error) {
+	rs := []rune(formula)
+	var sb strings.Builder
+	inArray := false
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		// A number starts a token unless it continues a name like A1
+		startsToken := i == 0 || !isWordRune(rs[i-1]) || (inArray && rs[i-1] == from.ColSep)
+		switch {
+		case r == '"' || r == '\'' || r == '[':
+			j := closing(rs, i)
+			if j < 0 {
+				return "", fmt.Errorf("unterminated %c in formula %q", r, formula)
+			}
+			sb.WriteString(string(rs[i : j+1]))
+			i = j + 1
+		case r == '{' || r == '}':
+			inArray = r == '{'
+			sb.WriteRune(r)
+			i++
+		case startsToken && (unicode.IsDigit(r) || (r == from.Decimal && i+1 < len(rs) && unicode.IsDigit(rs[i+1]))):
+			i = convertNumber(rs, i, from, to, &sb)
+		case inArray && r == from.ColSep:
+			sb.WriteRune(to.ColSep)
+			i++
+		case inArray && r == from.RowSep:
+			sb.WriteRune(to.RowSep)
+			i++
+		case !inArray && r == from.ArgSep:
+			sb.WriteRune(to.ArgSep)
+			i++
+		case isWordStart(r):
+			j := i
+			for j < len(rs) && isWordRune(rs[j]) && !(inArray && rs[j] == from.ColSep) {
+				j++
+			}
+			word := string(rs[i:j])
+			upper := strings.ToUpper(word)
+			en := from.english(upper)
+			if j < len(rs) && rs[j] == '(' || en == "TRUE" || en == "FALSE" {
+				if name := to.function(en); name != upper {
+					word = name
+				}
+			}
+			sb.WriteString(word)
+			i = j
+		default:
+			sb.WriteRune(r)
+			i++
+		}
+	}
+	return sb.String(), nil
+}
+
+// closing returns the position of the quote or bracket closing the one at i,
+// -1 if there is none. Quotes are escaped by doubling them, see lexBrackets
+// for brackets
+func closing(rs []rune, i int) int {
+	if rs[i] == '[' {
+		if n := lexBrackets(rs, i); n > 0 {
+			return n - 1
+		}
+		return -1
+	}
+	for j := i + 1; j < len(rs); j++ {
+		if rs[j] != rs[i] {
+			continue
+		}
+		if j+1 < len(rs) && rs[j+1] == rs[i] {
+			j++
+			continue
+		}
+		return j
+	}
+	return -1
+}
+
+// convertNumber copies the number starting at i replacing its decimal
+// separator. Returns the position following the number
+func convertNumber(rs []rune, i int, from, to *Locale, sb *strings.Builder) int {
+	digits := func(j int) int {
+		for j < len(rs) && unicode.IsDigit(rs[j]) {
+			j++
+		}
+		return j
+	}
+	j := digits(i)
+	sb.WriteString(string(rs[i:j]))
+	if j+1 < len(rs) && rs[j] == from.Decimal && unicode.IsDigit(rs[j+1]) {
+		k := digits(j + 1)
+		sb.WriteRune(to.Decimal)
+		sb.WriteString(string(rs[j+1 : k]))
+		j = k
+	}
+	if j < len(rs) && (rs[j] == 'e' || rs[j] == 'E') {
+		k := j + 1
+		if k < len(rs) && (rs[k] == '+' || rs[k] == '-') {
+			k++
+		}
+		if k < len(rs) && unicode.IsDigit(rs[k]) {
+			k = digits(k)
+			sb.WriteString(string(rs[j:k]))
+			j = k
+		}
+	}
+	return j
+}
@@ -0,0 +1,92 @@
+package efp
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestLocale(t *testing.T) {
+	tt := []struct {
+		loc     *Locale
+		english string
+		local   string
+	}{
+		{German, "=SUM(A1,B1)", "=SUMME(A1;B1)"},
+		{German, "=IF(A1>1.5,TRUE,SUM({1.5,2;3,4}))", "=WENN(A1>1,5;WAHR;SUMME({1,5.2;3.4}))"},
+		{German, `=CONCATENATE("a,b",'Q1, Data'!A1,1E+3)`, `=VERKETTEN("a,b";'Q1, Data'!A1;1E+3)`},
+		{French, "=COUNTIF(A1:A5,\">0.5\")+.25", "=NB.SI(A1:A5;\">0.5\")+,25"},
+		{Spanish, "=SUM({1,2.5;3,4})", "=SUMA({1\\2,5;3\\4})"},
+		{German, "=SUM({1,2;3,4})", "=SUMME({1.2;3.4})"},
+		{Italian, `=ROWS({"a,b";"c.d"})`, `=RIGHE({"a,b";"c.d"})`},
+		{Portuguese, "=TRANSPOSE({1.5,-2;TRUE,#N/A})", "=TRANSPOR({1,5\\-2;VERDADEIRO\\#N/A})"},
+		{Italian, "=OR(FALSE,NOT(B2))", "=O(FALSO;NON(B2))"},
+		{Portuguese, "=LEN(UPPER(name))", "=NÚM.CARACT(MAIÚSCULA(name))"},
+		{German, "=sum(A1)+myFunc(2)", "=SUMME(A1)+myFunc(2)"},
+		{German, "=SUMPRODUCT(A1:A3,B1:B3)+MDETERM(MINVERSE(C1:D2))", "=SUMMENPRODUKT(A1:A3;B1:B3)+MDET(MINV(C1:D2))"},
+		{German, "=TRANSPOSE(VSTACK(A1:B1,A2:B2))", "=MTRANS(VSTAPELN(A1:B1;A2:B2))"},
+		{Italian, `=TEXTSPLIT(A1,",")`, `=DIVIDI.TESTO(A1;",")`},
+		{Spanish, `=IMSUM(COMPLEX(1,2),DEC2BIN(A1))`, `=IM.SUM(COMPLEJO(1;2);DEC.A.BIN(A1))`},
+		{French, `=DSUM(A1:C5,"Qty",E1:E2)`, `=BDSOMME(A1:C5;"Qty";E1:E2)`},
+		{German, "=OFFSET(A1,1,0)+ROWS(A1:A3)", "=BEREICH.VERSCHIEBEN(A1;1;0)+ZEILEN(A1:A3)"},
+		{German, `=IF(REGEXTEST(A1,"\d"),REGEXEXTRACT(A1,"\d+"),REGEXREPLACE(A1,"a","b"))`, `=WENN(REGEXTEST(A1;"\d");REGEXEXTRAHIEREN(A1;"\d+");REGEXERSETZEN(A1;"a";"b"))`},
+		{Spanish, `=REGEXTEST(A1,"^x")`, `=REGEX.PRUEBA(A1;"^x")`},
+		{Portuguese, `=REGEXREPLACE(A1,"a","b")`, `=REGEX.SUBSTITUIR(A1;"a";"b")`},
+	}
+	var errCnt int
+	for _, tu := range tt {
+		local, err := tu.loc.Localize(tu.english)
+		if err != nil || local != tu.local {
+			t.Logf("Test: %v, Expected: %v, Got: %v %v", tu.english, tu.local, local, err)
+			errCnt++
+		}
+		english, err := tu.loc.Delocalize(tu.local)
+		if want := strings.Replace(tu.english, "sum(", "SUM(", 1); err != nil || english != want {
+			t.Logf("Test: %v, Expected: %v, Got: %v %v", tu.local, want, english, err)
+			errCnt++
+		}
+	}
+	if errCnt > 0 {
+		t.Errorf("Failed %v of %v test cases", errCnt, 2*len(tt))
+	}
+}
+
+func TestLocaleParse(t *testing.T) {
+	tt := []struct {
+		loc     *Locale
+		formula string
+		out     interface{}
+	}{
+		{German, "=SUMME(1,5;2;x)", 6.5},
+		{French, "=SI(x>2;\"oui\";\"non\")", "oui"},
+		{Spanish, "=SUMA(1,5;x)", 4.5},
+		{German, "=SUMME({1.2;3.4})", 10.0},
+		{German, "=SUMME({1,5.2})+x", 6.5},
+		{Spanish, "=SUMAPRODUCTO({1\\2};{3\\4})", 11.0},
+		{French, "=LIGNES({1;2;3})", 3.0},
+		{German, `=REGEXEXTRAHIEREN("ab12c";"\d+")`, "12"},
+		{French, `=REGEX.TEST("abc";"^a")`, true},
+		{English, "=SUM(1.5,2)", 3.5},
+	}
+	var errCnt int
+	for _, tu := range tt {
+		eval, err := tu.loc.Parse(strings.NewReader(tu.formula))
+		if err != nil {
+			t.Logf("Test: %v, Parse failed, Error: %v", tu.formula, err)
+			errCnt++
+			continue
+		}
+		v, err := eval(context.Background(), map[string]interface{}{"x": 3.0})
+		if err != nil || v != tu.out {
+			t.Logf("Test: %v, Expected: %v, Got: %v %v", tu.formula, tu.out, v, err)
+			errCnt++
+		}
+	}
+	if s := German.FormatValue(Array{{1.5, "a.b"}}); s != "1,5\ta.b" {
+		t.Logf("Test: FormatValue, Expected: %q, Got: %q", "1,5\ta.b", s)
+		errCnt++
+	}
+	if errCnt > 0 {
+		t.Errorf("Failed %v of %v test cases", errCnt, len(tt)+1)
+	}
+}
@@ -0,0 +1,184 @@
+// Copyright © 2019 Praveen Tirumandyam praveen.tirumandyam@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package efp
+
+import (
+	"context"
+	"strconv"
+	"strings"
+)
+
+// Address implements Excel's ADDRESS function. abs selects the absolute parts
+// of the address: 1 both, 2 the row, 3 the column and 4 neither. When a1 is
+// false the address is in R1C1 notation with relative parts like R[2]C[3].
+// The address is qualified by sheet unless it is empty
+func Address(row, col, abs int, a1 bool, sheet string) (string, error) {
+	if row < 1 || row > MaxRows || col < 1 || col > MaxColumns || abs < 1 || abs > 4 {
+		return "", ErrValue
+	}
+	rowAbs, colAbs := abs == 1 || abs == 2, abs == 1 || abs == 3
+	var sb strings.Builder
+	if sheet != "" {
+		sb.WriteString(quoteSheet(sheet) + "!")
+	}
+	if a1 {
+		sb.WriteString(CellRef{Row: row, Col: col, RowAbs: rowAbs, ColAbs: colAbs}.String())
+		return sb.String(), nil
+	}
+	axis := func(letter string, n int, abs bool) {
+		sb.WriteString(letter)
+		if abs {
+			sb.WriteString(strconv.Itoa(n))
+			return
+		}
+		sb.WriteString("[" + strconv.Itoa(n) + "]")
+	}
+	axis("R", row, rowAbs)
+	axis("C", col, colAbs)
+	return sb.String(), nil
+}
+
+// Choose implements Excel's CHOOSE function returning the value at 1 based
+// index
+func Choose(index int, values ...interface{}) (interface{}, error) {
+	if index < 1 || index > len(values) {
+		return nil, ErrValue
+	}
+	return values[index-1], nil
+}
+
+// Offset implements Excel's OFFSET function. Returns the reference of height
+// rows and width columns moved rows down and cols right from the top left of
+// ref. Returns ErrRef if the reference falls outside the sheet
+func Offset(ref Ref, rows, cols, height, width int) (Ref, error) {
+	if height < 1 || width < 1 || ref.LastSheet != "" {
+		return Ref{}, ErrRef
+	}
+	top, left, _, _ := ref.normalize().bounds()
+	top, left = top+rows, left+cols
+	bottom, right := top+height-1, left+width-1
+	if top < 1 || left < 1 || bottom > MaxRows || right > MaxColumns {
+		return Ref{}, ErrRef
+	}
+	out := Ref{Sheet: ref.Sheet, From: CellRef{Row: top, Col: left}, To: CellRef{Row: bottom, Col: right}}
+	// Moving whole columns sideways keeps them whole
+	if top == 1 && bottom == MaxRows {
+		out.From.Row, out.To.Row = 0, 0
+	}
+	if left == 1 && right == MaxColumns {
+		out.From.Col, out.To.Col = 0, 0
+	}
+	return out, nil
+}
+
+// offset evaluates OFFSET for the reference given to it. height and width
+// default to the size of ref
+func offset(ref interface{}, rows, cols float64, size []float64) (Ref, error) {
+	r, ok := ref.(Ref)
+	if !ok {
+		return Ref{}, ErrValue
+	}
+	top, left, bottom, right := r.normalize().bounds()
+	height, width := bottom-top+1, right-left+1
+	if len(size) > 0 {
+		height = int(size[0])
+	}
+	if len(size) > 1 {
+		width = int(size[1])
+	}
+	return Offset(r, int(rows), int(cols), height, width)
+}
+
+// indirect evaluates INDIRECT parsing text as a reference in A1 notation or
+// else R1C1 notation relative to the cell being evaluated. Returns ErrRef if
+// text is not a reference
+func indirect(c context.Context, text string, a1 []bool) ([]Ref, error) {
+	r1c1 := len(a1) > 0 && !a1[0]
+	refs, err := parseRefs(c, strings.TrimSpace(text), r1c1)
+	if err != nil {
+		if e, ok := err.(ErrorValue); ok {
+			return nil, e
+		}
+		return nil, ErrRef
+	}
+	return refs, nil
+}
+
+// lines evaluates ROW when rows is set and else COLUMN. Without a reference
+// it is the row or column of the cell being evaluated. A reference spanning
+// several rows or columns gives an Array of their numbers
+func lines(c context.Context, ref []interface{}, rows bool) (interface{}, error) {
+	if len(ref) == 0 {
+		host, ok := hostFrom(c)
+		if !ok {
+			return nil, ErrValue
+		}
+		if rows {
+			return float64(host.Row), nil
+		}
+		return float64(host.Col), nil
+	}
+	r, ok := ref[0].(Ref)
+	if !ok || len(ref) > 1 {
+		return nil, ErrValue
+	}
+	top, left, bottom, right := r.normalize().bounds()
+	first, last := left, right
+	if rows {
+		first, last = top, bottom
+	}
+	if first == last {
+		return float64(first), nil
+	}
+	if err := checkArraySize(c, float64(last-first+1)); err != nil {
+		return nil, err
+	}
+	arr := make(Array, 0, last-first+1)
+	for n := first; n <= last; n++ {
+		if rows {
+			arr = append(arr, []interface{}{float64(n)})
+			continue
+		}
+		if len(arr) == 0 {
+			arr = append(arr, nil)
+		}
+		arr[0] = append(arr[0], float64(n))
+	}
+	return arr, nil
+}
+
+// dimension evaluates ROWS when rows is set and else COLUMNS for a reference or an
+// array
+func dimension(v interface{}, rows bool) (float64, error) {
+	switch val := v.(type) {
+	case Ref:
+		top, left, bottom, right := val.normalize().bounds()
+		if rows {
+			return float64(bottom - top + 1), nil
+		}
+		return float64(right - left + 1), nil
+	case Areas:
+		return 0, ErrRef
+	case Array:
+		if rows {
+			return float64(len(val)), nil
+		}
+		if len(val) == 0 {
+			return 0, nil
+		}
+		return float64(len(val[0])), nil
+	}
+	return 1, nil
+}
@@ -0,0 +1,135 @@
+package efp
+
+import (
+	"context"
+	"strconv"
+	"testing"
+)
+
+func TestAddress(t *testing.T) {
+	tt := []struct {
+		row, col, abs int
+		a1            bool
+		sheet         string
+		out           string
+		err           error
+	}{
+		{2, 3, 1, true, "", "$C$2", nil},
+		{2, 3, 2, true, "", "C$2", nil},
+		{2, 3, 3, true, "", "$C2", nil},
+		{2, 3, 4, true, "", "C2", nil},
+		{2, 3, 1, false, "", "R2C3", nil},
+		{2, 3, 4, false, "", "R[2]C[3]", nil},
+		{1, 28, 1, true, "Q1 Data", "'Q1 Data'!$AB$1", nil},
+		{0, 1, 1, true, "", "", ErrValue},
+		{1, 1, 5, true, "", "", ErrValue},
+	}
+	var errCnt int
+	for _, tu := range tt {
+		out, err := Address(tu.row, tu.col, tu.abs, tu.a1, tu.sheet)
+		if out != tu.out || err != tu.err {
+			t.Logf("Test: %v, Expected: %v %v, Got: %v %v", tu, tu.out, tu.err, out, err)
+			errCnt++
+		}
+	}
+	if errCnt > 0 {
+		t.Errorf("Failed %v of %v test cases", errCnt, len(tt))
+	}
+}
+
+func TestOffset(t *testing.T) {
+	tt := []struct {
+		ref                       string
+		rows, cols, height, width int
+		out                       string
+		err                       error
+	}{
+		{"A1", 1, 2, 1, 1, "C2", nil},
+		{"B2:C3", -1, -1, 3, 1, "A1:A3", nil},
+		{"Data!A1", 0, 0, 2, 2, "Data!A1:B2", nil},
+		{"A:A", 0, 1, MaxRows, 1, "B:B", nil},
+		{"A1", -1, 0, 1, 1, "", ErrRef},
+		{"A1", 0, 0, 0, 1, "", ErrRef},
+	}
+	var errCnt int
+	for _, tu := range tt {
+		ref, _ := ParseRef(tu.ref)
+		out, err := Offset(ref, tu.rows, tu.cols, tu.height, tu.width)
+		if err != tu.err || (err == nil && out.String() != tu.out) {
+			t.Logf("Test: %v, Expected: %v %v, Got: %v %v", tu.ref, tu.out, tu.err, out, err)
+			errCnt++
+		}
+	}
+	if errCnt > 0 {
+		t.Errorf("Failed %v of %v test cases", errCnt, len(tt))
+	}
+}
+
+func TestLookupFunctions(t *testing.T) {
+	for _, cache := range []*Cache{nil, NewCache(100)} {
+		wb := NewWorkbook()
+		wb.Cache = cache
+		s := wb.AddSheet("Sheet1")
+		other := wb.AddSheet("Q1 Data")
+		for row := 1; row <= 5; row++ {
+			for col := 1; col <= 3; col++ {
+				s.SetValue(ColumnName(col)+strconv.Itoa(row), float64(row*10+col))
+			}
+		}
+		other.SetValue("B2", 7.0)
+		s.SetValue("D1", "B2")
+		tt := []struct {
+			cell    string
+			formula string
+			out     interface{}
+		}{
+			{"F1", "SUM(OFFSET(A1,1,1,2,2))", 22.0 + 23.0 + 32.0 + 33.0},
+			{"F2", "OFFSET(A1,4,2)", 53.0},
+			{"F3", "OFFSET(A1,-1,0)", ErrRef},
+			{"F4", "INDIRECT(D1)*2", 44.0},
+			{"F5", "SUM(INDIRECT(\"A1:A5\"))", 155.0},
+			{"F6", "INDIRECT(\"'Q1 Data'!B2\")", 7.0},
+			{"F7", "INDIRECT(\"R[-6]C[-5]\",FALSE)", 11.0},
+			{"F8", "INDIRECT(\"not a ref\")", ErrRef},
+			{"F9", "ROW()", 9.0},
+			{"F10", "COLUMN(C7)", 3.0},
+			{"F11", "ROWS(A1:C5)*COLUMNS(A1:C5)", 15.0},
+			{"F12", "ROW(OFFSET(A1,3,0))", 4.0},
+			{"F13", "COLUMNS(INDIRECT(\"A1:B9\"))", 2.0},
+			{"F14", "SUM(ROW(A1:A3))", 6.0},
+			{"F15", "ADDRESS(ROW(),COLUMN(),4)", "F15"},
+			{"F16", "ADDRESS(1,1,1,TRUE,\"Q1 Data\")", "'Q1 Data'!$A$1"},
+			{"F17", "CHOOSE(2,\"a\",B1,\"c\")", 12.0},
+			{"F18", "SUM(CHOOSE(1,A1:A5,B1:B5))", 155.0},
+			{"F19", "CHOOSE(4,1,2,3)", ErrValue},
+			{"F20", "ROWS(7)", 1.0},
+			{"F21", "SUM(OFFSET(F21,0,1))", 1.0},
+			{"G21", "1", 1.0},
+			{"F22", "ADDRESS(1,1,,FALSE)", "R1C1"},
+		}
+		for _, tu := range tt {
+			s.SetFormula(tu.cell, tu.formula)
+		}
+		var errCnt int
+		for _, parallel := range []bool{false, true} {
+			var err error
+			if parallel {
+				err = wb.RecalculateParallel(context.Background(), 4)
+			} else {
+				err = wb.Recalculate(context.Background())
+			}
+			if err != nil {
+				t.Fatalf("Recalculate failed, Error: %v", err)
+			}
+			for _, tu := range tt {
+				if v := s.Cell(tu.cell).Value; v != tu.out {
+					t.Logf("Test: %v, Expected: %v, Got: %v", tu.formula, tu.out, v)
+					errCnt++
+				}
+			}
+		}
+		if errCnt > 0 {
+			t.Errorf("Failed %v of %v test cases", errCnt, 2*len(tt))
+		}
+	}
+}
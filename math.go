@@ -0,0 +1,290 @@
+// Copyright © 2019 Praveen Tirumandyam praveen.tirumandyam@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package efp
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Sum implements Excel's SUM function. Text and booleans inside arrays are
+// ignored while those passed directly are converted to numbers
+func Sum(args ...interface{}) (float64, error) {
+	var total float64
+	for _, arg := range args {
+		if areas, ok := arg.(Areas); ok {
+			for _, a := range areas {
+				n, err := Sum(a)
+				if err != nil {
+					return 0, err
+				}
+				total += n
+			}
+			continue
+		}
+		if arr, ok := arg.(Array); ok {
+			for _, row := range arr {
+				for _, v := range row {
+					if e, ok := v.(ErrorValue); ok {
+						return 0, e
+					}
+					if n, ok := asNumber(v); ok {
+						total += n
+					}
+				}
+			}
+			continue
+		}
+		n, err := toNumber(arg)
+		if err != nil {
+			return 0, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// Count implements Excel's COUNT function
+func Count(args ...interface{}) int {
+	cnt := 0
+	for _, arg := range args {
+		if areas, ok := arg.(Areas); ok {
+			for _, a := range areas {
+				cnt += Count(a)
+			}
+			continue
+		}
+		if arr, ok := arg.(Array); ok {
+			for _, row := range arr {
+				for _, v := range row {
+					if _, ok := asNumber(v); ok {
+						cnt++
+					}
+				}
+			}
+			continue
+		}
+		if arg == nil {
+			continue
+		}
+		if _, err := toNumber(arg); err == nil {
+			cnt++
+		}
+	}
+	return cnt
+}
+
+// SumIf implements Excel's SUMIF function. Cells of rng matching crit select
+// the cells at same position in sumRng to be added. Pass nil sumRng to add
+// the matching cells of rng
+func SumIf(rng Array, crit interface{}, sumRng Array) (float64, error) {
+	if sumRng == nil {
+		sumRng = rng
+	}
+	match := criteria(crit)
+	var total float64
+	for i, row := range rng {
+		for j, v := range row {
+			if !match(v) || i >= len(sumRng) || j >= len(sumRng[i]) {
+				continue
+			}
+			if e, ok := sumRng[i][j].(ErrorValue); ok {
+				return 0, e
+			}
+			if n, ok := asNumber(sumRng[i][j]); ok {
+				total += n
+			}
+		}
+	}
+	return total, nil
+}
+
+// CountIf implements Excel's COUNTIF function
+func CountIf(rng Array, crit interface{}) int {
+	match := criteria(crit)
+	cnt := 0
+	for _, row := range rng {
+		for _, v := range row {
+			if match(v) {
+				cnt++
+			}
+		}
+	}
+	return cnt
+}
+
+// toArray wraps a single value in 1x1 Array so that functions expecting a
+// range also accept a single cell
+func toArray(v interface{}) Array {
+	if arr, ok := v.(Array); ok {
+		return arr
+	}
+	return Array{{v}}
+}
+
+// asNumber returns number stored in value. Unlike toNumber text and booleans
+// are not converted
+func asNumber(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float32:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+// criteria builds the predicate for criteria used by SUMIF, COUNTIF and
+// similar functions. Criteria is either a value to match or text starting with
+// one of the comparison operators =, <>, <, <=, > or >=. Text is matched
+// ignoring case and may use the wildcards * and ?, escaped with ~
+func criteria(crit interface{}) func(v interface{}) bool {
+	s, ok := crit.(string)
+	if !ok {
+		if n, ok := asNumber(crit); ok {
+			crit = n
+		}
+		return func(v interface{}) bool {
+			return equalCriteria(v, crit)
+		}
+	}
+	op := ""
+	for _, p := range []string{"<=", ">=", "<>", "<", ">", "="} {
+		if strings.HasPrefix(s, p) {
+			op, s = p, s[len(p):]
+			break
+		}
+	}
+	operand := criteriaOperand(s)
+	switch op {
+	case "", "=":
+		if s == "" {
+			return func(v interface{}) bool { return v == nil || v == "" }
+		}
+		if text, ok := operand.(string); ok {
+			re := wildcard(text)
+			return func(v interface{}) bool {
+				str, ok := v.(string)
+				return ok && re.MatchString(str)
+			}
+		}
+		return func(v interface{}) bool { return equalCriteria(v, operand) }
+	case "<>":
+		if s == "" {
+			return func(v interface{}) bool { return v != nil && v != "" }
+		}
+		if text, ok := operand.(string); ok {
+			re := wildcard(text)
+			return func(v interface{}) bool {
+				str, ok := v.(string)
+				return !ok || !re.MatchString(str)
+			}
+		}
+		return func(v interface{}) bool { return !equalCriteria(v, operand) }
+	}
+	return func(v interface{}) bool {
+		if v == nil {
+			return false
+		}
+		// Only values of same kind as the operand are compared
+		if _, ok := operand.(float64); ok {
+			if _, ok := asNumber(v); !ok {
+				return false
+			}
+		} else if _, ok := operand.(string); ok {
+			if _, ok := v.(string); !ok {
+				return false
+			}
+		}
+		c, err := compareValues(v, operand)
+		if err != nil {
+			return false
+		}
+		switch op {
+		case "<":
+			return c < 0
+		case "<=":
+			return c <= 0
+		case ">":
+			return c > 0
+		}
+		return c >= 0
+	}
+}
+
+// criteriaOperand returns the value the text of criteria following its
+// operator stands for: a number, a boolean or else the text itself
+func criteriaOperand(s string) interface{} {
+	if n, err := strconv.ParseFloat(strings.TrimSpace(s), 64); err == nil {
+		return n
+	}
+	if strings.EqualFold(s, "TRUE") || strings.EqualFold(s, "FALSE") {
+		return strings.EqualFold(s, "TRUE")
+	}
+	return s
+}
+
+// equalCriteria compares value with numeric or boolean criteria. Numeric
+// text in cells matches numeric criteria as it does in Excel
+func equalCriteria(v, operand interface{}) bool {
+	switch o := operand.(type) {
+	case float64:
+		if n, ok := asNumber(v); ok {
+			return n == o
+		}
+		if s, ok := v.(string); ok {
+			n, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+			return err == nil && n == o
+		}
+		return false
+	case bool:
+		b, ok := v.(bool)
+		return ok && b == o
+	case string:
+		s, ok := v.(string)
+		return ok && strings.EqualFold(s, o)
+	}
+	return v == operand
+}
+
+// wildcard compiles Excel wildcard pattern into case insensitive regular
+// expression matching the whole text
+func wildcard(pattern string) *regexp.Regexp {
+	var sb strings.Builder
+	sb.WriteString("(?is)^")
+	rs := []rune(pattern)
+	for i := 0; i < len(rs); i++ {
+		switch rs[i] {
+		case '~':
+			if i+1 < len(rs) {
+				i++
+			}
+			sb.WriteString(regexp.QuoteMeta(string(rs[i])))
+		case '*':
+			sb.WriteString(".*")
+		case '?':
+			sb.WriteString(".")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(rs[i])))
+		}
+	}
+	sb.WriteString("$")
+	return regexp.MustCompile(sb.String())
+}
@@ -0,0 +1,63 @@
+package efp
+
+import (
+	"testing"
+)
+
+func TestSum(t *testing.T) {
+	tt := []struct {
+		testName string
+		in       []interface{}
+		out      float64
+		err      error
+	}{
+		{"Numbers", []interface{}{1.0, 2.0, 3.5}, 6.5, nil},
+		{"Direct text and booleans are converted", []interface{}{"2", true}, 3.0, nil},
+		{"Text in array is ignored", []interface{}{Array{{1.0, "2"}, {nil, 4.0}}}, 5.0, nil},
+		{"Error in array", []interface{}{Array{{1.0, ErrNA}}}, 0, ErrNA},
+		{"Direct text not a number", []interface{}{"abc"}, 0, ErrValue},
+	}
+	var errCnt int
+	for _, tu := range tt {
+		s, err := Sum(tu.in...)
+		if s != tu.out || err != tu.err {
+			t.Logf("Test: %v, Expected: %v %v, Got: %v %v", tu.testName, tu.out, tu.err, s, err)
+			errCnt++
+		}
+	}
+	if errCnt > 0 {
+		t.Errorf("Failed %v of %v test cases", errCnt, len(tt))
+	}
+}
+
+func TestCriteria(t *testing.T) {
+	rng := Array{{1.0, 5.0, 10.0}, {"apple", "Banana", "5"}, {true, nil, ""}}
+	tt := []struct {
+		testName string
+		crit     interface{}
+		out      int
+	}{
+		{"Number equality matches numeric text", 5.0, 2},
+		{"Greater than", ">1", 2},
+		{"Less or equal", "<=5", 2},
+		{"Not equal number", "<>5", 7},
+		{"Text ignores case", "APPLE", 1},
+		{"Wildcard", "b*", 1},
+		{"Single character wildcard", "?pple", 1},
+		{"Text comparison", ">b", 1},
+		{"Boolean", "TRUE", 1},
+		{"Blank", "", 2},
+		{"Not blank", "<>", 7},
+	}
+	var errCnt int
+	for _, tu := range tt {
+		c := CountIf(rng, tu.crit)
+		if c != tu.out {
+			t.Logf("Test: %v, Expected: %v, Got: %v", tu.testName, tu.out, c)
+			errCnt++
+		}
+	}
+	if errCnt > 0 {
+		t.Errorf("Failed %v of %v test cases", errCnt, len(tt))
+	}
+}
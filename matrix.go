@@ -0,0 +1,276 @@
+// Copyright © 2019 Praveen Tirumandyam praveen.tirumandyam@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package efp
+
+import "math"
+
+// matrix returns the numbers of arr. Returns ErrValue if arr holds anything
+// but numbers or is ragged, and the error of arr if it holds one
+func matrix(arr Array) ([][]float64, error) {
+	rows, cols := arr.size()
+	if rows == 0 || cols == 0 {
+		return nil, ErrValue
+	}
+	m := make([][]float64, rows)
+	for i, row := range arr {
+		if len(row) != cols {
+			return nil, ErrValue
+		}
+		m[i] = make([]float64, cols)
+		for j, v := range row {
+			if e, ok := v.(ErrorValue); ok {
+				return nil, e
+			}
+			n, ok := asNumber(v)
+			if !ok {
+				return nil, ErrValue
+			}
+			m[i][j] = n
+		}
+	}
+	return m, nil
+}
+
+func fromMatrix(m [][]float64) Array {
+	return newArray(len(m), len(m[0]), func(i, j int) interface{} { return m[i][j] })
+}
+
+// MMult implements Excel's MMULT function. Returns ErrValue unless the
+// columns of a match the rows of b
+func MMult(a, b Array) (Array, error) {
+	x, err := matrix(a)
+	if err != nil {
+		return nil, err
+	}
+	y, err := matrix(b)
+	if err != nil {
+		return nil, err
+	}
+	if len(x[0]) != len(y) {
+		return nil, ErrValue
+	}
+	out := make([][]float64, len(x))
+	for i := range x {
+		out[i] = make([]float64, len(y[0]))
+		for j := range y[0] {
+			var sum float64
+			for k := range y {
+				sum += x[i][k] * y[k][j]
+			}
+			out[i][j] = sum
+		}
+	}
+	return fromMatrix(out), nil
+}
+
+// singular is the size of a pivot relative to the largest value of a matrix
+// below which the matrix is taken as singular
+const singular = 1e-14
+
+// squareMatrix returns the numbers of arr and its largest absolute value.
+// Returns ErrValue unless arr is square
+func squareMatrix(arr Array) ([][]float64, float64, error) {
+	m, err := matrix(arr)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(m) != len(m[0]) {
+		return nil, 0, ErrValue
+	}
+	var scale float64
+	for _, row := range m {
+		for _, v := range row {
+			scale = math.Max(scale, math.Abs(v))
+		}
+	}
+	return m, scale, nil
+}
+
+// pivot swaps the row with the largest value in column k at or below row k
+// into row k of m and of the rows of others. Returns false if the column has
+// no usable pivot
+func pivot(m [][]float64, k int, scale float64, others ...[][]float64) (bool, bool) {
+	p := k
+	for i := k + 1; i < len(m); i++ {
+		if math.Abs(m[i][k]) > math.Abs(m[p][k]) {
+			p = i
+		}
+	}
+	if math.Abs(m[p][k]) <= singular*scale {
+		return false, false
+	}
+	if p == k {
+		return true, false
+	}
+	m[p], m[k] = m[k], m[p]
+	for _, o := range others {
+		o[p], o[k] = o[k], o[p]
+	}
+	return true, true
+}
+
+// MDeterm implements Excel's MDETERM function by LU decomposition with
+// partial pivoting. Returns ErrValue unless a is square
+func MDeterm(a Array) (float64, error) {
+	m, scale, err := squareMatrix(a)
+	if err != nil {
+		return 0, err
+	}
+	det := 1.0
+	for k := range m {
+		ok, swapped := pivot(m, k, scale)
+		if !ok {
+			return 0, nil
+		}
+		if swapped {
+			det = -det
+		}
+		det *= m[k][k]
+		for i := k + 1; i < len(m); i++ {
+			f := m[i][k] / m[k][k]
+			for j := k; j < len(m); j++ {
+				m[i][j] -= f * m[k][j]
+			}
+		}
+	}
+	return det, nil
+}
+
+// MInverse implements Excel's MINVERSE function by Gauss-Jordan elimination
+// with partial pivoting. Returns ErrValue unless a is square and ErrNum if it
+// is singular
+func MInverse(a Array) (Array, error) {
+	m, scale, err := squareMatrix(a)
+	if err != nil {
+		return nil, err
+	}
+	n := len(m)
+	inv := identity(n)
+	for k := 0; k < n; k++ {
+		if ok, _ := pivot(m, k, scale, inv); !ok {
+			return nil, ErrNum
+		}
+		p := m[k][k]
+		for j := 0; j < n; j++ {
+			m[k][j] /= p
+			inv[k][j] /= p
+		}
+		for i := 0; i < n; i++ {
+			if i == k || m[i][k] == 0 {
+				continue
+			}
+			f := m[i][k]
+			for j := 0; j < n; j++ {
+				m[i][j] -= f * m[k][j]
+				inv[i][j] -= f * inv[k][j]
+			}
+		}
+	}
+	return fromMatrix(inv), nil
+}
+
+func identity(n int) [][]float64 {
+	m := make([][]float64, n)
+	for i := range m {
+		m[i] = make([]float64, n)
+		m[i][i] = 1
+	}
+	return m
+}
+
+// MUnit implements Excel's MUNIT function returning the identity matrix of
+// size n. Returns ErrValue if n is less than 1
+func MUnit(n int) (Array, error) {
+	if n < 1 {
+		return nil, ErrValue
+	}
+	return fromMatrix(identity(n)), nil
+}
+
+// SumProduct implements Excel's SUMPRODUCT function. The arrays must have the
+// same size; values that are not numbers count as 0
+func SumProduct(arrays ...Array) (float64, error) {
+	if len(arrays) == 0 {
+		return 0, ErrValue
+	}
+	rows, cols := arrays[0].size()
+	for _, a := range arrays[1:] {
+		if r, c := a.size(); r != rows || c != cols {
+			return 0, ErrValue
+		}
+	}
+	var total float64
+	for i := 0; i < rows; i++ {
+		for j := 0; j < cols; j++ {
+			product := 1.0
+			for _, a := range arrays {
+				v := a.at(i, j)
+				if e, ok := v.(ErrorValue); ok {
+					return 0, e
+				}
+				n, _ := asNumber(v)
+				product *= n
+			}
+			total += product
+		}
+	}
+	return total, nil
+}
+
+// sumPairs adds fn of the values at the same position in x and y for
+// SUMX2MY2, SUMX2PY2 and SUMXMY2. Pairs that are not both numbers are
+// skipped. Returns ErrNA if x and y hold a different number of values
+func sumPairs(x, y Array, fn func(a, b float64) float64) (float64, error) {
+	xs, err := x.flatten(0, false)
+	if err != nil {
+		return 0, err
+	}
+	ys, err := y.flatten(0, false)
+	if err != nil {
+		return 0, err
+	}
+	if len(xs) != len(ys) {
+		return 0, ErrNA
+	}
+	var total float64
+	for i := range xs {
+		for _, v := range []interface{}{xs[i], ys[i]} {
+			if e, ok := v.(ErrorValue); ok {
+				return 0, e
+			}
+		}
+		a, okA := asNumber(xs[i])
+		b, okB := asNumber(ys[i])
+		if okA && okB {
+			total += fn(a, b)
+		}
+	}
+	return total, nil
+}
+
+// SumX2MY2 implements Excel's SUMX2MY2 function, the sum of x²-y²
+func SumX2MY2(x, y Array) (float64, error) {
+	return sumPairs(x, y, func(a, b float64) float64 { return a*a - b*b })
+}
+
+// SumX2PY2 implements Excel's SUMX2PY2 function, the sum of x²+y²
+func SumX2PY2(x, y Array) (float64, error) {
+	return sumPairs(x, y, func(a, b float64) float64 { return a*a + b*b })
+}
+
+// SumXMY2 implements Excel's SUMXMY2 function, the sum of (x-y)²
+func SumXMY2(x, y Array) (float64, error) {
+	return sumPairs(x, y, func(a, b float64) float64 { return (a - b) * (a - b) })
+}
@@ -0,0 +1,158 @@
+package efp
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestMatrixFunctions(t *testing.T) {
+	a := Array{{4.0, 7.0}, {2.0, 6.0}}
+	tt := []struct {
+		name string
+		fn   func() (Array, error)
+		out  Array
+		err  error
+	}{
+		{"MMULT", func() (Array, error) { return MMult(Array{{1.0, 2.0, 3.0}}, Array{{4.0}, {5.0}, {6.0}}) },
+			Array{{32.0}}, nil},
+		{"MMULT by identity", func() (Array, error) { return MMult(a, Array{{1.0, 0.0}, {0.0, 1.0}}) }, a, nil},
+		{"MMULT non-conforming", func() (Array, error) { return MMult(a, Array{{1.0, 2.0}}) }, nil, ErrValue},
+		{"MMULT of text", func() (Array, error) { return MMult(Array{{"1"}}, Array{{1.0}}) }, nil, ErrValue},
+		{"MMULT of errors", func() (Array, error) { return MMult(Array{{ErrDiv0}}, Array{{1.0}}) }, nil, ErrDiv0},
+		{"MINVERSE", func() (Array, error) { return MInverse(a) },
+			Array{{0.6, -0.7}, {-0.2, 0.4}}, nil},
+		{"MINVERSE needing a pivot", func() (Array, error) { return MInverse(Array{{0.0, 1.0}, {2.0, 0.0}}) },
+			Array{{0.0, 0.5}, {1.0, 0.0}}, nil},
+		{"MINVERSE singular", func() (Array, error) { return MInverse(Array{{1.0, 2.0}, {2.0, 4.0}}) }, nil, ErrNum},
+		{"MINVERSE not square", func() (Array, error) { return MInverse(Array{{1.0, 2.0}}) }, nil, ErrValue},
+		{"MUNIT", func() (Array, error) { return MUnit(2) }, Array{{1.0, 0.0}, {0.0, 1.0}}, nil},
+		{"MUNIT of zero", func() (Array, error) { return MUnit(0) }, nil, ErrValue},
+	}
+	var errCnt int
+	for _, tu := range tt {
+		out, err := tu.fn()
+		if !matrixEqual(out, tu.out) || err != tu.err {
+			t.Logf("Test: %v, Expected: %v %v, Got: %v %v", tu.name, tu.out, tu.err, out, err)
+			errCnt++
+		}
+	}
+	if errCnt > 0 {
+		t.Errorf("Failed %v of %v test cases", errCnt, len(tt))
+	}
+}
+
+func matrixEqual(a, b Array) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if len(a[i]) != len(b[i]) {
+			return false
+		}
+		for j := range a[i] {
+			if math.Abs(a[i][j].(float64)-b[i][j].(float64)) > 1e-12 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func TestMatrixValues(t *testing.T) {
+	tt := []struct {
+		name string
+		fn   func() (float64, error)
+		out  float64
+		err  error
+	}{
+		{"MDETERM", func() (float64, error) { return MDeterm(Array{{4.0, 7.0}, {2.0, 6.0}}) }, 10, nil},
+		{"MDETERM with row swaps", func() (float64, error) {
+			return MDeterm(Array{{0.0, 1.0, 0.0}, {1.0, 0.0, 0.0}, {0.0, 0.0, 3.0}})
+		}, -3, nil},
+		{"MDETERM singular", func() (float64, error) { return MDeterm(Array{{1.0, 2.0}, {2.0, 4.0}}) }, 0, nil},
+		{"MDETERM not square", func() (float64, error) { return MDeterm(Array{{1.0, 2.0}}) }, 0, ErrValue},
+		{"SUMPRODUCT", func() (float64, error) {
+			return SumProduct(Array{{1.0, 2.0}, {3.0, 4.0}}, Array{{5.0, 6.0}, {7.0, 8.0}})
+		}, 70, nil},
+		{"SUMPRODUCT ignores text", func() (float64, error) {
+			return SumProduct(Array{{1.0}, {"x"}}, Array{{2.0}, {3.0}})
+		}, 2, nil},
+		{"SUMPRODUCT of different sizes", func() (float64, error) {
+			return SumProduct(Array{{1.0, 2.0}}, Array{{1.0}})
+		}, 0, ErrValue},
+		{"SUMPRODUCT of errors", func() (float64, error) { return SumProduct(Array{{ErrNA}}) }, 0, ErrNA},
+		{"SUMX2MY2", func() (float64, error) { return SumX2MY2(Array{{2.0, 3.0}}, Array{{1.0, 1.0}}) }, 11, nil},
+		{"SUMX2PY2", func() (float64, error) { return SumX2PY2(Array{{2.0, 3.0}}, Array{{1.0, 1.0}}) }, 15, nil},
+		{"SUMXMY2 skips text", func() (float64, error) {
+			return SumXMY2(Array{{2.0, "a", 5.0}}, Array{{1.0, 1.0, 1.0}})
+		}, 17, nil},
+		{"SUMXMY2 of different counts", func() (float64, error) {
+			return SumXMY2(Array{{2.0}}, Array{{1.0, 1.0}})
+		}, 0, ErrNA},
+	}
+	var errCnt int
+	for _, tu := range tt {
+		out, err := tu.fn()
+		if math.Abs(out-tu.out) > 1e-12 || err != tu.err {
+			t.Logf("Test: %v, Expected: %v %v, Got: %v %v", tu.name, tu.out, tu.err, out, err)
+			errCnt++
+		}
+	}
+	if errCnt > 0 {
+		t.Errorf("Failed %v of %v test cases", errCnt, len(tt))
+	}
+}
+
+func TestMatrixFormulas(t *testing.T) {
+	wb := NewWorkbook()
+	s := wb.AddSheet("Sheet1")
+	for row := 1; row <= 2; row++ {
+		for col := 1; col <= 2; col++ {
+			s.SetValue(ColumnName(col)+strconv.Itoa(row), float64(row*col+row))
+		}
+	}
+	for row := 1; row <= 3; row++ {
+		s.SetValue("H"+strconv.Itoa(row), float64(row))
+	}
+	tt := []struct {
+		exp string
+		out interface{}
+	}{
+		{"SUMPRODUCT(A1:A2,B1:B2)", 2.0*3.0 + 4.0*6.0},
+		{"SUMPRODUCT(A1:B1,A1:A2)", ErrValue},
+		{"MDETERM(A1:B2)", 0.0},
+		{"MINVERSE(A1:B2)", ErrNum},
+		{"ARRAYTOTEXT(MMULT(A1:B2,MUNIT(2)))", "2, 3, 4, 6"},
+		{"SUM(MMULT(A1:B1,A1:A2))", 2.0*2.0 + 3.0*4.0},
+		{"SUMXMY2(A1:A2,B1:B2)", 1.0 + 4.0},
+		{"SUMPRODUCT((H1:H3>1)*H1:H3)", 5.0},
+		{"SUMPRODUCT(H1:H3*2)", 12.0},
+		{"SUMPRODUCT(--(H1:H3>=2),H1:H3)", 5.0},
+		{"SUMPRODUCT((A1:A2=4)*B1:B2)", 6.0},
+		{"SUMPRODUCT(A1:B2*H1:H2)", 2.0 + 3.0 + 8.0 + 12.0},
+		{"SUMPRODUCT(A1:B2*H1:H3)", ErrNA},
+		{"SUMPRODUCT({1,2},{3,4})", 11.0},
+		{"ARRAYTOTEXT(MMULT({1,2;3,4},{5;6}),1)", "{17;39}"},
+		{"MDETERM({1,2;3,4})", -2.0},
+		{"ARRAYTOTEXT(MINVERSE({2,0;0,4}),1)", "{0.5,0;0,0.25}"},
+		{"SUMPRODUCT({1,2;3,4},A1:B2)", 2.0 + 6.0 + 12.0 + 24.0},
+		{"SUMXMY2({1,2},{3,5})", 4.0 + 9.0},
+		{"MMULT({1,2},{1,2})", ErrValue},
+	}
+	var errCnt int
+	for _, tu := range tt {
+		out, err := wb.EvaluateFormula(context.Background(), "Sheet1", tu.exp, nil)
+		if e, ok := err.(ErrorValue); ok {
+			out = e
+		}
+		if out != tu.out {
+			t.Logf("Test: %v, Expected: %v, Got: %v %v", tu.exp, tu.out, out, err)
+			errCnt++
+		}
+	}
+	if errCnt > 0 {
+		t.Errorf("Failed %v of %v test cases", errCnt, len(tt))
+	}
+}
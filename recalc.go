@@ -0,0 +1,342 @@
+// Copyright © 2019 Praveen Tirumandyam praveen.tirumandyam@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package efp
+
+import (
+	"context"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+type nowKey struct{}
+
+// withNow fixes the time NOW and TODAY return for the evaluations made with
+// the returned context. A time already set in c is kept
+func withNow(c context.Context) context.Context {
+	if _, ok := c.Value(nowKey{}).(time.Time); ok {
+		return c
+	}
+	return context.WithValue(c, nowKey{}, time.Now())
+}
+
+// now returns the time of the recalculation c belongs to
+func now(c context.Context) time.Time {
+	if t, ok := c.Value(nowKey{}).(time.Time); ok {
+		return t
+	}
+	return time.Now()
+}
+
+// formulaCell is a cell holding a formula along with its address
+type formulaCell struct {
+	sheet *Sheet
+	key   CellRef
+	cell  *Cell
+}
+
+// formulaCells lists the formula cells of workbook in sheet, row and column
+// order
+func (wb *Workbook) formulaCells() []formulaCell {
+	var cells []formulaCell
+	for _, s := range wb.Sheets {
+		start := len(cells)
+		for k, cell := range s.Cells {
+			if cell.Formula != "" {
+				cells = append(cells, formulaCell{sheet: s, key: k, cell: cell})
+			}
+		}
+		part := cells[start:]
+		sort.Slice(part, func(i, j int) bool {
+			if part[i].key.Row != part[j].key.Row {
+				return part[i].key.Row < part[j].key.Row
+			}
+			return part[i].key.Col < part[j].key.Col
+		})
+	}
+	return cells
+}
+
+// RecalculateParallel evaluates every formula in workbook like Recalculate
+// using up to workers goroutines; workers of 0 or less uses one per CPU.
+//
+// The references of each formula, including those made through defined
+// names, are read before evaluating so that a cell is evaluated once all the
+// cells it refers to have been. Cells whose references are only known while
+// evaluating them, because they call a volatile function like NOW or use a
+// name which is not defined in the workbook, are evaluated after the others
+// in sheet, row and column order along with every cell depending on them.
+// Volatile functions see the same time in all cells. Apart from limits on the
+// depth of references and the number of steps, the values computed and the
+// error returned when evaluation fails are the same as with Recalculate
+func (wb *Workbook) RecalculateParallel(c context.Context, workers int) error {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	c = withNow(c)
+	g := newDependencyGraph(wb)
+	r := &recalculation{
+		ev:       newEvaluation(wb),
+		g:        g,
+		vals:     make([]interface{}, len(g.nodes)),
+		errs:     make([]error, len(g.nodes)),
+		done:     make([]bool, len(g.nodes)),
+		firstErr: len(g.nodes),
+	}
+	r.parallel(c, workers)
+	// Cells left are dynamic, depend on dynamic cells or are part of a cycle
+	ch := r.ev.newChain()
+	for i := range g.nodes {
+		if !r.done[i] {
+			r.evaluate(c, ch, i)
+		}
+	}
+	for i, n := range g.nodes {
+		if i == r.firstErr {
+			return r.errs[i]
+		}
+		n.cell.Value = r.vals[i]
+	}
+	return nil
+}
+
+// recalculation is the state of a RecalculateParallel call. vals and errs
+// hold the result of each node of g, set by the goroutine evaluating it
+type recalculation struct {
+	ev   *evaluation
+	g    *dependencyGraph
+	vals []interface{}
+	errs []error
+	done []bool
+
+	mu sync.Mutex
+	// firstErr is the index of the first node which failed. Nodes after it
+	// need not be evaluated since Recalculate would have stopped before them
+	firstErr int
+}
+
+// evaluate computes node i on chain ch
+func (r *recalculation) evaluate(c context.Context, ch *chain, i int) {
+	r.mu.Lock()
+	skip := i > r.firstErr
+	r.mu.Unlock()
+	r.done[i] = true
+	if skip {
+		return
+	}
+	n := r.g.nodes[i]
+	err := c.Err()
+	var v interface{}
+	if err == nil {
+		v, err = ch.cellValue(c, n.sheet, n.key)
+		if e, ok := err.(ErrorValue); ok {
+			v, err = e, nil
+		}
+	}
+	r.vals[i], r.errs[i] = v, err
+	if err != nil {
+		r.mu.Lock()
+		if i < r.firstErr {
+			r.firstErr = i
+		}
+		r.mu.Unlock()
+	}
+}
+
+// parallel evaluates the static nodes of the graph on a pool of workers. A
+// node is queued once the last node it depends on is evaluated
+func (r *recalculation) parallel(c context.Context, workers int) {
+	g := r.g
+	pending := make([]int, len(g.nodes))
+	ready := make(chan int, len(g.nodes))
+	var wg sync.WaitGroup
+	for i := range g.nodes {
+		if g.dynamic[i] {
+			continue
+		}
+		pending[i] = len(g.deps[i])
+		if pending[i] == 0 {
+			wg.Add(1)
+			ready <- i
+		}
+	}
+	var mu sync.Mutex
+	for w := 0; w < workers; w++ {
+		go func() {
+			ch := r.ev.newChain()
+			for i := range ready {
+				r.evaluate(c, ch, i)
+				mu.Lock()
+				for _, d := range g.dependents[i] {
+					if pending[d]--; pending[d] == 0 && !g.dynamic[d] {
+						wg.Add(1)
+						ready <- d
+					}
+				}
+				mu.Unlock()
+				wg.Done()
+			}
+		}()
+	}
+	wg.Wait()
+	close(ready)
+}
+
+// dependencyGraph links the formula cells of a workbook to the formula cells
+// they refer to. Nodes are in sheet, row and column order; deps and
+// dependents hold node indexes. A node is dynamic when its references are
+// not all known before evaluating it or when it depends on a dynamic node
+type dependencyGraph struct {
+	nodes      []formulaCell
+	deps       [][]int
+	dependents [][]int
+	dynamic    []bool
+}
+
+func newDependencyGraph(wb *Workbook) *dependencyGraph {
+	g := &dependencyGraph{nodes: wb.formulaCells()}
+	g.deps = make([][]int, len(g.nodes))
+	g.dependents = make([][]int, len(g.nodes))
+	g.dynamic = make([]bool, len(g.nodes))
+
+	index := make(map[*Sheet]map[CellRef]int)
+	for i, n := range g.nodes {
+		if index[n.sheet] == nil {
+			index[n.sheet] = make(map[CellRef]int)
+		}
+		index[n.sheet][n.key] = i
+	}
+	for i, n := range g.nodes {
+		seen := make(map[int]bool)
+		add := func(s *Sheet, ref Ref) {
+			for _, d := range refNodes(index[s], ref.normalize()) {
+				if !seen[d] {
+					seen[d] = true
+					g.deps[i] = append(g.deps[i], d)
+					g.dependents[d] = append(g.dependents[d], i)
+				}
+			}
+		}
+		if !formulaReferences(wb, n.cell.Formula, n.sheet, n.key, make(map[*DefinedName]bool), add) {
+			g.dynamic[i] = true
+		}
+	}
+	// Cells depending on a dynamic cell are dynamic too
+	var queue []int
+	for i, d := range g.dynamic {
+		if d {
+			queue = append(queue, i)
+		}
+	}
+	for len(queue) > 0 {
+		i := queue[0]
+		queue = queue[1:]
+		for _, d := range g.dependents[i] {
+			if !g.dynamic[d] {
+				g.dynamic[d] = true
+				queue = append(queue, d)
+			}
+		}
+	}
+	return g
+}
+
+// formulaReferences calls add for every reference formula on sheet s makes,
+// including those made through defined names. Returns false when some
+// references are only known while evaluating formula: it calls a volatile
+// function or uses a name which is not defined in workbook
+func formulaReferences(wb *Workbook, formula string, s *Sheet, host CellRef, names map[*DefinedName]bool, add func(s *Sheet, ref Ref)) bool {
+	toks, err := lex(formula)
+	if err != nil {
+		return false
+	}
+	toks = resizeArguments(toks)
+	static := true
+	for _, t := range toks {
+		switch t.kind {
+		case tokRef:
+			sheets, _ := wb.refSheets(t.ref, s)
+			for _, rs := range sheets {
+				add(rs, t.ref)
+			}
+		case tokTable:
+			ref, err := wb.structuredRef(t.text, s, host)
+			if err == nil {
+				add(wb.Sheet(ref.Sheet), ref)
+			}
+		case tokFunc:
+			if b := builtins[functionName(t.text)]; b != nil && b.volatile {
+				static = false
+			}
+		case tokName:
+			if b := builtins[functionName(t.text)]; b != nil {
+				static = static && !b.volatile
+				continue
+			}
+			if tb := wb.Table(t.text); tb != nil {
+				if ref, err := wb.structuredRef(tb.Name+"[]", s, host); err == nil {
+					add(wb.Sheet(ref.Sheet), ref)
+				}
+				continue
+			}
+			n, ns := wb.definedName(s, t.text)
+			switch {
+			case n == nil:
+				static = false
+			case names[n]:
+				// Circular names fail when evaluated
+			default:
+				names[n] = true
+				static = formulaReferences(wb, n.Formula, ns, host, names, add) && static
+				delete(names, n)
+			}
+		}
+	}
+	return static
+}
+
+// refNodes returns the nodes of index, the formula cells of a sheet, covered
+// by ref in no particular order
+func refNodes(index map[CellRef]int, ref Ref) []int {
+	if len(index) == 0 {
+		return nil
+	}
+	if !ref.IsRange() {
+		if i, ok := index[cellKey(ref.From)]; ok {
+			return []int{i}
+		}
+		return nil
+	}
+	var nodes []int
+	area := float64(ref.To.Row-ref.From.Row+1) * float64(ref.To.Col-ref.From.Col+1)
+	if ref.IsWholeColumn() || ref.IsWholeRow() || area > float64(len(index)) {
+		for k, i := range index {
+			if (ref.IsWholeColumn() || k.Row >= ref.From.Row && k.Row <= ref.To.Row) &&
+				(ref.IsWholeRow() || k.Col >= ref.From.Col && k.Col <= ref.To.Col) {
+				nodes = append(nodes, i)
+			}
+		}
+		return nodes
+	}
+	for r := ref.From.Row; r <= ref.To.Row; r++ {
+		for col := ref.From.Col; col <= ref.To.Col; col++ {
+			if i, ok := index[CellRef{Row: r, Col: col}]; ok {
+				nodes = append(nodes, i)
+			}
+		}
+	}
+	return nodes
+}
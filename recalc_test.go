@@ -0,0 +1,210 @@
+package efp
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// generateWorkbook creates a workbook with chains formulas in each of cols
+// columns of a sheet, each cell adding to the one above it, and a total on a
+// second sheet summing the last row
+func generateWorkbook(rows, cols int) *Workbook {
+	wb := NewWorkbook()
+	s := wb.AddSheet("Data")
+	for col := 1; col <= cols; col++ {
+		name := ColumnName(col)
+		s.SetValue(name+"1", float64(col))
+		for r := 2; r <= rows; r++ {
+			s.SetFormula(fmt.Sprintf("%s%d", name, r), fmt.Sprintf("%s%d*1.01+%d", name, r-1, r%7))
+		}
+	}
+	total := wb.AddSheet("Total")
+	total.SetFormula("A1", fmt.Sprintf("SUM(Data!A%d:%s%d)", rows, ColumnName(cols), rows))
+	total.SetFormula("A2", "A1/COUNT(Data!A:A)")
+	return wb
+}
+
+func cellValues(wb *Workbook) map[string]interface{} {
+	vals := make(map[string]interface{})
+	for _, s := range wb.Sheets {
+		for k, cell := range s.Cells {
+			vals[s.Name+"!"+k.String()] = cell.Value
+		}
+	}
+	return vals
+}
+
+func TestRecalculateParallel(t *testing.T) {
+	tt := []struct {
+		workers int
+	}{
+		{1},
+		{2},
+		{8},
+		{-1},
+	}
+	serial := generateWorkbook(40, 6)
+	if err := serial.Recalculate(context.Background()); err != nil {
+		t.Fatalf("Recalculate failed, Error: %v", err)
+	}
+	want := cellValues(serial)
+	var errCnt int
+	for _, tu := range tt {
+		wb := generateWorkbook(40, 6)
+		err := wb.RecalculateParallel(context.Background(), tu.workers)
+		if got := cellValues(wb); err != nil || !reflect.DeepEqual(got, want) {
+			t.Logf("Test: %v, Expected: %v, Got: %v (%v)", tu.workers, want["Total!A1"], got["Total!A1"], err)
+			errCnt++
+		}
+	}
+	if errCnt > 0 {
+		t.Errorf("Failed %v of %v test cases", errCnt, len(tt))
+	}
+}
+
+func TestRecalculateParallelVolatile(t *testing.T) {
+	wb := NewWorkbook()
+	s := wb.AddSheet("Sheet1")
+	s.SetValue("A1", 2.0)
+	s.SetFormula("B1", "NOW()")
+	s.SetFormula("B2", "TODAY()")
+	s.SetFormula("B3", "B1-B2")
+	s.SetFormula("B4", "NOW()=B1")
+	s.SetFormula("C1", "RAND()")
+	s.SetFormula("C2", "C1*A1")
+	s.SetFormula("C3", "RANDBETWEEN(A1,A1)")
+	s.SetFormula("C4", "RANDBETWEEN(3,2)")
+	at := time.Date(2021, time.March, 4, 18, 0, 0, 0, time.UTC)
+	c := context.WithValue(context.Background(), nowKey{}, at)
+	if err := wb.RecalculateParallel(c, 4); err != nil {
+		t.Fatalf("RecalculateParallel failed, Error: %v", err)
+	}
+	tt := []struct {
+		cell string
+		out  interface{}
+	}{
+		{"B1", 44259.75},
+		{"B2", 44259.0},
+		{"B3", 0.75},
+		{"B4", true},
+		{"C2", s.Cell("C1").Value.(float64) * 2},
+		{"C3", 2.0},
+		{"C4", ErrNum},
+	}
+	var errCnt int
+	for _, tu := range tt {
+		if v := s.Cell(tu.cell).Value; v != tu.out {
+			t.Logf("Cell: %v, Expected: %v, Got: %v", tu.cell, tu.out, v)
+			errCnt++
+		}
+	}
+	if errCnt > 0 {
+		t.Errorf("Failed %v of %v test cases", errCnt, len(tt))
+	}
+}
+
+func TestRecalculateParallelErrors(t *testing.T) {
+	tt := []struct {
+		name     string
+		formulas map[string]string
+	}{
+		{"circular", map[string]string{"A1": "1", "A2": "A3+1", "A3": "A2+1", "A4": "A1+1"}},
+		{"invalid", map[string]string{"A1": "B2", "B1": "1+", "B2": "B1*2"}},
+		{"unknown name", map[string]string{"A1": "1", "A2": "A1+missing", "A3": "A2"}},
+	}
+	var errCnt int
+	for _, tu := range tt {
+		var errs [2]error
+		var vals [2]interface{}
+		for i := range errs {
+			wb := NewWorkbook()
+			s := wb.AddSheet("Sheet1")
+			for ref, f := range tu.formulas {
+				s.SetFormula(ref, f)
+			}
+			if i == 0 {
+				errs[i] = wb.Recalculate(context.Background())
+			} else {
+				errs[i] = wb.RecalculateParallel(context.Background(), 4)
+			}
+			vals[i] = cellValues(wb)
+		}
+		if errs[1] == nil || errs[0].Error() != errs[1].Error() || !reflect.DeepEqual(vals[0], vals[1]) {
+			t.Logf("Test: %v, Expected: %v, Got: %v", tu.name, errs[0], errs[1])
+			errCnt++
+		}
+	}
+	if errCnt > 0 {
+		t.Errorf("Failed %v of %v test cases", errCnt, len(tt))
+	}
+}
+
+func TestRecalculateParallelCancel(t *testing.T) {
+	wb := generateWorkbook(20, 4)
+	c, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := wb.RecalculateParallel(c, 4); err != context.Canceled {
+		t.Errorf("Expected: %v, Got: %v", context.Canceled, err)
+	}
+}
+
+func benchmarkRecalculate(b *testing.B, recalc func(wb *Workbook) error) {
+	for _, size := range []struct{ rows, cols int }{{100, 10}, {1000, 50}} {
+		wb := generateWorkbook(size.rows, size.cols)
+		b.Run(fmt.Sprintf("%dx%d", size.rows, size.cols), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := recalc(wb); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkRecalculate(b *testing.B) {
+	benchmarkRecalculate(b, func(wb *Workbook) error {
+		return wb.Recalculate(context.Background())
+	})
+}
+
+func BenchmarkRecalculateParallel(b *testing.B) {
+	benchmarkRecalculate(b, func(wb *Workbook) error {
+		return wb.RecalculateParallel(context.Background(), -1)
+	})
+}
+
+func TestDependencyGraphNames(t *testing.T) {
+	wb := NewWorkbook()
+	s := wb.AddSheet("Sheet1")
+	s.SetFormula("A1", "1+1")
+	s.SetFormula("B1", "Doubled+1")
+	s.SetFormula("C1", "Unknown+1")
+	s.SetFormula("D1", "Later")
+	wb.DefineName("Doubled", "", "Sheet1!A1*2")
+	wb.DefineName("Later", "", "NOW()+B1")
+	g := newDependencyGraph(wb)
+	tt := []struct {
+		cell    string
+		deps    []int
+		dynamic bool
+	}{
+		{"A1", nil, false},
+		{"B1", []int{0}, false},
+		{"C1", nil, true},
+		{"D1", []int{1}, true},
+	}
+	var errCnt int
+	for i, tu := range tt {
+		if !reflect.DeepEqual(g.deps[i], tu.deps) || g.dynamic[i] != tu.dynamic {
+			t.Logf("Cell: %v, Expected: %v %v, Got: %v %v", tu.cell, tu.deps, tu.dynamic, g.deps[i], g.dynamic[i])
+			errCnt++
+		}
+	}
+	if errCnt > 0 {
+		t.Errorf("Failed %v of %v test cases", errCnt, len(tt))
+	}
+}
@@ -0,0 +1,360 @@
+// Copyright © 2019 Praveen Tirumandyam praveen.tirumandyam@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package efp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Limits of an Excel worksheet
+const (
+	MaxRows    = 1048576
+	MaxColumns = 16384
+)
+
+// CellRef is a reference to a single cell in A1 notation. Row and Col are 1 based.
+// Row is 0 in the corners of a whole column reference like A:C and Col is 0
+// in the corners of a whole row reference like 1:3
+type CellRef struct {
+	Row    int
+	Col    int
+	RowAbs bool
+	ColAbs bool
+}
+
+// ColumnName converts 1 based column index to column letters e.g. 28 to AB
+func ColumnName(col int) string {
+	var b []byte
+	for col > 0 {
+		col--
+		b = append([]byte{byte('A' + col%26)}, b...)
+		col /= 26
+	}
+	return string(b)
+}
+
+// ColumnIndex converts column letters to 1 based column index e.g. AB to 28.
+// Returns 0 if name is not a valid column
+func ColumnIndex(name string) int {
+	if len(name) == 0 || len(name) > 3 {
+		return 0
+	}
+	col := 0
+	for _, r := range strings.ToUpper(name) {
+		if r < 'A' || r > 'Z' {
+			return 0
+		}
+		col = col*26 + int(r-'A'+1)
+	}
+	if col > MaxColumns {
+		return 0
+	}
+	return col
+}
+
+// ParseCellRef parses a cell reference like B4 or $B$4
+func ParseCellRef(s string) (CellRef, error) {
+	var c CellRef
+	rest := s
+	if strings.HasPrefix(rest, "$") {
+		c.ColAbs = true
+		rest = rest[1:]
+	}
+	i := 0
+	for i < len(rest) && rest[i] < unicode.MaxASCII && unicode.IsLetter(rune(rest[i])) {
+		i++
+	}
+	c.Col = ColumnIndex(rest[:i])
+	if c.Col == 0 {
+		return CellRef{}, fmt.Errorf("invalid cell reference %q", s)
+	}
+	rest = rest[i:]
+	if strings.HasPrefix(rest, "$") {
+		c.RowAbs = true
+		rest = rest[1:]
+	}
+	if len(rest) == 0 || rest[0] < '0' || rest[0] > '9' {
+		return CellRef{}, fmt.Errorf("invalid cell reference %q", s)
+	}
+	row, err := strconv.Atoi(rest)
+	if err != nil || row < 1 || row > MaxRows {
+		return CellRef{}, fmt.Errorf("invalid cell reference %q", s)
+	}
+	c.Row = row
+	return c, nil
+}
+
+// String returns the cell reference in A1 notation
+func (c CellRef) String() string {
+	var sb strings.Builder
+	if c.Col > 0 {
+		if c.ColAbs {
+			sb.WriteString("$")
+		}
+		sb.WriteString(ColumnName(c.Col))
+	}
+	if c.Row > 0 {
+		if c.RowAbs {
+			sb.WriteString("$")
+		}
+		sb.WriteString(strconv.Itoa(c.Row))
+	}
+	return sb.String()
+}
+
+// Ref is a reference to a rectangular area of cells, optionally qualified by
+// the sheet it belongs to. For a single cell reference To is same as From
+type Ref struct {
+	Sheet string
+	// LastSheet is the last sheet of a 3D reference like Sheet1:Sheet3!A1,
+	// which covers the sheets from Sheet up to LastSheet in workbook order.
+	// Empty for references to a single sheet
+	LastSheet string
+	From      CellRef
+	To        CellRef
+}
+
+// ParseRef parses references like A1, $A$1:B4, C:C, 3:5, Sheet1!A1, 'Q1 Data'!A1:B2
+// or the 3D reference Sheet1:Sheet4!C5
+func ParseRef(s string) (Ref, error) {
+	toks, err := lex(s)
+	if err != nil {
+		return Ref{}, err
+	}
+	if len(toks) != 1 || toks[0].kind != tokRef {
+		return Ref{}, fmt.Errorf("invalid reference %q", s)
+	}
+	return toks[0].ref, nil
+}
+
+// IsRange returns true if reference covers more than one cell
+func (r Ref) IsRange() bool {
+	return r.From.Row != r.To.Row || r.From.Col != r.To.Col || r.IsWholeColumn() || r.IsWholeRow()
+}
+
+// IsWholeColumn returns true for references to entire columns like A:C
+func (r Ref) IsWholeColumn() bool {
+	return r.From.Row == 0
+}
+
+// IsWholeRow returns true for references to entire rows like 1:3
+func (r Ref) IsWholeRow() bool {
+	return r.From.Col == 0
+}
+
+// String returns the reference in A1 notation
+func (r Ref) String() string {
+	var sb strings.Builder
+	sb.WriteString(r.sheetPrefix())
+	sb.WriteString(r.From.String())
+	if r.From != r.To || r.IsWholeColumn() || r.IsWholeRow() {
+		sb.WriteString(":")
+		sb.WriteString(r.To.String())
+	}
+	return sb.String()
+}
+
+// R1C1 returns the reference in R1C1 notation relative to anchor. Relative
+// rows and columns become offsets from anchor like R[-1]C[2]; absolute ones
+// keep their number like R1C2
+func (r Ref) R1C1(anchor CellRef) string {
+	var sb strings.Builder
+	sb.WriteString(r.sheetPrefix())
+	sb.WriteString(r.From.r1c1(anchor))
+	if r.From != r.To {
+		sb.WriteString(":")
+		sb.WriteString(r.To.r1c1(anchor))
+	}
+	return sb.String()
+}
+
+func (c CellRef) r1c1(host CellRef) string {
+	var sb strings.Builder
+	axis := func(letter string, v, h int, abs bool) {
+		if v == 0 {
+			return
+		}
+		sb.WriteString(letter)
+		switch {
+		case abs:
+			sb.WriteString(strconv.Itoa(v))
+		case v != h:
+			sb.WriteString("[" + strconv.Itoa(v-h) + "]")
+		}
+	}
+	axis("R", c.Row, host.Row, c.RowAbs)
+	axis("C", c.Col, host.Col, c.ColAbs)
+	return sb.String()
+}
+
+// ParseR1C1Ref parses a reference in R1C1 notation like R[-1]C, R2C3:R4C5,
+// C[1] or Sheet1!R1C relative to anchor, the cell the reference is made from.
+// Returns ErrRef if the reference falls outside the sheet
+func ParseR1C1Ref(s string, anchor CellRef) (Ref, error) {
+	toks, err := lexWith(s, lexR1C1(anchor))
+	if err != nil {
+		return Ref{}, err
+	}
+	if len(toks) == 1 {
+		switch toks[0].kind {
+		case tokRef:
+			return toks[0].ref, nil
+		case tokError:
+			return Ref{}, ErrRef
+		}
+	}
+	return Ref{}, fmt.Errorf("invalid R1C1 reference %q", s)
+}
+
+// normalize orders the corners so that From is top left and To is bottom right
+func (r Ref) normalize() Ref {
+	if r.From.Row > r.To.Row {
+		r.From.Row, r.To.Row = r.To.Row, r.From.Row
+		r.From.RowAbs, r.To.RowAbs = r.To.RowAbs, r.From.RowAbs
+	}
+	if r.From.Col > r.To.Col {
+		r.From.Col, r.To.Col = r.To.Col, r.From.Col
+		r.From.ColAbs, r.To.ColAbs = r.To.ColAbs, r.From.ColAbs
+	}
+	return r
+}
+
+// bounds returns the rows and columns reference covers with whole columns and
+// rows extending to the limits of the sheet
+func (r Ref) bounds() (top, left, bottom, right int) {
+	top, left, bottom, right = r.From.Row, r.From.Col, r.To.Row, r.To.Col
+	if r.IsWholeColumn() {
+		top, bottom = 1, MaxRows
+	}
+	if r.IsWholeRow() {
+		left, right = 1, MaxColumns
+	}
+	return top, left, bottom, right
+}
+
+// resize returns the reference to the area with the top left cell of r and
+// the size of shape. The area is cut at the limits of the sheet, and covers
+// whole columns or rows when shape does and r starts at the sheet's edge
+func (r Ref) resize(shape Ref) Ref {
+	r = r.normalize()
+	top, left, _, _ := r.bounds()
+	t, l, b, rt := shape.normalize().bounds()
+	out := Ref{Sheet: r.Sheet, LastSheet: r.LastSheet, From: r.From, To: r.To}
+	out.From.Row, out.From.Col = top, left
+	out.To.Row, out.To.Col = minInt(top+b-t, MaxRows), minInt(left+rt-l, MaxColumns)
+	if top == 1 && shape.IsWholeColumn() {
+		out.From.Row, out.To.Row = 0, 0
+	}
+	if left == 1 && shape.IsWholeRow() {
+		out.From.Col, out.To.Col = 0, 0
+	}
+	return out
+}
+
+// intersect returns the cells common to both references, the space operator
+// of Excel. Returns ErrNull if the references do not overlap and ErrValue if
+// they are on different sheets
+func (r Ref) intersect(o Ref) (Ref, error) {
+	if !strings.EqualFold(r.Sheet, o.Sheet) || r.LastSheet != "" || o.LastSheet != "" {
+		return Ref{}, ErrValue
+	}
+	r, o = r.normalize(), o.normalize()
+	t1, l1, b1, r1 := r.bounds()
+	t2, l2, b2, r2 := o.bounds()
+	top, left := maxInt(t1, t2), maxInt(l1, l2)
+	bottom, right := minInt(b1, b2), minInt(r1, r2)
+	if top > bottom || left > right {
+		return Ref{}, ErrNull
+	}
+	out := Ref{Sheet: r.Sheet, From: CellRef{Row: top, Col: left}, To: CellRef{Row: bottom, Col: right}}
+	if r.IsWholeColumn() && o.IsWholeColumn() {
+		out.From.Row, out.To.Row = 0, 0
+	}
+	if r.IsWholeRow() && o.IsWholeRow() {
+		out.From.Col, out.To.Col = 0, 0
+	}
+	return out, nil
+}
+
+// implicitIntersection returns the cell of reference in the row or column of
+// host, the @ operator of Excel. A single cell is returned unchanged. Returns
+// ErrValue if reference is not a single row or column crossing host
+func (r Ref) implicitIntersection(host CellRef) (Ref, error) {
+	top, left, bottom, right := r.normalize().bounds()
+	cell := func(row, col int) Ref {
+		return Ref{Sheet: r.Sheet, LastSheet: r.LastSheet, From: CellRef{Row: row, Col: col}, To: CellRef{Row: row, Col: col}}
+	}
+	switch {
+	case r.LastSheet != "":
+	case top == bottom && left == right:
+		return cell(top, left), nil
+	case left == right && host.Row >= top && host.Row <= bottom:
+		return cell(host.Row, left), nil
+	case top == bottom && host.Col >= left && host.Col <= right:
+		return cell(top, host.Col), nil
+	}
+	return Ref{}, ErrValue
+}
+
+// sheetPrefix returns the sheets of reference followed by '!', empty for an
+// unqualified reference. Sheets of a 3D reference are quoted together
+func (r Ref) sheetPrefix() string {
+	switch {
+	case r.Sheet == "":
+		return ""
+	case r.LastSheet == "":
+		return quoteSheet(r.Sheet) + "!"
+	case quoteSheet(r.Sheet) == r.Sheet && quoteSheet(r.LastSheet) == r.LastSheet:
+		return r.Sheet + ":" + r.LastSheet + "!"
+	}
+	return quoteSheet(r.Sheet+":"+r.LastSheet) + "!"
+}
+
+// quoteSheet wraps sheet name in single quotes when Excel would require it
+func quoteSheet(name string) string {
+	plain := name != ""
+	for i, r := range name {
+		if !(unicode.IsLetter(r) || r == '_' || r == '.' || (i > 0 && unicode.IsDigit(r))) {
+			plain = false
+			break
+		}
+	}
+	if plain {
+		if _, err := ParseCellRef(name); err == nil {
+			plain = false
+		}
+	}
+	if plain {
+		return name
+	}
+	return "'" + strings.ReplaceAll(name, "'", "''") + "'"
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
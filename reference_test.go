@@ -0,0 +1,112 @@
+package efp
+
+import (
+	"testing"
+)
+
+func TestColumnName(t *testing.T) {
+	tt := []struct {
+		testName string
+		in       int
+		out      string
+	}{
+		{"Single letter", 1, "A"},
+		{"Last single letter", 26, "Z"},
+		{"Two letters", 28, "AB"},
+		{"Last column", MaxColumns, "XFD"},
+	}
+	var errCnt int
+	for _, tu := range tt {
+		s := ColumnName(tu.in)
+		if s != tu.out {
+			t.Logf("Test: %v, Expected: %v, Got: %v", tu.testName, tu.out, s)
+			errCnt++
+		}
+		if c := ColumnIndex(s); c != tu.in {
+			t.Logf("Test: %v, Round trip expected: %v, Got: %v", tu.testName, tu.in, c)
+			errCnt++
+		}
+	}
+	if errCnt > 0 {
+		t.Errorf("Failed %v of %v test cases", errCnt, len(tt))
+	}
+}
+
+func TestParseRef(t *testing.T) {
+	tt := []struct {
+		testName string
+		in       string
+		out      string
+		valid    bool
+	}{
+		{"Relative cell", "b4", "B4", true},
+		{"Absolute cell", "$B$4", "$B$4", true},
+		{"Mixed area", "$A1:B$4", "$A1:B$4", true},
+		{"Reversed area is normalized", "B4:A1", "A1:B4", true},
+		{"Sheet qualified", "Sheet1!A1", "Sheet1!A1", true},
+		{"Quoted sheet", "'Q1 Data'!A1:B2", "'Q1 Data'!A1:B2", true},
+		{"Quote inside sheet name", "'Bob''s'!C3", "'Bob''s'!C3", true},
+		{"Whole column", "Data!b:B", "Data!B:B", true},
+		{"Whole rows", "$3:5", "$3:5", true},
+		{"3D reference", "Sheet1:Sheet4!C5", "Sheet1:Sheet4!C5", true},
+		{"Quoted 3D reference", "'Jan 2020:Mar 2020'!A1:B2", "'Jan 2020:Mar 2020'!A1:B2", true},
+		{"Column out of range", "XFE1", "", false},
+		{"Row out of range", "A1048577", "", false},
+		{"Not a reference", "TaxRate", "", false},
+	}
+	var errCnt int
+	for _, tu := range tt {
+		r, err := ParseRef(tu.in)
+		if (err == nil) != tu.valid {
+			t.Logf("Test: %v, Expected valid: %v, Got error: %v", tu.testName, tu.valid, err)
+			errCnt++
+			continue
+		}
+		if tu.valid && r.String() != tu.out {
+			t.Logf("Test: %v, Expected: %v, Got: %v", tu.testName, tu.out, r.String())
+			errCnt++
+		}
+	}
+	if errCnt > 0 {
+		t.Errorf("Failed %v of %v test cases", errCnt, len(tt))
+	}
+}
+
+func TestR1C1(t *testing.T) {
+	host := CellRef{Row: 5, Col: 3}
+	tt := []struct {
+		testName string
+		in       string
+		out      string
+	}{
+		{"Same cell", "C5", "RC"},
+		{"Relative offsets", "B7", "R[2]C[-1]"},
+		{"Absolute cell", "$A$1", "R1C1"},
+		{"Mixed", "$A1", "R[-4]C1"},
+		{"Range on sheet", "'My Sheet'!A1:$D$10", "'My Sheet'!R[-4]C[-2]:R10C4"},
+		{"Whole column", "D:D", "C[1]"},
+		{"Whole rows", "$1:3", "R1:R[-2]"},
+	}
+	var errCnt int
+	for _, tu := range tt {
+		ref, err := ParseRef(tu.in)
+		if err != nil {
+			t.Logf("Test: %v, Parse failed, Error: %v", tu.testName, err)
+			errCnt++
+			continue
+		}
+		s := ref.R1C1(host)
+		if s != tu.out {
+			t.Logf("Test: %v, Expected: %v, Got: %v", tu.testName, tu.out, s)
+			errCnt++
+		}
+		back, err := ParseR1C1Ref(s, host)
+		if err != nil || back != ref {
+			t.Logf("Test: %v, Round trip expected: %v, Got: %v %v", tu.testName, ref, back, err)
+			errCnt++
+		}
+	}
+	if errCnt > 0 {
+		t.Errorf("Failed %v of %v test cases", errCnt, len(tt))
+	}
+}
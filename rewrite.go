@@ -0,0 +1,335 @@
+// Copyright © 2019 Praveen Tirumandyam praveen.tirumandyam@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package efp
+
+import (
+	"strings"
+)
+
+// Formula is a tokenized excel formula which can be inspected and rewritten
+// without evaluating it
+type Formula struct {
+	prefix string
+	tokens []token
+}
+
+// ParseFormula tokenizes the formula text. Leading '=' is optional and is
+// preserved when the formula is written back
+func ParseFormula(s string) (*Formula, error) {
+	return parseFormula(s, lexA1)
+}
+
+// ParseFormulaR1C1 tokenizes formula text written in R1C1 notation, like
+// =R[-1]C+RC[-2], for the cell anchor. References of the returned Formula are
+// in A1 notation; those falling outside the sheet become #REF!
+func ParseFormulaR1C1(s string, anchor CellRef) (*Formula, error) {
+	f, err := parseFormula(s, lexR1C1(anchor))
+	if err != nil {
+		return nil, err
+	}
+	for i, t := range f.tokens {
+		if t.kind == tokRef {
+			f.tokens[i].text = t.ref.String()
+		}
+	}
+	return f, nil
+}
+
+func parseFormula(s string, area refLexer) (*Formula, error) {
+	f := &Formula{}
+	if strings.HasPrefix(s, "=") {
+		f.prefix = "="
+		s = s[1:]
+	}
+	toks, err := lexWith(s, area)
+	if err != nil {
+		return nil, err
+	}
+	f.tokens = toks
+	return f, nil
+}
+
+// String returns the formula text
+func (f *Formula) String() string {
+	return f.prefix + joinTokens(f.tokens)
+}
+
+// R1C1 returns the formula text with references in R1C1 notation relative to
+// anchor, the cell holding the formula
+func (f *Formula) R1C1(anchor CellRef) string {
+	var sb strings.Builder
+	sb.WriteString(f.prefix)
+	for _, t := range f.tokens {
+		if t.kind == tokRef {
+			sb.WriteString(t.ref.R1C1(anchor))
+			continue
+		}
+		sb.WriteString(t.text)
+	}
+	return sb.String()
+}
+
+// ToR1C1 converts formula from A1 to R1C1 notation for the cell anchor
+func ToR1C1(formula string, anchor CellRef) (string, error) {
+	f, err := ParseFormula(formula)
+	if err != nil {
+		return "", err
+	}
+	return f.R1C1(anchor), nil
+}
+
+// FromR1C1 converts formula from R1C1 to A1 notation for the cell anchor
+func FromR1C1(formula string, anchor CellRef) (string, error) {
+	f, err := ParseFormulaR1C1(formula, anchor)
+	if err != nil {
+		return "", err
+	}
+	return f.String(), nil
+}
+
+// Refs returns all the cell and area references used in formula in the order
+// they appear
+func (f *Formula) Refs() []Ref {
+	refs := make([]Ref, 0)
+	for _, t := range f.tokens {
+		if t.kind == tokRef {
+			refs = append(refs, t.ref)
+		}
+	}
+	return refs
+}
+
+// EditKind is the kind of structural change made to a worksheet
+type EditKind int
+
+// Structural edits supported by Rewrite
+const (
+	InsertRows EditKind = iota
+	DeleteRows
+	InsertColumns
+	DeleteColumns
+	MoveRange
+	CopyOffset
+)
+
+// Edit describes a structural change to a worksheet.
+//
+// For inserts and deletes At is the first row or column affected and Count
+// the number of rows or columns. For MoveRange the cells in Source are cut and
+// pasted with their top left corner at Dest on the same sheet. For CopyOffset
+// the formula is copied Rows down and Cols right, negative values copy up and
+// left.
+//
+// Sheet is the sheet being edited; empty means the sheet the formula is on.
+type Edit struct {
+	Kind   EditKind
+	Sheet  string
+	At     int
+	Count  int
+	Source Ref
+	Dest   CellRef
+	Rows   int
+	Cols   int
+}
+
+// Rewrite returns the formula text after applying the edit to references the
+// way Excel does. host is the name of the sheet the formula is on and is used
+// to decide whether unqualified references are affected by the edit.
+// References to deleted cells and to cells overwritten by a move become #REF!
+func (f *Formula) Rewrite(host string, e Edit) string {
+	toks := make([]token, len(f.tokens))
+	copy(toks, f.tokens)
+	for i, t := range toks {
+		if t.kind != tokRef {
+			continue
+		}
+		ref, ok := rewriteRef(t.ref, host, e)
+		switch {
+		case !ok:
+			toks[i] = token{kind: tokError, text: refErrorText(t)}
+		case ref != t.ref:
+			toks[i] = token{kind: tokRef, text: ref.String(), ref: ref}
+		}
+	}
+	return f.prefix + joinTokens(toks)
+}
+
+// Rewrite applies the edit to formula text. See Formula.Rewrite
+func Rewrite(formula, host string, e Edit) (string, error) {
+	f, err := ParseFormula(formula)
+	if err != nil {
+		return "", err
+	}
+	return f.Rewrite(host, e), nil
+}
+
+// refErrorText keeps the sheet prefix of a reference turned into #REF!
+func refErrorText(t token) string {
+	if i := strings.LastIndex(t.text, "!"); i >= 0 {
+		return t.text[:i+1] + "#REF!"
+	}
+	return "#REF!"
+}
+
+// rewriteRef applies the edit to single reference. Returns false if the
+// reference became invalid
+func rewriteRef(r Ref, host string, e Edit) (Ref, bool) {
+	if e.Kind == CopyOffset {
+		return offsetRelative(r, e.Rows, e.Cols)
+	}
+	sheet := r.Sheet
+	if sheet == "" {
+		sheet = host
+	}
+	target := e.Sheet
+	if target == "" {
+		target = host
+	}
+	if !strings.EqualFold(sheet, target) {
+		return r, true
+	}
+	// Excel adjusts a 3D reference only when the edit covers every sheet of
+	// its span. An edit is made on one sheet, so only a span of that one
+	// sheet like Sheet1:Sheet1!A1 changes
+	if r.LastSheet != "" && !strings.EqualFold(r.LastSheet, sheet) {
+		return r, true
+	}
+	switch e.Kind {
+	case InsertRows:
+		return insertSpan(r, e.At, e.Count, rowAxis)
+	case DeleteRows:
+		return deleteSpan(r, e.At, e.Count, rowAxis)
+	case InsertColumns:
+		return insertSpan(r, e.At, e.Count, colAxis)
+	case DeleteColumns:
+		return deleteSpan(r, e.At, e.Count, colAxis)
+	case MoveRange:
+		return moveRef(r, e)
+	}
+	return r, true
+}
+
+type axis int
+
+const (
+	rowAxis axis = iota
+	colAxis
+)
+
+// span returns pointers to the start and end of reference along the axis
+func span(r *Ref, a axis) (*int, *int) {
+	if a == rowAxis {
+		return &r.From.Row, &r.To.Row
+	}
+	return &r.From.Col, &r.To.Col
+}
+
+func axisLimit(a axis) int {
+	if a == rowAxis {
+		return MaxRows
+	}
+	return MaxColumns
+}
+
+func insertSpan(r Ref, at, count int, a axis) (Ref, bool) {
+	lo, hi := span(&r, a)
+	if *lo >= at {
+		*lo += count
+	}
+	if *hi >= at {
+		*hi += count
+	}
+	if *lo > axisLimit(a) || *hi > axisLimit(a) {
+		return r, false
+	}
+	return r, true
+}
+
+func deleteSpan(r Ref, at, count int, a axis) (Ref, bool) {
+	last := at + count - 1
+	lo, hi := span(&r, a)
+	if *lo >= at && *hi <= last {
+		return r, false
+	}
+	switch {
+	case *lo > last:
+		*lo -= count
+	case *lo >= at:
+		*lo = at
+	}
+	switch {
+	case *hi > last:
+		*hi -= count
+	case *hi >= at:
+		*hi = at - 1
+	}
+	return r, true
+}
+
+// moveRef moves references inside the source of a move with it. References
+// to cells the move overwrites at the destination become invalid
+func moveRef(r Ref, e Edit) (Ref, bool) {
+	src := e.Source.normalize()
+	n := r.normalize()
+	dr := e.Dest.Row - src.From.Row
+	dc := e.Dest.Col - src.From.Col
+	if !inside(n, src) {
+		dest := src
+		dest.From.Row += dr
+		dest.To.Row += dr
+		dest.From.Col += dc
+		dest.To.Col += dc
+		return r, !inside(n, dest)
+	}
+	r.From.Row += dr
+	r.To.Row += dr
+	r.From.Col += dc
+	r.To.Col += dc
+	return r, inBounds(r)
+}
+
+// offsetRelative shifts the relative parts of reference. Whole columns stay
+// whole columns and whole rows stay whole rows
+func offsetRelative(r Ref, rows, cols int) (Ref, bool) {
+	for _, c := range []*CellRef{&r.From, &r.To} {
+		if !c.RowAbs && c.Row != 0 {
+			c.Row += rows
+			if c.Row < 1 || c.Row > MaxRows {
+				return r, false
+			}
+		}
+		if !c.ColAbs && c.Col != 0 {
+			c.Col += cols
+			if c.Col < 1 || c.Col > MaxColumns {
+				return r, false
+			}
+		}
+	}
+	return r, true
+}
+
+// inside reports whether the normalized reference r lies within area
+func inside(r, area Ref) bool {
+	return r.From.Row >= area.From.Row && r.To.Row <= area.To.Row && r.From.Col >= area.From.Col && r.To.Col <= area.To.Col
+}
+
+func inBounds(r Ref) bool {
+	for _, c := range []CellRef{r.From, r.To} {
+		if c.Row < 1 || c.Row > MaxRows || c.Col < 1 || c.Col > MaxColumns {
+			return false
+		}
+	}
+	return true
+}
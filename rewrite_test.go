@@ -0,0 +1,107 @@
+package efp
+
+import (
+	"testing"
+)
+
+func TestRewrite(t *testing.T) {
+	mustRef := func(s string) Ref {
+		r, err := ParseRef(s)
+		if err != nil {
+			t.Fatalf("invalid reference in test: %v", err)
+		}
+		return r
+	}
+	tt := []struct {
+		testName string
+		in       string
+		edit     Edit
+		out      string
+	}{
+		{"Insert rows above reference", "=A5+$B$6", Edit{Kind: InsertRows, At: 2, Count: 3}, "=A8+$B$9"},
+		{"Insert rows below reference", "=A5", Edit{Kind: InsertRows, At: 6, Count: 3}, "=A5"},
+		{"Insert rows inside area", "=SUM(A1:A5)", Edit{Kind: InsertRows, At: 3, Count: 2}, "=SUM(A1:A7)"},
+		{"Delete referenced row", "=A5+A6", Edit{Kind: DeleteRows, At: 5, Count: 1}, "=#REF!+A5"},
+		{"Delete rows inside area", "=SUM(A3:A8)", Edit{Kind: DeleteRows, At: 5, Count: 2}, "=SUM(A3:A6)"},
+		{"Delete top of area", "=SUM(A3:A8)", Edit{Kind: DeleteRows, At: 1, Count: 4}, "=SUM(A1:A4)"},
+		{"Delete whole area", "=SUM(A3:A4)", Edit{Kind: DeleteRows, At: 2, Count: 5}, "=SUM(#REF!)"},
+		{"Insert columns", "=C1&D1", Edit{Kind: InsertColumns, At: 4, Count: 1}, "=C1&E1"},
+		{"Delete column", "=Sheet2!C1", Edit{Kind: DeleteColumns, Sheet: "Sheet2", At: 3, Count: 1}, "=Sheet2!#REF!"},
+		{"Edit on other sheet", "=A5+Sheet2!A5", Edit{Kind: InsertRows, Sheet: "Sheet2", At: 1, Count: 1}, "=A5+Sheet2!A6"},
+		{"Copy down keeps absolute", "=A1*$B$1+A$1", Edit{Kind: CopyOffset, Rows: 2, Cols: 1}, "=B3*$B$1+B$1"},
+		{"Copy off the sheet", "=A1", Edit{Kind: CopyOffset, Rows: -1}, "=#REF!"},
+		{"Move range", "=A1+B2", Edit{Kind: MoveRange, Source: mustRef("A1:A3"), Dest: CellRef{Row: 10, Col: 3}}, "=C10+B2"},
+		{"Move over referenced cells", "=C11+SUM(C10:C12)+SUM(C9:C11)", Edit{Kind: MoveRange, Source: mustRef("A1:A3"), Dest: CellRef{Row: 10, Col: 3}}, "=#REF!+SUM(#REF!)+SUM(C9:C11)"},
+		{"Move onto itself shifted", "=A1+A4", Edit{Kind: MoveRange, Source: mustRef("A1:A3"), Dest: CellRef{Row: 2, Col: 1}}, "=A2+#REF!"},
+		{"Whole column ignores row edits", "=SUM(B:B)", Edit{Kind: DeleteRows, At: 1, Count: 5}, "=SUM(B:B)"},
+		{"Copy whole column right", "=SUM(B:B)", Edit{Kind: CopyOffset, Rows: 4, Cols: 1}, "=SUM(C:C)"},
+		{"3D reference from edited sheet", "=SUM(Sheet1:Sheet3!A5)", Edit{Kind: InsertRows, At: 2, Count: 3}, "=SUM(Sheet1:Sheet3!A5)"},
+		{"3D reference through edited sheet", "=SUM(Sheet1:Sheet3!A5:B6)", Edit{Kind: DeleteRows, Sheet: "Sheet2", At: 5, Count: 2}, "=SUM(Sheet1:Sheet3!A5:B6)"},
+		{"3D reference to edited sheet only", "=SUM(Sheet1:Sheet1!A5)", Edit{Kind: InsertRows, At: 2, Count: 3}, "=SUM(Sheet1:Sheet1!A8)"},
+		{"3D reference not moved", "=SUM(Sheet1:Sheet3!A1)", Edit{Kind: MoveRange, Source: mustRef("A1:A3"), Dest: CellRef{Row: 10, Col: 3}}, "=SUM(Sheet1:Sheet3!A1)"},
+		{"Copy shifts 3D reference", "=SUM(Sheet1:Sheet3!A1)", Edit{Kind: CopyOffset, Rows: 1}, "=SUM(Sheet1:Sheet3!A2)"},
+		{"Strings are untouched", `=CONCAT("A1", A1)`, Edit{Kind: InsertRows, At: 1, Count: 1}, `=CONCAT("A1", A2)`},
+	}
+	var errCnt int
+	for _, tu := range tt {
+		s, err := Rewrite(tu.in, "Sheet1", tu.edit)
+		if err != nil {
+			t.Logf("Test: %v, Rewrite failed, Error: %v", tu.testName, err)
+			errCnt++
+			continue
+		}
+		if s != tu.out {
+			t.Logf("Test: %v, Expected: %v, Got: %v", tu.testName, tu.out, s)
+			errCnt++
+		}
+	}
+	if errCnt > 0 {
+		t.Errorf("Failed %v of %v test cases", errCnt, len(tt))
+	}
+}
+
+func TestR1C1Formula(t *testing.T) {
+	anchor := CellRef{Row: 3, Col: 3}
+	tt := []struct {
+		testName string
+		a1       string
+		r1c1     string
+	}{
+		{"Relative", "=C2+A3", "=R[-1]C+RC[-2]"},
+		{"Absolute and mixed", "=$A$1*A$1+$B4", "=R1C1*R1C[-2]+R[1]C2"},
+		{"Ranges and sheets", "=SUM('Q1 Data'!B2:D4,Sheet2!$A:$A,2:3)", "=SUM('Q1 Data'!R[-1]C[-1]:R[1]C[1],Sheet2!C1,R[-1]:R)"},
+		{"Functions and strings untouched", `=IF(C3>0,"RC",LEFT(A1,1))`, `=IF(RC>0,"RC",LEFT(R[-2]C[-2],1))`},
+		{"Names untouched", "=Rate*C3", "=Rate*RC"},
+	}
+	var errCnt int
+	for _, tu := range tt {
+		r1c1, err := ToR1C1(tu.a1, anchor)
+		if err != nil || r1c1 != tu.r1c1 {
+			t.Logf("Test: %v, Expected: %v, Got: %v %v", tu.testName, tu.r1c1, r1c1, err)
+			errCnt++
+		}
+		a1, err := FromR1C1(tu.r1c1, anchor)
+		if err != nil || a1 != tu.a1 {
+			t.Logf("Test: %v, Expected: %v, Got: %v %v", tu.testName, tu.a1, a1, err)
+			errCnt++
+		}
+	}
+	outside := []struct {
+		r1c1 string
+		a1   string
+	}{
+		{"=R[-5]C+1", "=#REF!+1"},
+		{"=Sheet2!RC[-3]", "=Sheet2!#REF!"},
+		{"=r[1]c[1]", "=D4"},
+	}
+	for _, tu := range outside {
+		a1, err := FromR1C1(tu.r1c1, anchor)
+		if err != nil || a1 != tu.a1 {
+			t.Logf("Test: %v, Expected: %v, Got: %v %v", tu.r1c1, tu.a1, a1, err)
+			errCnt++
+		}
+	}
+	if errCnt > 0 {
+		t.Errorf("Failed %v of %v test cases", errCnt, 2*len(tt)+len(outside))
+	}
+}
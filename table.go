@@ -0,0 +1,286 @@
+// Copyright © 2019 Praveen Tirumandyam praveen.tirumandyam@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package efp
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Table is an Excel table: an area of a sheet whose first row names its
+// columns. Formulas refer to parts of a table with structured references like
+// Orders[Amount], Orders[[#Totals],[Qty]] or [@Price]
+type Table struct {
+	Name  string
+	Sheet string
+	// Ref is the area of the table including its header and totals rows
+	Ref     Ref
+	Columns []string
+	// HeaderRow is false for tables without a header row
+	HeaderRow bool
+	// TotalsRow is true when the last row of the table holds totals
+	TotalsRow bool
+}
+
+// AddTable creates a table named name over area of sheet. The first row of
+// area is the header row; its cells name the columns. Columns without a name
+// are named Column1, Column2 and so on like Excel does
+func (wb *Workbook) AddTable(name, sheet, area string) (*Table, error) {
+	s := wb.Sheet(sheet)
+	if s == nil {
+		return nil, fmt.Errorf("unknown sheet %s", sheet)
+	}
+	if !isDefinedName(name) {
+		return nil, fmt.Errorf("invalid table name %q", name)
+	}
+	if wb.Table(name) != nil {
+		return nil, fmt.Errorf("table %s already exists", name)
+	}
+	ref, err := ParseRef(area)
+	if err != nil {
+		return nil, err
+	}
+	if ref.Sheet != "" || ref.IsWholeColumn() || ref.IsWholeRow() {
+		return nil, fmt.Errorf("invalid table area %s", area)
+	}
+	t := &Table{Name: name, Sheet: s.Name, Ref: Ref{From: cellKey(ref.From), To: cellKey(ref.To)}, HeaderRow: true}
+	for col := ref.From.Col; col <= ref.To.Col; col++ {
+		var header string
+		if cell := s.Cells[CellRef{Row: ref.From.Row, Col: col}]; cell != nil {
+			header = FormatValue(cell.Value)
+		}
+		if header == "" {
+			header = fmt.Sprintf("Column%d", col-ref.From.Col+1)
+		}
+		t.Columns = append(t.Columns, header)
+	}
+	wb.Tables = append(wb.Tables, t)
+	return t, nil
+}
+
+// Table returns the table with name ignoring case, nil if no such table
+func (wb *Workbook) Table(name string) *Table {
+	for _, t := range wb.Tables {
+		if strings.EqualFold(t.Name, name) {
+			return t
+		}
+	}
+	return nil
+}
+
+// tableAt returns the table of sheet s covering cell k, nil if none
+func (wb *Workbook) tableAt(s *Sheet, k CellRef) *Table {
+	for _, t := range wb.Tables {
+		if strings.EqualFold(t.Sheet, s.Name) && k.Row >= t.Ref.From.Row && k.Row <= t.Ref.To.Row &&
+			k.Col >= t.Ref.From.Col && k.Col <= t.Ref.To.Col {
+			return t
+		}
+	}
+	return nil
+}
+
+// dataRows returns the first and last rows of the table holding data
+func (t *Table) dataRows() (int, int) {
+	from, to := t.Ref.From.Row, t.Ref.To.Row
+	if t.HeaderRow {
+		from++
+	}
+	if t.TotalsRow {
+		to--
+	}
+	return from, to
+}
+
+// column returns the sheet column of the table column named name
+func (t *Table) column(name string) (int, bool) {
+	for i, c := range t.Columns {
+		if strings.EqualFold(c, name) {
+			return t.Ref.From.Col + i, true
+		}
+	}
+	return 0, false
+}
+
+// structuredRef resolves structured reference text used by a formula in cell
+// host of sheet s to the area it covers. References without a table name
+// like [@Qty] refer to the table holding host. Parts of the table which do
+// not exist, like the totals row of a table without one, are ErrRef;
+// [#This Row] used outside the data rows is ErrValue
+func (wb *Workbook) structuredRef(text string, s *Sheet, host CellRef) (Ref, error) {
+	open := strings.IndexByte(text, '[')
+	var t *Table
+	if open == 0 {
+		if s != nil {
+			t = wb.tableAt(s, host)
+		}
+	} else {
+		t = wb.Table(text[:open])
+	}
+	if t == nil {
+		return Ref{}, ErrRef
+	}
+	spec, err := parseStructured(text[open+1 : len(text)-1])
+	if err != nil {
+		return Ref{}, err
+	}
+
+	ref := Ref{Sheet: t.Sheet, From: t.Ref.From, To: t.Ref.To}
+	dataFrom, dataTo := t.dataRows()
+	switch {
+	case spec.all:
+	case spec.thisRow:
+		if host.Row < dataFrom || host.Row > dataTo || (s != nil && !strings.EqualFold(s.Name, t.Sheet)) {
+			return Ref{}, ErrValue
+		}
+		ref.From.Row, ref.To.Row = host.Row, host.Row
+	default:
+		first, last := -1, -1
+		if spec.headers {
+			if !t.HeaderRow {
+				return Ref{}, ErrRef
+			}
+			first, last = t.Ref.From.Row, t.Ref.From.Row
+		}
+		if spec.data || !(spec.headers || spec.totals) {
+			if first < 0 {
+				first = dataFrom
+			}
+			last = dataTo
+		}
+		if spec.totals {
+			if !t.TotalsRow {
+				return Ref{}, ErrRef
+			}
+			if first < 0 {
+				first = t.Ref.To.Row
+			}
+			last = t.Ref.To.Row
+		}
+		if last < first {
+			return Ref{}, ErrRef
+		}
+		ref.From.Row, ref.To.Row = first, last
+	}
+	if spec.first != "" {
+		from, ok := t.column(spec.first)
+		if !ok {
+			return Ref{}, ErrRef
+		}
+		to, ok := t.column(spec.last)
+		if !ok {
+			return Ref{}, ErrRef
+		}
+		if from > to {
+			from, to = to, from
+		}
+		ref.From.Col, ref.To.Col = from, to
+	}
+	return ref, nil
+}
+
+// structuredSpec is the parsed part of a structured reference between the
+// outer brackets: the special items used and the columns
+type structuredSpec struct {
+	all, data, headers, totals, thisRow bool
+	// first and last are the columns covered, empty for all columns
+	first, last string
+}
+
+// parseStructured parses the specifiers of a structured reference like
+// Amount, @Qty, #Totals or [#Headers],[Qty]:[Price]
+func parseStructured(s string) (structuredSpec, error) {
+	var spec structuredSpec
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "@") {
+		spec.thisRow = true
+		s = strings.TrimSpace(s[1:])
+		if s == "" {
+			return spec, nil
+		}
+	}
+	if !strings.HasPrefix(s, "[") {
+		if s == "" {
+			return spec, nil
+		}
+		return spec, spec.item(s)
+	}
+	rs := []rune(s)
+	for i := 0; i < len(rs); {
+		end := lexBrackets(rs, i)
+		if rs[i] != '[' || end < 0 {
+			return spec, fmt.Errorf("invalid structured reference [%s]", s)
+		}
+		item := string(rs[i+1 : end-1])
+		i = end
+		if i < len(rs) && rs[i] == ':' {
+			// Column range like [Qty]:[Price]
+			next := lexBrackets(rs, i+1)
+			if next < 0 || rs[i+1] != '[' || spec.first != "" {
+				return spec, fmt.Errorf("invalid structured reference [%s]", s)
+			}
+			spec.first, spec.last = unescapeColumn(item), unescapeColumn(string(rs[i+2:next-1]))
+			i = next
+		} else if err := spec.item(item); err != nil {
+			return spec, err
+		}
+		for i < len(rs) && (rs[i] == ',' || rs[i] == ';' || rs[i] == ' ') {
+			i++
+		}
+	}
+	return spec, nil
+}
+
+// item adds a special item or a column to spec
+func (spec *structuredSpec) item(s string) error {
+	switch strings.ToUpper(strings.TrimSpace(s)) {
+	case "#ALL":
+		spec.all = true
+	case "#DATA":
+		spec.data = true
+	case "#HEADERS":
+		spec.headers = true
+	case "#TOTALS":
+		spec.totals = true
+	case "#THIS ROW", "@":
+		spec.thisRow = true
+	default:
+		if strings.HasPrefix(s, "@") {
+			spec.thisRow = true
+			s = s[1:]
+		}
+		if spec.first != "" {
+			return fmt.Errorf("structured reference names more than one column")
+		}
+		spec.first = unescapeColumn(s)
+		spec.last = spec.first
+	}
+	return nil
+}
+
+// unescapeColumn removes the ' escaping special characters in column names
+func unescapeColumn(s string) string {
+	if strings.HasPrefix(s, "[") && strings.HasSuffix(s, "]") {
+		s = s[1 : len(s)-1]
+	}
+	var sb strings.Builder
+	rs := []rune(s)
+	for i := 0; i < len(rs); i++ {
+		if rs[i] == '\'' && i+1 < len(rs) {
+			i++
+		}
+		sb.WriteRune(rs[i])
+	}
+	return sb.String()
+}
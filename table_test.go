@@ -0,0 +1,102 @@
+package efp
+
+import (
+	"context"
+	"testing"
+)
+
+func TestStructuredReferences(t *testing.T) {
+	wb := NewWorkbook()
+	s := wb.AddSheet("Sales")
+	wb.AddSheet("Report")
+	s.SetValue("A1", "Qty")
+	s.SetValue("B1", "Unit Price")
+	s.SetValue("C1", "Amount")
+	for i, row := range [][]float64{{2, 10}, {3, 20}, {5, 1}} {
+		r := string(rune('2' + i))
+		s.SetValue("A"+r, row[0])
+		s.SetValue("B"+r, row[1])
+		s.SetFormula("C"+r, "[@Qty]*[@[Unit Price]]")
+	}
+	s.SetFormula("A5", "SUM(Orders[Qty])")
+	s.SetFormula("C5", "SUM([Amount])")
+	orders, err := wb.AddTable("Orders", "Sales", "A1:C5")
+	if err != nil {
+		t.Fatalf("AddTable failed, Error: %v", err)
+	}
+	orders.TotalsRow = true
+	s.SetFormula("D3", "Orders[[#This Row],[Amount]]/Orders[[#Totals],[Amount]]")
+
+	tt := []struct {
+		formula string
+		out     interface{}
+	}{
+		{"SUM(Orders[Amount])", 85.0},
+		{"Orders[[#Totals],[Qty]]", 10.0},
+		{"SUM(Orders[[Qty]:[Unit Price]])", 41.0},
+		{"SUM(Orders)", 126.0},
+		{"SUM(Orders[#All])", 221.0},
+		{`COUNTIF(Orders[[#Headers],[Qty]:[Unit Price]],"*Price")`, 1.0},
+		{"SUM(Orders[[#Data],[#Totals],[Qty]])", 20.0},
+		{"Sales!D3", 60.0 / 85},
+		{"Orders[@Qty]", ErrValue},
+		{"SUM(Orders[Missing])", ErrRef},
+		{"NoTable[Qty]", ErrRef},
+	}
+	var errCnt int
+	for _, tu := range tt {
+		v, err := wb.EvaluateFormula(context.Background(), "Report", tu.formula, nil)
+		if e, ok := err.(ErrorValue); ok {
+			v, err = e, nil
+		}
+		if err != nil || v != tu.out {
+			t.Logf("Test: %v, Expected: %v, Got: %v %v", tu.formula, tu.out, v, err)
+			errCnt++
+		}
+	}
+	if err := wb.RecalculateParallel(context.Background(), 2); err != nil {
+		t.Fatalf("RecalculateParallel failed, Error: %v", err)
+	}
+	if v := s.Cell("C5").Value; v != 85.0 {
+		t.Logf("Test: recalculated total, Expected: %v, Got: %v", 85.0, v)
+		errCnt++
+	}
+	if _, err := wb.AddTable("Orders", "Report", "A1:B2"); err == nil {
+		t.Logf("Test: duplicate table, Expected error")
+		errCnt++
+	}
+	if errCnt > 0 {
+		t.Errorf("Failed %v of %v test cases", errCnt, len(tt)+2)
+	}
+}
+
+func TestReadXLSXTables(t *testing.T) {
+	parts := map[string]string{
+		"xl/workbook.xml": `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="Data" sheetId="1" r:id="rId1"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`,
+		"xl/worksheets/sheet1.xml": `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheetData>
+<row r="1"><c r="A1" t="inlineStr"><is><t>Qty</t></is></c><c r="B1" t="inlineStr"><is><t>Price</t></is></c><c r="C1" t="inlineStr"><is><t>Total</t></is></c></row>
+<row r="2"><c r="A2"><v>2</v></c><c r="B2"><v>3</v></c><c r="C2"><f>Items[[#This Row],[Qty]]*Items[[#This Row],[Price]]</f><v>6</v></c></row>
+<row r="3"><c r="A3"><v>4</v></c><c r="B3"><v>5</v></c><c r="C3"><f>Items[[#This Row],[Qty]]*Items[[#This Row],[Price]]</f><v>20</v></c></row>
+</sheetData><tableParts count="1"><tablePart r:id="rId1"/></tableParts></worksheet>`,
+		"xl/worksheets/_rels/sheet1.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/table" Target="../tables/table1.xml"/></Relationships>`,
+		"xl/tables/table1.xml": `<table xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" id="1" name="Table1" displayName="Items" ref="A1:C3">
+<tableColumns count="3"><tableColumn id="1" name="Qty"/><tableColumn id="2" name="Price"/><tableColumn id="3" name="Total"/></tableColumns></table>`,
+	}
+	r := testXLSX(t, parts)
+	wb, err := ReadXLSX(r, r.Size())
+	if err != nil {
+		t.Fatalf("ReadXLSX failed, Error: %v", err)
+	}
+	tb := wb.Table("Items")
+	if tb == nil || tb.Sheet != "Data" || len(tb.Columns) != 3 || !tb.HeaderRow || tb.TotalsRow {
+		t.Fatalf("Table not read, Got: %+v", tb)
+	}
+	v, err := wb.EvaluateFormula(context.Background(), "Data", "SUM(Items[Total])", nil)
+	if err != nil || v != 26.0 {
+		t.Errorf("Expected: %v, Got: %v %v", 26.0, v, err)
+	}
+}
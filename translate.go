@@ -0,0 +1,356 @@
+// Copyright © 2019 Praveen Tirumandyam praveen.tirumandyam@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package efp
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Roots of the variable paths used to carry references and error literals
+// through gval. See selectVariable
+const (
+	refRoot   = "_ref"
+	areaRoot  = "_area"
+	errorRoot = "_error"
+	nameRoot  = "_name"
+	tableRoot = "_table"
+)
+
+// Functions building the value of an array constant like {1,2;3,4}, which
+// becomes _ARRAY(_ROW(1,2),_ROW(3,4))
+const (
+	arrayFunc    = "_ARRAY"
+	arrayRowFunc = "_ROW"
+)
+
+// translate converts the tokens of an excel formula into a gval expression.
+// References and error literals become variable lookups which are resolved
+// against the parameter at evaluation time. Array constants become calls of
+// arrayFunc
+func translate(toks []token) string {
+	var sb strings.Builder
+	var inArray bool
+	for _, t := range referenceOperators(toks, refRoot, areaRoot, Ref.String) {
+		switch t.kind {
+		case tokOpen, tokClose, tokSep:
+			switch {
+			case t.text == "{":
+				sb.WriteString(arrayFunc + "(" + arrayRowFunc + "(")
+				inArray = true
+			case t.text == "}":
+				sb.WriteString("))")
+				inArray = false
+			case t.text == ";" && inArray:
+				sb.WriteString(")," + arrayRowFunc + "(")
+			default:
+				sb.WriteString(t.text)
+			}
+		case tokString:
+			sb.WriteString(strconv.Quote(unquoteString(t.text)))
+		case tokTable:
+			sb.WriteString(tableRoot + "[" + strconv.Quote(t.text) + "]")
+		case tokError:
+			sb.WriteString(errorRoot + "[" + strconv.Quote(t.text[strings.LastIndex(t.text, "#"):]) + "]")
+		case tokFunc:
+			sb.WriteString(functionName(t.text))
+		case tokName:
+			if strings.EqualFold(t.text, "TRUE") || strings.EqualFold(t.text, "FALSE") {
+				sb.WriteString(strings.ToUpper(t.text))
+				continue
+			}
+			if strings.Contains(t.text, "!") {
+				// Names qualified by a sheet are not valid gval identifiers
+				sb.WriteString(nameRoot + "[" + strconv.Quote(t.text) + "]")
+				continue
+			}
+			sb.WriteString(t.text)
+		case tokOp:
+			// gval reads consecutive operator symbols as one operator so
+			// they are kept apart
+			sb.WriteString(" " + t.text + " ")
+		default:
+			sb.WriteString(t.text)
+		}
+	}
+	return sb.String()
+}
+
+// referenceParameters are the functions whose first parameter is given the
+// reference itself rather than its value
+var referenceParameters = map[string]bool{"ROW": true, "COLUMN": true, "ROWS": true, "COLUMNS": true, "OFFSET": true}
+
+// resizedArguments are the functions with an argument Excel resizes to the
+// size of another argument: the sum range of SUMIF starts at its top left
+// cell and has the size of the range
+var resizedArguments = map[string][2]int{"SUMIF": {2, 0}}
+
+// referenceForms are the functions computing a reference. Given for a
+// reference parameter they are called in the form returning the Ref, which
+// is registered under their name prefixed by '_'
+var referenceForms = map[string]bool{"OFFSET": true, "INDIRECT": true}
+
+// referenceOperators replaces each reference with a lookup under root of its
+// text given by format. References joined by reference operators are looked
+// up together: the intersection of references separated by a space like
+// A1:B5 B3:D3, the union of references in parentheses like (A1:B2,C3) and
+// the implicit intersection @A1:A10, which files store as SINGLE(A1:A10).
+// See resolveRefs. References given for a reference parameter are looked up
+// under area and evaluate to their Ref. Ranges used where a single value is
+// expected are implicitly intersected, see takesSingleValue
+func referenceOperators(toks []token, root, area string, format func(Ref) string) []token {
+	toks = resizeArguments(toks)
+	out := make([]token, 0, len(toks))
+	var calls []call
+	for i := 0; i < len(toks); {
+		param := isReferenceParameter(toks, i)
+		if t := toks[i]; param && t.kind == tokFunc && referenceForms[functionName(t.text)] {
+			out = append(out, token{kind: tokFunc, text: "_" + functionName(t.text)})
+			i++
+			continue
+		}
+		text, n := refExpression(toks, i, format)
+		if n == 0 {
+			calls = nestCalls(calls, toks, i)
+			out = append(out, toks[i])
+			i++
+			continue
+		}
+		r := root
+		single := n == i+1 && !toks[i].ref.IsRange()
+		if k := skipSpaces(toks, n); param && k < len(toks) && (toks[k].kind == tokClose || toks[k].kind == tokSep) {
+			r = area
+		} else if !single && !strings.ContainsAny(text, "@,") && takesSingleValue(toks, i, n, calls) {
+			text = "@" + text
+		}
+		out = append(out, token{kind: tokOther, text: r + "[" + strconv.Quote(text) + "]"})
+		i = n
+	}
+	return out
+}
+
+// resizeArguments returns toks with the references given for the arguments
+// in resizedArguments resized to the reference given for the argument they
+// take the size of. Arguments other than a single reference are unchanged
+func resizeArguments(toks []token) []token {
+	var out []token
+	for i, t := range toks {
+		args, ok := resizedArguments[functionName(t.text)]
+		if t.kind != tokFunc || !ok || i+1 >= len(toks) || toks[i+1].kind != tokOpen {
+			continue
+		}
+		refs := argumentRefs(toks, i+1)
+		k, shape := refs[args[0]], refs[args[1]]
+		if k == 0 || shape == 0 {
+			continue
+		}
+		r := toks[k].ref.resize(toks[shape].ref)
+		if r == toks[k].ref.normalize() {
+			continue
+		}
+		if out == nil {
+			out = make([]token, len(toks))
+			copy(out, toks)
+		}
+		out[k] = token{kind: tokRef, text: r.String(), ref: r}
+	}
+	if out == nil {
+		return toks
+	}
+	return out
+}
+
+// argumentRefs returns the index of the reference given for each argument of
+// the call opened by toks[open], 0 for arguments other than a reference
+func argumentRefs(toks []token, open int) map[int]int {
+	refs := make(map[int]int)
+	arg, depth := 0, 0
+	for i := open + 1; i < len(toks) && depth >= 0; i++ {
+		switch t := toks[i]; {
+		case t.kind == tokOpen:
+			if depth == 0 {
+				refs[arg] = 0
+			}
+			depth++
+		case t.kind == tokClose:
+			depth--
+		case depth > 0 || t.kind == tokSpace:
+		case t.kind == tokSep && t.text == ",":
+			arg++
+		case t.kind == tokRef:
+			if _, seen := refs[arg]; !seen {
+				refs[arg] = i
+				continue
+			}
+			refs[arg] = 0
+		default:
+			refs[arg] = 0
+		}
+	}
+	return refs
+}
+
+// call is a function call enclosing a token and the argument the token is
+// part of. Parentheses and braces that do not call a function have no name
+type call struct {
+	name string
+	arg  int
+}
+
+// nestCalls returns the calls enclosing the tokens following toks[i]
+func nestCalls(calls []call, toks []token, i int) []call {
+	switch t := toks[i]; {
+	case t.kind == tokOpen:
+		var name string
+		if t.text == "(" && i > 0 && toks[i-1].kind == tokFunc {
+			name = functionName(toks[i-1].text)
+		}
+		return append(calls, call{name: name})
+	case t.kind == tokClose && len(calls) > 0:
+		return calls[:len(calls)-1]
+	case t.kind == tokSep && t.text == "," && len(calls) > 0:
+		calls[len(calls)-1].arg++
+	}
+	return calls
+}
+
+// takesSingleValue returns true if the reference expression toks[i:n] is
+// used where a single value is expected: as an operand of an operator or as
+// the argument of a number, text or boolean parameter other than a list of
+// values like the arguments of AND. Formulas written
+// before dynamic arrays implicitly intersect such references with the cell,
+// which is kept by looking them up as @ references. References within the
+// argument of an Array parameter, like those of SUMPRODUCT, keep all their
+// values
+func takesSingleValue(toks []token, i, n int, calls []call) bool {
+	for _, c := range calls {
+		if parameterType(c.name, c.arg) == arrayType {
+			return false
+		}
+	}
+	prev := i - 1
+	for prev >= 0 && toks[prev].kind == tokSpace {
+		prev--
+	}
+	next := skipSpaces(toks, n)
+	operator := func(k int) bool {
+		return k >= 0 && k < len(toks) && toks[k].kind == tokOp && toks[k].text != ":" && toks[k].text != "@"
+	}
+	if operator(prev) || operator(next) {
+		return true
+	}
+	if len(calls) == 0 || prev < 0 || next >= len(toks) ||
+		(toks[prev].kind != tokOpen && toks[prev].kind != tokSep) ||
+		(toks[next].kind != tokClose && toks[next].kind != tokSep) {
+		return false
+	}
+	c := calls[len(calls)-1]
+	if t := parameterType(c.name, c.arg); t != nil && !isListParameter(c.name, c.arg) {
+		switch t.Kind() {
+		case reflect.String, reflect.Bool, reflect.Float64, reflect.Int:
+			return true
+		}
+	}
+	return false
+}
+
+// isReferenceParameter returns true if toks[i] starts the first argument of
+// a function in referenceParameters
+func isReferenceParameter(toks []token, i int) bool {
+	j := i - 1
+	for j >= 0 && toks[j].kind == tokSpace {
+		j--
+	}
+	return j > 0 && toks[j].kind == tokOpen && toks[j].text == "(" &&
+		toks[j-1].kind == tokFunc && referenceParameters[functionName(toks[j-1].text)]
+}
+
+// refExpression reads the reference expression starting at toks[i]. Returns
+// its text and the index following it, 0 if there is no expression at i
+func refExpression(toks []token, i int, format func(Ref) string) (string, int) {
+	t := toks[i]
+	switch {
+	case t.kind == tokRef:
+		return intersection(toks, i, format)
+	case t.kind == tokOp && t.text == "@" && i+1 < len(toks) && toks[i+1].kind == tokRef:
+		text, n := intersection(toks, i+1, format)
+		return "@" + text, n
+	case t.kind == tokFunc && functionName(t.text) == "SINGLE" && i+2 < len(toks) && toks[i+1].kind == tokOpen:
+		text, n := intersection(toks, skipSpaces(toks, i+2), format)
+		if n == 0 {
+			return "", 0
+		}
+		if n = skipSpaces(toks, n); n < len(toks) && toks[n].kind == tokClose {
+			return "@" + text, n + 1
+		}
+	case t.kind == tokOpen && t.text == "(" && (i == 0 || toks[i-1].kind != tokFunc):
+		var parts []string
+		for j := i + 1; ; {
+			text, n := intersection(toks, skipSpaces(toks, j), format)
+			if n == 0 {
+				return "", 0
+			}
+			parts = append(parts, text)
+			j = skipSpaces(toks, n)
+			switch {
+			case j < len(toks) && toks[j].kind == tokSep && toks[j].text == ",":
+				j++
+			case j < len(toks) && toks[j].kind == tokClose && len(parts) > 1:
+				return strings.Join(parts, ","), j + 1
+			default:
+				// Plain parentheses are left to gval
+				return "", 0
+			}
+		}
+	}
+	return "", 0
+}
+
+// intersection reads references separated by spaces starting at toks[i]
+func intersection(toks []token, i int, format func(Ref) string) (string, int) {
+	if i >= len(toks) || toks[i].kind != tokRef {
+		return "", 0
+	}
+	parts := []string{format(toks[i].ref)}
+	n := i + 1
+	for n+1 < len(toks) && toks[n].kind == tokSpace && toks[n+1].kind == tokRef {
+		parts = append(parts, format(toks[n+1].ref))
+		n += 2
+	}
+	return strings.Join(parts, " "), n
+}
+
+func skipSpaces(toks []token, i int) int {
+	for i < len(toks) && toks[i].kind == tokSpace {
+		i++
+	}
+	return i
+}
+
+// unquoteString removes the quotes around an excel string literal
+func unquoteString(s string) string {
+	return strings.ReplaceAll(s[1:len(s)-1], `""`, `"`)
+}
+
+// functionName returns the name function is registered with. Files written
+// by Excel prefix functions newer than Excel 2007 with _xlfn.
+func functionName(name string) string {
+	name = strings.ToUpper(name)
+	for _, p := range []string{"_XLFN.", "_XLWS."} {
+		name = strings.TrimPrefix(name, p)
+	}
+	return name
+}
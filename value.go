@@ -0,0 +1,136 @@
+// Copyright © 2019 Praveen Tirumandyam praveen.tirumandyam@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package efp
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ErrorValue is an Excel error value like #N/A or #DIV/0!. It is used both as
+// a cell value and as the error returned when evaluating a formula fails the
+// way it would fail in Excel
+type ErrorValue string
+
+// Excel error values
+const (
+	ErrNull  ErrorValue = "#NULL!"
+	ErrDiv0  ErrorValue = "#DIV/0!"
+	ErrValue ErrorValue = "#VALUE!"
+	ErrRef   ErrorValue = "#REF!"
+	ErrName  ErrorValue = "#NAME?"
+	ErrNum   ErrorValue = "#NUM!"
+	ErrNA    ErrorValue = "#N/A"
+	ErrCalc  ErrorValue = "#CALC!"
+)
+
+func (e ErrorValue) Error() string {
+	return string(e)
+}
+
+// Array is a two dimensional block of values stored row by row. Evaluating an
+// area reference like A1:B3 produces an Array
+type Array [][]interface{}
+
+// Areas is the value of a reference made of several areas, like the 3D
+// reference Sheet1:Sheet3!A1:B2 holding an Array for each sheet. Functions
+// going through all values of their arguments like SUM and COUNT accept
+// Areas; elsewhere they are #VALUE!
+type Areas []Array
+
+// ValueType names the kind of formula value: "empty", "number", "text",
+// "logical", "error" or "array"
+func ValueType(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "empty"
+	case string:
+		return "text"
+	case bool:
+		return "logical"
+	case ErrorValue:
+		return "error"
+	case Array, Areas:
+		return "array"
+	}
+	if _, ok := asNumber(v); ok {
+		return "number"
+	}
+	return "text"
+}
+
+// FormatValue returns value as text the way Excel displays it in a General
+// formatted cell. Rows of an array are written on separate lines with tabs
+// between the columns
+func FormatValue(v interface{}) string {
+	if areas, ok := v.(Areas); ok {
+		parts := make([]string, len(areas))
+		for i, a := range areas {
+			parts[i] = FormatValue(a)
+		}
+		return strings.Join(parts, "\n")
+	}
+	arr, ok := v.(Array)
+	if !ok {
+		if n, ok := asNumber(v); ok {
+			return strconv.FormatFloat(n, 'G', 15, 64)
+		}
+		return toString(v)
+	}
+	var sb strings.Builder
+	for i, row := range arr {
+		if i > 0 {
+			sb.WriteString("\n")
+		}
+		for j, e := range row {
+			if j > 0 {
+				sb.WriteString("\t")
+			}
+			sb.WriteString(FormatValue(e))
+		}
+	}
+	return sb.String()
+}
+
+// toNumber converts value to number the way Excel does for arithmetic. Empty
+// values are 0, booleans are 1 or 0 and text must be numeric
+func toNumber(v interface{}) (float64, error) {
+	switch n := v.(type) {
+	case nil:
+		return 0, nil
+	case float64:
+		return n, nil
+	case int:
+		return float64(n), nil
+	case int64:
+		return float64(n), nil
+	case float32:
+		return float64(n), nil
+	case bool:
+		if n {
+			return 1, nil
+		}
+		return 0, nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(n), 64)
+		if err != nil {
+			return 0, ErrValue
+		}
+		return f, nil
+	case ErrorValue:
+		return 0, n
+	}
+	return 0, ErrValue
+}
@@ -0,0 +1,392 @@
+// Copyright © 2019 Praveen Tirumandyam praveen.tirumandyam@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package efp
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PaesslerAG/gval"
+)
+
+// Resolver provides values for the cell references used in a formula. Pass a
+// Resolver as the parameter when evaluating formula that refer to cells.
+// A single cell resolves to its value and an area resolves to an Array
+type Resolver interface {
+	Resolve(c context.Context, ref Ref) (interface{}, error)
+}
+
+// nameSelector is implemented by parameters which look up the first part of a
+// variable path themselves, like the scope of a formula in a workbook
+type nameSelector interface {
+	selectName(c context.Context, name string) (interface{}, bool, error)
+}
+
+// tableResolver is implemented by parameters which resolve structured
+// references to tables like Orders[Amount]
+type tableResolver interface {
+	resolveTable(c context.Context, text string) (interface{}, error)
+}
+
+// selectVariable resolves variables in formula. References are looked up
+// through Resolver when parameter implements it, otherwise by their A1 text
+// without '$' like any other variable.
+//
+// Other variables are looked up in the parameter which may be a map, struct
+// or slice nested to any depth. See Bind for how Go values are converted
+func selectVariable(path gval.Evaluables) gval.Evaluable {
+	return func(c context.Context, v interface{}) (interface{}, error) {
+		keys, err := path.EvalStrings(c, v)
+		if err != nil {
+			return nil, err
+		}
+		if len(keys) == 2 {
+			switch keys[0] {
+			case refRoot, relRoot, areaRoot, relAreaRoot:
+				refs, err := parseRefs(c, keys[1], keys[0] == relRoot || keys[0] == relAreaRoot)
+				if err != nil {
+					return nil, err
+				}
+				if keys[0] == areaRoot || keys[0] == relAreaRoot {
+					if len(refs) != 1 {
+						return nil, ErrValue
+					}
+					return refs[0], nil
+				}
+				return resolveRefs(c, v, refs)
+			case tableRoot:
+				if tr, ok := v.(tableResolver); ok {
+					return tr.resolveTable(c, keys[1])
+				}
+				return nil, fmt.Errorf("structured reference %s used without a workbook", keys[1])
+			case nameRoot:
+				if ns, ok := v.(nameSelector); ok {
+					val, ok, err := ns.selectName(c, keys[1])
+					if err != nil || ok {
+						return Bind(val), err
+					}
+				}
+				return nil, fmt.Errorf("unknown name %s", keys[1])
+			case errorRoot:
+				return nil, ErrorValue(keys[1])
+			}
+		}
+		if ns, ok := v.(nameSelector); ok {
+			root, ok, err := ns.selectName(c, keys[0])
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				return nil, fmt.Errorf("unknown parameter %s", keys[0])
+			}
+			v, keys = root, keys[1:]
+		}
+		for i, k := range keys {
+			var ok bool
+			v, ok = selectKey(v, k)
+			if !ok {
+				return nil, fmt.Errorf("unknown parameter %s", strings.Join(keys[:i+1], "."))
+			}
+		}
+		return Bind(v), nil
+	}
+}
+
+// parseRefs returns the areas of the reference expression text, see
+// referenceOperators. Expressions in R1C1 notation are relative to the cell
+// being evaluated
+func parseRefs(c context.Context, text string, r1c1 bool) ([]Ref, error) {
+	var toks []token
+	var err error
+	if r1c1 {
+		host, ok := hostFrom(c)
+		if !ok {
+			return nil, fmt.Errorf("relative reference %s evaluated without a cell", text)
+		}
+		toks, err = lexWith(text, lexR1C1(host))
+	} else {
+		toks, err = lex(text)
+	}
+	if err != nil {
+		return nil, err
+	}
+	implicit := len(toks) > 0 && toks[0].kind == tokOp && toks[0].text == "@"
+	if implicit {
+		toks = toks[1:]
+	}
+	var refs []Ref
+	area := -1
+	for _, t := range toks {
+		switch t.kind {
+		case tokRef:
+			if area < 0 {
+				area = len(refs)
+				refs = append(refs, t.ref)
+				continue
+			}
+			r, err := refs[area].intersect(t.ref)
+			if err != nil {
+				return nil, err
+			}
+			refs[area] = r
+		case tokError:
+			// R1C1 reference falling outside the sheet
+			return nil, ErrRef
+		case tokSep:
+			area = -1
+		case tokSpace:
+		default:
+			return nil, fmt.Errorf("invalid reference %q", text)
+		}
+	}
+	if len(refs) == 0 {
+		return nil, fmt.Errorf("invalid reference %q", text)
+	}
+	if implicit {
+		host, ok := hostFrom(c)
+		if !ok {
+			return nil, ErrValue
+		}
+		r, err := refs[0].implicitIntersection(host)
+		if err != nil {
+			return nil, err
+		}
+		refs[0] = r
+	}
+	return refs, nil
+}
+
+// resolveRefs resolves the areas of a reference. A union of several areas
+// resolves to Areas
+func resolveRefs(c context.Context, v interface{}, refs []Ref) (interface{}, error) {
+	if len(refs) == 1 {
+		return resolveRef(c, v, refs[0])
+	}
+	areas := make(Areas, 0, len(refs))
+	for _, r := range refs {
+		val, err := resolveRef(c, v, r)
+		if err != nil {
+			return nil, err
+		}
+		if a, ok := val.(Areas); ok {
+			areas = append(areas, a...)
+			continue
+		}
+		areas = append(areas, toArray(val))
+	}
+	return areas, nil
+}
+
+func resolveRef(c context.Context, v interface{}, ref Ref) (interface{}, error) {
+	if err := step(c); err != nil {
+		return nil, err
+	}
+	if r, ok := v.(Resolver); ok {
+		return r.Resolve(c, ref)
+	}
+	s := strings.ReplaceAll(ref.String(), "$", "")
+	val, ok := selectKey(v, s)
+	if !ok {
+		return nil, fmt.Errorf("unknown reference %s", s)
+	}
+	return Bind(val), nil
+}
+
+// Bind converts a Go value to the value formulas work with. Integers and
+// floats become float64, time.Time becomes a serial date and slices become
+// an Array: a slice of slices gives one row per element, a slice of structs
+// one row per element with a column per field, and any other slice a single
+// column. Maps and structs are returned unchanged so their fields can be
+// selected
+func Bind(v interface{}) interface{} {
+	switch val := v.(type) {
+	case nil, string, bool, float64, ErrorValue, Array, Areas:
+		return v
+	case time.Time:
+		return SerialDate(val)
+	}
+	if n, ok := asNumber(v); ok {
+		return n
+	}
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return rv.Float()
+	case reflect.String:
+		return rv.String()
+	case reflect.Bool:
+		return rv.Bool()
+	case reflect.Slice, reflect.Array:
+		return bindSlice(rv)
+	}
+	return rv.Interface()
+}
+
+func bindSlice(rv reflect.Value) Array {
+	arr := make(Array, 0, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		e := rv.Index(i)
+		for e.Kind() == reflect.Ptr || e.Kind() == reflect.Interface {
+			if e.IsNil() {
+				break
+			}
+			e = e.Elem()
+		}
+		switch e.Kind() {
+		case reflect.Slice, reflect.Array:
+			row := make([]interface{}, e.Len())
+			for j := range row {
+				row[j] = Bind(e.Index(j).Interface())
+			}
+			arr = append(arr, row)
+		case reflect.Struct:
+			if _, ok := e.Interface().(time.Time); ok {
+				arr = append(arr, []interface{}{Bind(e.Interface())})
+				continue
+			}
+			fields := structFields(e.Type())
+			row := make([]interface{}, len(fields.order))
+			for j, idx := range fields.order {
+				row[j] = Bind(e.FieldByIndex(idx).Interface())
+			}
+			arr = append(arr, row)
+		default:
+			if !e.IsValid() || ((e.Kind() == reflect.Ptr || e.Kind() == reflect.Interface) && e.IsNil()) {
+				arr = append(arr, []interface{}{nil})
+				continue
+			}
+			arr = append(arr, []interface{}{Bind(e.Interface())})
+		}
+	}
+	return arr
+}
+
+// selectKey returns the value stored under key in maps, slices and structs.
+// Selecting a field of a slice selects it from every element
+func selectKey(v interface{}, key string) (interface{}, bool) {
+	switch o := v.(type) {
+	case map[string]interface{}:
+		return o[key], true
+	case map[interface{}]interface{}:
+		return o[key], true
+	}
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return nil, false
+		}
+		rv = rv.Elem()
+	}
+	switch rv.Kind() {
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return nil, false
+		}
+		e := rv.MapIndex(reflect.ValueOf(key).Convert(rv.Type().Key()))
+		if !e.IsValid() {
+			return nil, true
+		}
+		return e.Interface(), true
+	case reflect.Slice, reflect.Array:
+		if i, err := strconv.Atoi(key); err == nil {
+			if i >= 0 && i < rv.Len() {
+				return rv.Index(i).Interface(), true
+			}
+			return nil, false
+		}
+		col := make([]interface{}, rv.Len())
+		for i := range col {
+			e, ok := selectKey(rv.Index(i).Interface(), key)
+			if !ok {
+				return nil, false
+			}
+			col[i] = e
+		}
+		return col, true
+	case reflect.Struct:
+		if idx, ok := structFields(rv.Type()).byName[strings.ToLower(key)]; ok {
+			return rv.FieldByIndex(idx).Interface(), true
+		}
+	}
+	return nil, false
+}
+
+// fieldSet lists the exported fields of a struct type. Fields are named by
+// their efp tag or else their Go name; names are matched ignoring case
+type fieldSet struct {
+	order  [][]int
+	byName map[string][]int
+}
+
+var fieldCache sync.Map
+
+func structFields(t reflect.Type) *fieldSet {
+	if fs, ok := fieldCache.Load(t); ok {
+		return fs.(*fieldSet)
+	}
+	fs := &fieldSet{byName: make(map[string][]int)}
+	collectFields(t, nil, fs)
+	fieldCache.Store(t, fs)
+	return fs
+}
+
+func collectFields(t reflect.Type, index []int, fs *fieldSet) {
+	// Fields of embedded structs are added after the fields declared directly
+	// so that the shallower field wins when names clash
+	embedded := make([][]int, 0)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		idx := append(append([]int(nil), index...), i)
+		tag := f.Tag.Get("efp")
+		if tag == "-" {
+			continue
+		}
+		if f.Anonymous && tag == "" && f.Type.Kind() == reflect.Struct {
+			embedded = append(embedded, idx)
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		name := f.Name
+		if tag != "" {
+			name = tag
+		}
+		key := strings.ToLower(name)
+		if _, dup := fs.byName[key]; dup {
+			continue
+		}
+		fs.byName[key] = idx
+		fs.order = append(fs.order, idx)
+	}
+	for _, idx := range embedded {
+		collectFields(t.FieldByIndex(idx).Type, idx, fs)
+	}
+}
@@ -0,0 +1,104 @@
+package efp
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testAudit struct {
+	Created time.Time `efp:"created"`
+}
+
+type testLine struct {
+	Item   string  `efp:"item"`
+	Amount float64 `efp:"amount"`
+	Qty    int     `efp:"qty"`
+	secret string
+}
+
+type testOrder struct {
+	testAudit
+	ID       int        `efp:"id"`
+	Qty      int        `efp:"qty"`
+	Customer *testCust  `efp:"customer"`
+	Lines    []testLine `efp:"lines"`
+	Tags     []string   `efp:"tags"`
+	Ignored  string     `efp:"-"`
+	Attrs    map[string]int
+}
+
+type testCust struct {
+	Name   string
+	Region string `efp:"region"`
+}
+
+func TestBinding(t *testing.T) {
+	order := &testOrder{
+		testAudit: testAudit{Created: time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		ID:        7,
+		Qty:       12,
+		Customer:  &testCust{Name: "Acme", Region: "North"},
+		Lines:     []testLine{{"Bolt", 2.5, 4, "x"}, {"Nut", 0.5, 10, "y"}},
+		Tags:      []string{"rush", "export"},
+		Ignored:   "hidden",
+		Attrs:     map[string]int{"priority": 3},
+	}
+	params := map[string]interface{}{
+		"order": order,
+		"limits": map[string]interface{}{
+			"qty":    map[string]interface{}{"max": 10},
+			"matrix": [][]float64{{1, 2}, {3, 4}},
+		},
+	}
+	tt := []struct {
+		exp string
+		out interface{}
+	}{
+		{`IF(order.qty > 10, "bulk", "single")`, "bulk"},
+		{`order.Qty > limits.qty.max`, true},
+		{`order.customer.name & " " & order.customer.region`, "Acme North"},
+		{`order.created`, 43466.0},
+		{`order.attrs.priority * 2`, 6.0},
+		{`SUM(order.lines.amount)`, 3.0},
+		{`SUMIF(order.lines.qty, ">5", order.lines.amount)`, 0.5},
+		{`COUNTIF(order.tags, "r*")`, 1.0},
+		{`SUM(limits.matrix)`, 10.0},
+		{`order.lines[1].item`, "Nut"},
+	}
+	var errCnt int
+	for _, tu := range tt {
+		eval, err := Parse(strings.NewReader(tu.exp))
+		if err != nil {
+			t.Logf("Expression: %v, Parse failed, Error: %v", tu.exp, err)
+			errCnt++
+			continue
+		}
+		v, err := eval(context.Background(), params)
+		if err != nil {
+			t.Logf("Expression: %v, Evaluation failed, Error: %v", tu.exp, err)
+			errCnt++
+			continue
+		}
+		if v != tu.out {
+			t.Logf("Expression: %v, Expected: %v, Got: %v", tu.exp, tu.out, v)
+			errCnt++
+		}
+	}
+	for _, exp := range []string{`order.ignored`, `order.secret`, `order.lines.secret`} {
+		eval, err := Parse(strings.NewReader(exp))
+		if err != nil {
+			t.Logf("Expression: %v, Parse failed, Error: %v", exp, err)
+			errCnt++
+			continue
+		}
+		if _, err := eval(context.Background(), params); err == nil {
+			t.Logf("Expression: %v, Expected unknown parameter error", exp)
+			errCnt++
+		}
+	}
+	if errCnt > 0 {
+		t.Errorf("Failed %v of %v test cases", errCnt, len(tt)+3)
+	}
+}
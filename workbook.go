@@ -0,0 +1,569 @@
+// Copyright © 2019 Praveen Tirumandyam praveen.tirumandyam@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package efp
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/PaesslerAG/gval"
+)
+
+// Workbook is a collection of sheets whose cells hold values and formulas.
+// Formulas of cells are compiled through Cache so that a formula copied
+// down a column is parsed once; with a nil Cache every formula is parsed
+// each time it is evaluated
+type Workbook struct {
+	Sheets []*Sheet
+	Names  []*DefinedName
+	Tables []*Table
+	Cache  *Cache
+}
+
+// workbookCacheSize is the size of the formula cache of new workbooks
+const workbookCacheSize = 4096
+
+// Sheet is a named grid of cells
+type Sheet struct {
+	Name  string
+	Cells map[CellRef]*Cell
+}
+
+// Cell holds a constant or a formula along with the last computed value of
+// the formula. Formula is stored without the leading '='
+type Cell struct {
+	Formula string
+	Value   interface{}
+	NumFmt  string
+}
+
+// DefinedName is a name given to a formula or reference. Scope is the name
+// of the sheet the name is local to; empty for names visible in the whole
+// workbook
+type DefinedName struct {
+	Name    string
+	Scope   string
+	Formula string
+}
+
+// NewWorkbook creates an empty workbook
+func NewWorkbook() *Workbook {
+	return &Workbook{Cache: NewCache(workbookCacheSize)}
+}
+
+// AddSheet adds a sheet to workbook. Returns the existing sheet if one with
+// same name is already present
+func (wb *Workbook) AddSheet(name string) *Sheet {
+	if s := wb.Sheet(name); s != nil {
+		return s
+	}
+	s := &Sheet{Name: name, Cells: make(map[CellRef]*Cell)}
+	wb.Sheets = append(wb.Sheets, s)
+	return s
+}
+
+// DefineName gives name to formula, which may be a constant, a reference like
+// Sheet1!$A$2:$A$100 or any other formula. scope is the sheet the name is
+// local to, empty for a name visible in the whole workbook. A name already
+// defined in the same scope is replaced
+func (wb *Workbook) DefineName(name, scope, formula string) error {
+	if !isDefinedName(name) {
+		return fmt.Errorf("invalid name %q", name)
+	}
+	if scope != "" && wb.Sheet(scope) == nil {
+		return fmt.Errorf("unknown sheet %s", scope)
+	}
+	formula = strings.TrimPrefix(formula, "=")
+	for _, n := range wb.Names {
+		if strings.EqualFold(n.Name, name) && strings.EqualFold(n.Scope, scope) {
+			n.Formula = formula
+			return nil
+		}
+	}
+	wb.Names = append(wb.Names, &DefinedName{Name: name, Scope: scope, Formula: formula})
+	return nil
+}
+
+// Name returns the defined name seen by formulas on sheet ignoring case: the
+// name local to sheet, else the one of the whole workbook. nil if no such name
+func (wb *Workbook) Name(sheet, name string) *DefinedName {
+	var global *DefinedName
+	for _, n := range wb.Names {
+		if !strings.EqualFold(n.Name, name) {
+			continue
+		}
+		switch {
+		case n.Scope == "":
+			global = n
+		case strings.EqualFold(n.Scope, sheet):
+			return n
+		}
+	}
+	return global
+}
+
+// definedName returns the defined name used by name in a formula on sheet s
+// along with the sheet the formula of the name is evaluated on: the sheet of
+// a local name, else s. name may be qualified by a sheet like Sheet1!Items to
+// use a name local to another sheet
+func (wb *Workbook) definedName(s *Sheet, name string) (*DefinedName, *Sheet) {
+	i := strings.LastIndex(name, "!")
+	if i >= 0 {
+		sheet := name[:i]
+		if strings.HasPrefix(sheet, "'") {
+			sheet = strings.ReplaceAll(sheet[1:len(sheet)-1], "''", "'")
+		}
+		if s = wb.Sheet(sheet); s == nil {
+			return nil, nil
+		}
+		name = name[i+1:]
+	}
+	n := wb.Name(s.Name, name)
+	switch {
+	case n == nil || (i >= 0 && n.Scope == ""):
+		return nil, nil
+	case n.Scope != "":
+		if local := wb.Sheet(n.Scope); local != nil {
+			s = local
+		}
+	}
+	return n, s
+}
+
+// isDefinedName returns true if s can be used as a defined name: a single
+// word which is neither a reference in A1 or R1C1 notation nor a boolean
+func isDefinedName(s string) bool {
+	toks, err := lex(s)
+	if err != nil || len(toks) != 1 || toks[0].kind != tokName || toks[0].text != s || strings.Contains(s, "!") {
+		return false
+	}
+	if strings.EqualFold(s, "TRUE") || strings.EqualFold(s, "FALSE") {
+		return false
+	}
+	rs := []rune(s)
+	_, n, _, ok := lexR1C1Cell(rs, 0, CellRef{Row: 1, Col: 1})
+	return !ok || n != len(rs)
+}
+
+// Sheet returns the sheet with name ignoring case, nil if no such sheet
+func (wb *Workbook) Sheet(name string) *Sheet {
+	for _, s := range wb.Sheets {
+		if strings.EqualFold(s.Name, name) {
+			return s
+		}
+	}
+	return nil
+}
+
+// cellKey drops the absolute markers so that $A$1 and A1 address same cell
+func cellKey(c CellRef) CellRef {
+	return CellRef{Row: c.Row, Col: c.Col}
+}
+
+// Cell returns the cell at reference like B4, nil if the cell is empty
+func (s *Sheet) Cell(ref string) *Cell {
+	c, err := ParseCellRef(ref)
+	if err != nil {
+		return nil
+	}
+	return s.Cells[cellKey(c)]
+}
+
+// UsedRange returns the smallest area covering all cells of sheet. Returns
+// false if sheet is empty
+func (s *Sheet) UsedRange() (Ref, bool) {
+	if len(s.Cells) == 0 {
+		return Ref{}, false
+	}
+	r := Ref{From: CellRef{Row: MaxRows, Col: MaxColumns}}
+	for k := range s.Cells {
+		if k.Row < r.From.Row {
+			r.From.Row = k.Row
+		}
+		if k.Col < r.From.Col {
+			r.From.Col = k.Col
+		}
+		if k.Row > r.To.Row {
+			r.To.Row = k.Row
+		}
+		if k.Col > r.To.Col {
+			r.To.Col = k.Col
+		}
+	}
+	return r, true
+}
+
+// SetValue stores a constant in cell
+func (s *Sheet) SetValue(ref string, v interface{}) error {
+	c, err := ParseCellRef(ref)
+	if err != nil {
+		return err
+	}
+	s.Cells[cellKey(c)] = &Cell{Value: v}
+	return nil
+}
+
+// SetFormula stores a formula in cell. Leading '=' is optional
+func (s *Sheet) SetFormula(ref string, formula string) error {
+	c, err := ParseCellRef(ref)
+	if err != nil {
+		return err
+	}
+	s.Cells[cellKey(c)] = &Cell{Formula: strings.TrimPrefix(formula, "=")}
+	return nil
+}
+
+// Evaluate computes the value of cell on sheet, evaluating the formulas it
+// depends on. Cached values of formula cells are not used
+func (wb *Workbook) Evaluate(c context.Context, sheet, ref string) (interface{}, error) {
+	s := wb.Sheet(sheet)
+	if s == nil {
+		return nil, fmt.Errorf("unknown sheet %s", sheet)
+	}
+	cr, err := ParseCellRef(ref)
+	if err != nil {
+		return nil, err
+	}
+	return newEvaluation(wb).newChain().cellValue(withNow(c), s, cellKey(cr))
+}
+
+// EvaluateFormula evaluates formula as if it was entered in a cell of sheet.
+// Names which are neither references nor defined names of workbook are
+// looked up in vars the same way they are looked up in the parameter passed
+// to an Evaluable, both in formula and in the formulas of the cells it
+// depends on
+func (wb *Workbook) EvaluateFormula(c context.Context, sheet, formula string, vars interface{}) (interface{}, error) {
+	s := wb.Sheet(sheet)
+	if s == nil {
+		return nil, fmt.Errorf("unknown sheet %s", sheet)
+	}
+	eval, err := parse(formula, maxDepth(c))
+	if err != nil {
+		return nil, err
+	}
+	ev := newEvaluation(wb)
+	ev.vars = vars
+	return eval(withNow(c), &sheetScope{ch: ev.newChain(), sheet: s})
+}
+
+// Recalculate evaluates every formula in workbook and stores the result as
+// the value of the cell. Excel errors are stored as ErrorValue; other
+// failures stop the recalculation. Cells are evaluated in sheet, row and
+// column order so the error returned does not change from run to run. See
+// RecalculateParallel for evaluating independent cells concurrently
+func (wb *Workbook) Recalculate(c context.Context) error {
+	c = withNow(c)
+	ch := newEvaluation(wb).newChain()
+	for _, n := range wb.formulaCells() {
+		v, err := ch.cellValue(c, n.sheet, n.key)
+		if e, ok := err.(ErrorValue); ok {
+			v, err = e, nil
+		}
+		if err != nil {
+			return err
+		}
+		n.cell.Value = v
+	}
+	return nil
+}
+
+// evaluation is a single pass over workbook. Values computed during the
+// pass are remembered so each formula is evaluated at most once; they may
+// be computed by several goroutines. Values are keyed by the *Cell holding
+// the formula or the nameKey of a defined name. Names which are not defined
+// in workbook are looked up in vars
+type evaluation struct {
+	wb   *Workbook
+	vars interface{}
+
+	mu     sync.Mutex
+	values map[interface{}]interface{}
+	errs   map[interface{}]error
+}
+
+// nameKey identifies the value of a defined name used on a sheet. Names of
+// the whole workbook may refer to cells of the sheet using them
+type nameKey struct {
+	name  *DefinedName
+	sheet *Sheet
+}
+
+func newEvaluation(wb *Workbook) *evaluation {
+	return &evaluation{
+		wb:     wb,
+		values: make(map[interface{}]interface{}),
+		errs:   make(map[interface{}]error),
+	}
+}
+
+// result returns the remembered value of formula cell or defined name
+func (ev *evaluation) result(key interface{}) (interface{}, error, bool) {
+	ev.mu.Lock()
+	defer ev.mu.Unlock()
+	v, ok := ev.values[key]
+	return v, ev.errs[key], ok
+}
+
+func (ev *evaluation) remember(key interface{}, v interface{}, err error) {
+	ev.mu.Lock()
+	defer ev.mu.Unlock()
+	ev.values[key] = v
+	ev.errs[key] = err
+}
+
+// chain is the formulas one goroutine is evaluating, each waiting for the
+// value of a cell or defined name it refers to. It detects circular
+// references and bounds how deep references are followed
+type chain struct {
+	ev     *evaluation
+	active map[interface{}]bool
+}
+
+func (ev *evaluation) newChain() *chain {
+	return &chain{ev: ev, active: make(map[interface{}]bool)}
+}
+
+// cellValue returns value of the cell, evaluating it if it holds a formula
+func (ch *chain) cellValue(c context.Context, s *Sheet, k CellRef) (interface{}, error) {
+	cell := s.Cells[k]
+	if cell == nil {
+		return nil, nil
+	}
+	if cell.Formula == "" {
+		if e, ok := cell.Value.(ErrorValue); ok {
+			return nil, e
+		}
+		return cell.Value, nil
+	}
+	if v, err, ok := ch.ev.result(cell); ok {
+		return v, err
+	}
+	if ch.active[cell] {
+		return nil, fmt.Errorf("circular reference at %s!%s", quoteSheet(s.Name), k)
+	}
+	if err := checkChainDepth(c, len(ch.active)+1); err != nil {
+		return nil, err
+	}
+	ch.active[cell] = true
+	defer delete(ch.active, cell)
+
+	eval, err := ch.ev.wb.compile(c, cell.Formula, k)
+	if err != nil {
+		return nil, fmt.Errorf("%s!%s: %v", quoteSheet(s.Name), k, err)
+	}
+	v, err := eval(c, &sheetScope{ch: ch, sheet: s})
+	if _, ok := err.(ErrorValue); ok || err == nil {
+		ch.ev.remember(cell, v, err)
+	}
+	return v, err
+}
+
+// nameValue evaluates the formula of defined name n on sheet s
+func (ch *chain) nameValue(c context.Context, n *DefinedName, s *Sheet) (interface{}, error) {
+	key := nameKey{name: n, sheet: s}
+	if v, err, ok := ch.ev.result(key); ok {
+		return v, err
+	}
+	if ch.active[key] {
+		return nil, fmt.Errorf("circular reference in name %s", n.Name)
+	}
+	if err := checkChainDepth(c, len(ch.active)+1); err != nil {
+		return nil, err
+	}
+	ch.active[key] = true
+	defer delete(ch.active, key)
+
+	eval, err := ch.ev.wb.compileName(c, n.Formula)
+	if err != nil {
+		return nil, fmt.Errorf("name %s: %v", n.Name, err)
+	}
+	v, err := eval(c, &sheetScope{ch: ch, sheet: s})
+	if _, ok := err.(ErrorValue); ok || err == nil {
+		ch.ev.remember(key, v, err)
+	}
+	return v, err
+}
+
+// compile parses formula of the cell at host, through the cache when the
+// workbook has one
+func (wb *Workbook) compile(c context.Context, formula string, host CellRef) (gval.Evaluable, error) {
+	if wb.Cache == nil {
+		eval, err := parse(formula, maxDepth(c))
+		if err != nil {
+			return nil, err
+		}
+		return atHost(eval, host), nil
+	}
+	e, err := wb.Cache.compile(formula, &host)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkNesting(e.depth, maxDepth(c)); err != nil {
+		return nil, err
+	}
+	return atHost(e.eval, host), nil
+}
+
+// compileName parses the formula of a defined name. References in names do
+// not move with the cell using the name so they are kept in A1 notation
+func (wb *Workbook) compileName(c context.Context, formula string) (gval.Evaluable, error) {
+	if wb.Cache == nil {
+		return parse(formula, maxDepth(c))
+	}
+	e, err := wb.Cache.compile(formula, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkNesting(e.depth, maxDepth(c)); err != nil {
+		return nil, err
+	}
+	return e.eval, nil
+}
+
+// sheetScope resolves references made by formulas on sheet
+type sheetScope struct {
+	ch    *chain
+	sheet *Sheet
+}
+
+// selectName implements nameSelector. Defined names and table names, which
+// stand for the data rows of the table, are looked up before vars; names
+// qualified by a sheet like Sheet1!Items only find the names
+// local to that sheet
+func (sc *sheetScope) selectName(c context.Context, name string) (interface{}, bool, error) {
+	if n, s := sc.ch.ev.wb.definedName(sc.sheet, name); n != nil {
+		if err := step(c); err != nil {
+			return nil, false, err
+		}
+		v, err := sc.ch.nameValue(c, n, s)
+		return v, true, err
+	}
+	if t := sc.ch.ev.wb.Table(name); t != nil && !strings.Contains(name, "!") {
+		v, err := sc.resolveTable(c, t.Name+"[]")
+		return v, true, err
+	}
+	if strings.Contains(name, "!") || sc.ch.ev.vars == nil {
+		return nil, false, nil
+	}
+	v, ok := selectKey(sc.ch.ev.vars, name)
+	return v, ok, nil
+}
+
+// resolveTable implements tableResolver
+func (sc *sheetScope) resolveTable(c context.Context, text string) (interface{}, error) {
+	host, _ := hostFrom(c)
+	ref, err := sc.ch.ev.wb.structuredRef(text, sc.sheet, host)
+	if err != nil {
+		return nil, err
+	}
+	return resolveRef(c, sc, ref)
+}
+
+// Resolve implements Resolver
+func (sc *sheetScope) Resolve(c context.Context, ref Ref) (interface{}, error) {
+	sheets, ok := sc.ch.ev.wb.refSheets(ref, sc.sheet)
+	if !ok {
+		return nil, ErrRef
+	}
+	if ref.LastSheet == "" {
+		return sc.resolveOn(c, sheets[0], ref)
+	}
+	areas := make(Areas, 0, len(sheets))
+	for _, s := range sheets {
+		v, err := sc.resolveOn(c, s, ref)
+		if e, ok := err.(ErrorValue); ok {
+			v, err = e, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		areas = append(areas, toArray(v))
+	}
+	return areas, nil
+}
+
+// refSheets returns the sheets ref covers when used on sheet s: s for
+// unqualified references and every sheet from Sheet to LastSheet for 3D
+// references. Returns false if a sheet does not exist
+func (wb *Workbook) refSheets(ref Ref, s *Sheet) ([]*Sheet, bool) {
+	if ref.Sheet == "" {
+		return []*Sheet{s}, true
+	}
+	first, last := -1, -1
+	for i, sh := range wb.Sheets {
+		if strings.EqualFold(sh.Name, ref.Sheet) {
+			first = i
+		}
+		if strings.EqualFold(sh.Name, ref.LastSheet) {
+			last = i
+		}
+	}
+	switch {
+	case first < 0:
+		return nil, false
+	case ref.LastSheet == "":
+		return wb.Sheets[first : first+1], true
+	case last < 0:
+		return nil, false
+	case first > last:
+		first, last = last, first
+	}
+	return wb.Sheets[first : last+1], true
+}
+
+// resolveOn returns the values of the cells of ref on sheet s
+func (sc *sheetScope) resolveOn(c context.Context, s *Sheet, ref Ref) (interface{}, error) {
+	if !ref.IsRange() {
+		return sc.ch.cellValue(c, s, cellKey(ref.From))
+	}
+	// Whole columns and rows are limited to the used part of sheet
+	if ref.IsWholeColumn() || ref.IsWholeRow() {
+		used, ok := s.UsedRange()
+		if !ok {
+			return Array{}, nil
+		}
+		if ref.IsWholeColumn() {
+			ref.From.Row, ref.To.Row = 1, used.To.Row
+		}
+		if ref.IsWholeRow() {
+			ref.From.Col, ref.To.Col = 1, used.To.Col
+		}
+	}
+	rows, cols := ref.To.Row-ref.From.Row+1, ref.To.Col-ref.From.Col+1
+	if err := checkArraySize(c, float64(rows)*float64(cols)); err != nil {
+		return nil, err
+	}
+	arr := make(Array, 0, rows)
+	for r := ref.From.Row; r <= ref.To.Row; r++ {
+		if err := c.Err(); err != nil {
+			return nil, err
+		}
+		row := make([]interface{}, 0, cols)
+		for col := ref.From.Col; col <= ref.To.Col; col++ {
+			v, err := sc.ch.cellValue(c, s, CellRef{Row: r, Col: col})
+			if e, ok := err.(ErrorValue); ok {
+				v, err = e, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			row = append(row, v)
+		}
+		arr = append(arr, row)
+	}
+	return arr, nil
+}
@@ -0,0 +1,222 @@
+package efp
+
+import (
+	"context"
+	"strconv"
+	"testing"
+)
+
+func TestWorkbookRecalculate(t *testing.T) {
+	wb := NewWorkbook()
+	s := wb.AddSheet("Sheet1")
+	other := wb.AddSheet("Other Sheet")
+	s.SetValue("A1", 10.0)
+	s.SetValue("A2", "text")
+	s.SetFormula("B1", "=A1*2")
+	s.SetFormula("B2", "B1+'Other Sheet'!A1")
+	s.SetFormula("B3", "A2&B2")
+	s.SetFormula("B4", "A1/C1")
+	s.SetFormula("B5", "-A1^2+50%")
+	other.SetValue("A1", 5.0)
+	if err := wb.Recalculate(context.Background()); err != nil {
+		t.Fatalf("Recalculate failed, Error: %v", err)
+	}
+	tt := []struct {
+		cell string
+		out  interface{}
+	}{
+		{"B1", 20.0},
+		{"B2", 25.0},
+		{"B3", "text25"},
+		{"B4", ErrDiv0},
+		{"B5", 100.5},
+	}
+	var errCnt int
+	for _, tu := range tt {
+		if v := s.Cell(tu.cell).Value; v != tu.out {
+			t.Logf("Cell: %v, Expected: %v, Got: %v", tu.cell, tu.out, v)
+			errCnt++
+		}
+	}
+	if errCnt > 0 {
+		t.Errorf("Failed %v of %v test cases", errCnt, len(tt))
+	}
+}
+
+func TestWorkbookCircularReference(t *testing.T) {
+	wb := NewWorkbook()
+	s := wb.AddSheet("Sheet1")
+	s.SetFormula("A1", "B1+1")
+	s.SetFormula("B1", "A1+1")
+	if _, err := wb.Evaluate(context.Background(), "Sheet1", "A1"); err == nil {
+		t.Errorf("Expected circular reference error")
+	}
+}
+
+func TestDefinedNames(t *testing.T) {
+	wb := NewWorkbook()
+	s := wb.AddSheet("Sheet1")
+	other := wb.AddSheet("Q1 Data")
+	for i, v := range []float64{10, 20, 30} {
+		s.SetValue("A"+string(rune('2'+i)), v)
+	}
+	other.SetValue("A1", 5.0)
+	s.SetFormula("B1", "SUM(Items)*(1+TaxRate)")
+	s.SetFormula("B2", "Rate")
+	s.SetFormula("B3", "'Q1 Data'!Rate*2")
+	s.SetFormula("B4", "Total")
+	other.SetFormula("B1", "Rate+Offset")
+	for _, n := range []struct{ name, scope, formula string }{
+		{"TaxRate", "", "0.5"},
+		{"Items", "", "=Sheet1!$A$2:$A$4"},
+		{"Total", "", "SUM(Items)"},
+		{"Rate", "", "1"},
+		{"Rate", "Q1 Data", "$A$1"},
+		{"Offset", "", "Rate*100"},
+	} {
+		if err := wb.DefineName(n.name, n.scope, n.formula); err != nil {
+			t.Fatalf("DefineName failed, Error: %v", err)
+		}
+	}
+	if err := wb.Recalculate(context.Background()); err != nil {
+		t.Fatalf("Recalculate failed, Error: %v", err)
+	}
+	tt := []struct {
+		sheet *Sheet
+		cell  string
+		out   interface{}
+	}{
+		{s, "B1", 90.0},
+		{s, "B2", 1.0},
+		{s, "B3", 10.0},
+		{s, "B4", 60.0},
+		// Names of the whole workbook see the local names of the sheet using them
+		{other, "B1", 505.0},
+	}
+	var errCnt int
+	for _, tu := range tt {
+		if v := tu.sheet.Cell(tu.cell).Value; v != tu.out {
+			t.Logf("Cell: %v, Expected: %v, Got: %v", tu.cell, tu.out, v)
+			errCnt++
+		}
+	}
+	if v, err := wb.EvaluateFormula(context.Background(), "Sheet1", "TaxRate+x", map[string]interface{}{"x": 1, "TaxRate": 2}); v != 1.5 {
+		t.Logf("Test: names before vars, Expected: %v, Got: %v %v", 1.5, v, err)
+		errCnt++
+	}
+	wb.DefineName("Loop", "", "Loop+1")
+	if _, err := wb.EvaluateFormula(context.Background(), "Sheet1", "Loop", nil); err == nil {
+		t.Logf("Test: circular name, Expected error")
+		errCnt++
+	}
+	for _, name := range []string{"A1", "R1C1", "rc", "TRUE", "1x", "two words", "Sheet1!x"} {
+		if err := wb.DefineName(name, "", "1"); err == nil {
+			t.Logf("Test: invalid name %q, Expected error", name)
+			errCnt++
+		}
+	}
+	if errCnt > 0 {
+		t.Errorf("Failed %v of %v test cases", errCnt, len(tt)+9)
+	}
+}
+
+func TestThreeDReferences(t *testing.T) {
+	wb := NewWorkbook()
+	for i, name := range []string{"Sheet1", "Q1 Data", "Sheet3", "Sheet4"} {
+		s := wb.AddSheet(name)
+		s.SetValue("C5", float64(i+1))
+		s.SetValue("A1", "text")
+	}
+	sum := wb.AddSheet("Summary")
+	sum.SetFormula("A1", "SUM(Sheet1:Sheet4!C5)")
+	sum.SetFormula("A2", "COUNT(Sheet1:Sheet3!A1:C5)")
+	sum.SetFormula("A3", "SUM('Q1 Data:Sheet4'!C5)")
+	sum.SetFormula("A4", "SUM(Sheet4:Sheet1!C:C)")
+	sum.SetFormula("A5", "SUM(Sheet1:Missing!C5)")
+	sum.SetFormula("A6", "MID(\"abc\",Sheet1:Sheet4!C5,1)")
+	sum.SetFormula("A7", "Sheet3!C5+'Q1 Data'!C5")
+	tt := []struct {
+		cell string
+		out  interface{}
+	}{
+		{"A1", 10.0},
+		{"A2", 3.0},
+		{"A3", 9.0},
+		{"A4", 10.0},
+		{"A5", ErrRef},
+		{"A6", ErrValue},
+		{"A7", 5.0},
+	}
+	var errCnt int
+	for _, recalc := range []func() error{
+		func() error { return wb.Recalculate(context.Background()) },
+		func() error { return wb.RecalculateParallel(context.Background(), 4) },
+	} {
+		if err := recalc(); err != nil {
+			t.Fatalf("Recalculate failed, Error: %v", err)
+		}
+		for _, tu := range tt {
+			if v := sum.Cell(tu.cell).Value; v != tu.out {
+				t.Logf("Test: %v, Expected: %v, Got: %v", tu.cell, tu.out, v)
+				errCnt++
+			}
+		}
+	}
+	if errCnt > 0 {
+		t.Errorf("Failed %v of %v test cases", errCnt, 2*len(tt))
+	}
+}
+
+func TestReferenceOperators(t *testing.T) {
+	for _, cache := range []*Cache{nil, NewCache(100)} {
+		wb := NewWorkbook()
+		wb.Cache = cache
+		s := wb.AddSheet("Sheet1")
+		for row := 1; row <= 5; row++ {
+			for col := 1; col <= 4; col++ {
+				s.SetValue(ColumnName(col)+strconv.Itoa(row), float64(row*10+col))
+			}
+		}
+		tt := []struct {
+			cell    string
+			formula string
+			out     interface{}
+		}{
+			{"F1", "SUM((A1:B5 B3:D3))", 32.0},
+			{"F2", "SUM(A1:B5 B2:D3)", 22.0 + 32.0},
+			{"F3", "SUM((A1:A2,C1:C2))", 11.0 + 21.0 + 13.0 + 23.0},
+			{"F4", "COUNT((A1:B2 B1:B2,D5))", 3.0},
+			{"F5", "SUM(A1:A2 C1:C2)", ErrNull},
+			{"F6", "A:A 3:3", 31.0},
+			{"E3", "@A1:A5", 31.0},
+			{"E4", "_xlfn.SINGLE(A1:A5)*2", 82.0},
+			{"E5", "@A1:B5", ErrValue},
+			{"G1", "@B1:D1", ErrValue},
+			{"G2", "@B1", 12.0},
+			{"G3", "@(A1:B5 B3:D3)", 32.0},
+			{"H2", "A1:A3*2", 42.0},
+			{"H3", "-A1:A5", -31.0},
+			{"H4", "SUM(A1:A5*2)", 82.0},
+			{"H5", `LEN(REPT("x",A1:A5))`, 51.0},
+			{"H6", "SUM(A1:A5)", 155.0},
+			{"H7", "A1:A3*2", ErrValue},
+			{"H8", "COUNT((A1:A3,B1:B2))", 5.0},
+		}
+		for _, tu := range tt {
+			s.SetFormula(tu.cell, tu.formula)
+		}
+		if err := wb.Recalculate(context.Background()); err != nil {
+			t.Fatalf("Recalculate failed, Error: %v", err)
+		}
+		var errCnt int
+		for _, tu := range tt {
+			if v := s.Cell(tu.cell).Value; v != tu.out {
+				t.Logf("Test: %v, Expected: %v, Got: %v", tu.formula, tu.out, v)
+				errCnt++
+			}
+		}
+		if errCnt > 0 {
+			t.Errorf("Failed %v of %v test cases", errCnt, len(tt))
+		}
+	}
+}
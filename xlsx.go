@@ -0,0 +1,446 @@
+// Copyright © 2019 Praveen Tirumandyam praveen.tirumandyam@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package efp
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SpreadsheetML parts of an .xlsx package that are read by efp.
+// Only the elements and attributes efp uses are mapped
+
+type xlsxWorkbook struct {
+	Pr           xlsxWorkbookPr    `xml:"workbookPr"`
+	Sheets       []xlsxSheet       `xml:"sheets>sheet"`
+	DefinedNames []xlsxDefinedName `xml:"definedNames>definedName"`
+}
+
+type xlsxWorkbookPr struct {
+	Date1904 bool `xml:"date1904,attr"`
+}
+
+type xlsxSheet struct {
+	Name    string `xml:"name,attr"`
+	SheetID int    `xml:"sheetId,attr"`
+	RID     string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+}
+
+type xlsxDefinedName struct {
+	Name         string `xml:"name,attr"`
+	LocalSheetID *int   `xml:"localSheetId,attr"`
+	Formula      string `xml:",chardata"`
+}
+
+type xlsxRelationships struct {
+	Relationships []xlsxRelationship `xml:"Relationship"`
+}
+
+type xlsxRelationship struct {
+	ID     string `xml:"Id,attr"`
+	Type   string `xml:"Type,attr"`
+	Target string `xml:"Target,attr"`
+}
+
+type xlsxSST struct {
+	Items []xlsxSI `xml:"si"`
+}
+
+type xlsxSI struct {
+	T    string `xml:"t"`
+	Runs []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (si xlsxSI) text() string {
+	if len(si.Runs) == 0 {
+		return si.T
+	}
+	var sb strings.Builder
+	for _, r := range si.Runs {
+		sb.WriteString(r.T)
+	}
+	return sb.String()
+}
+
+type xlsxStyleSheet struct {
+	NumFmts []xlsxNumFmt `xml:"numFmts>numFmt"`
+	CellXfs []xlsxXf     `xml:"cellXfs>xf"`
+}
+
+type xlsxNumFmt struct {
+	ID   int    `xml:"numFmtId,attr"`
+	Code string `xml:"formatCode,attr"`
+}
+
+type xlsxXf struct {
+	NumFmtID int `xml:"numFmtId,attr"`
+}
+
+type xlsxWorksheet struct {
+	Rows       []xlsxRow       `xml:"sheetData>row"`
+	TableParts []xlsxTablePart `xml:"tableParts>tablePart"`
+}
+
+type xlsxTablePart struct {
+	RID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+}
+
+type xlsxTable struct {
+	Name           string            `xml:"name,attr"`
+	DisplayName    string            `xml:"displayName,attr"`
+	Ref            string            `xml:"ref,attr"`
+	HeaderRowCount *int              `xml:"headerRowCount,attr"`
+	TotalsRowCount int               `xml:"totalsRowCount,attr"`
+	TableColumns   []xlsxTableColumn `xml:"tableColumns>tableColumn"`
+}
+
+type xlsxTableColumn struct {
+	Name string `xml:"name,attr"`
+}
+
+type xlsxRow struct {
+	R     int        `xml:"r,attr"`
+	Cells []xlsxCell `xml:"c"`
+}
+
+type xlsxCell struct {
+	R  string       `xml:"r,attr"`
+	T  string       `xml:"t,attr"`
+	S  int          `xml:"s,attr"`
+	F  *xlsxFormula `xml:"f"`
+	V  *string      `xml:"v"`
+	IS *xlsxSI      `xml:"is"`
+}
+
+type xlsxFormula struct {
+	T    string `xml:"t,attr"`
+	Ref  string `xml:"ref,attr"`
+	Si   string `xml:"si,attr"`
+	Text string `xml:",chardata"`
+}
+
+// builtinNumFmts are the number formats Excel does not write into styles.xml
+var builtinNumFmts = map[int]string{
+	1: "0", 2: "0.00", 3: "#,##0", 4: "#,##0.00", 9: "0%", 10: "0.00%", 11: "0.00E+00",
+	12: "# ?/?", 13: "# ??/??", 14: "mm-dd-yy", 15: "d-mmm-yy", 16: "d-mmm", 17: "mmm-yy",
+	18: "h:mm AM/PM", 19: "h:mm:ss AM/PM", 20: "h:mm", 21: "h:mm:ss", 22: "m/d/yy h:mm",
+	37: "#,##0 ;(#,##0)", 38: "#,##0 ;[Red](#,##0)", 39: "#,##0.00;(#,##0.00)", 40: "#,##0.00;[Red](#,##0.00)",
+	45: "mm:ss", 46: "[h]:mm:ss", 47: "mmss.0", 48: "##0.0E+0", 49: "@",
+}
+
+// OpenXLSX reads the workbook stored in .xlsx file at name
+func OpenXLSX(name string) (*Workbook, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return ReadXLSX(f, st.Size())
+}
+
+// ReadXLSX reads an .xlsx package into a workbook. Formulas are read along
+// with the values Excel cached for them; number cells keep their format code
+// in NumFmt so date cells can be recognised
+func ReadXLSX(r io.ReaderAt, size int64) (*Workbook, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	var wbXML xlsxWorkbook
+	if err := readXMLPart(files, "xl/workbook.xml", &wbXML); err != nil {
+		return nil, err
+	}
+	var rels xlsxRelationships
+	if err := readXMLPart(files, "xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return nil, err
+	}
+	var sst xlsxSST
+	if _, ok := files["xl/sharedStrings.xml"]; ok {
+		if err := readXMLPart(files, "xl/sharedStrings.xml", &sst); err != nil {
+			return nil, err
+		}
+	}
+	var styles xlsxStyleSheet
+	if _, ok := files["xl/styles.xml"]; ok {
+		if err := readXMLPart(files, "xl/styles.xml", &styles); err != nil {
+			return nil, err
+		}
+	}
+	strs := make([]string, len(sst.Items))
+	for i, si := range sst.Items {
+		strs[i] = si.text()
+	}
+	fmts := make(map[int]string)
+	for _, nf := range styles.NumFmts {
+		fmts[nf.ID] = nf.Code
+	}
+	styleFmt := func(s int) string {
+		if s < 0 || s >= len(styles.CellXfs) {
+			return ""
+		}
+		id := styles.CellXfs[s].NumFmtID
+		if code, ok := fmts[id]; ok {
+			return code
+		}
+		return builtinNumFmts[id]
+	}
+	targets := make(map[string]string)
+	for _, rel := range rels.Relationships {
+		t := rel.Target
+		if strings.HasPrefix(t, "/") {
+			t = strings.TrimPrefix(t, "/")
+		} else {
+			t = path.Join("xl", t)
+		}
+		targets[rel.ID] = t
+	}
+
+	wb := NewWorkbook()
+	for _, sh := range wbXML.Sheets {
+		part, ok := targets[sh.RID]
+		if !ok {
+			return nil, fmt.Errorf("xlsx: no part for sheet %s", sh.Name)
+		}
+		var ws xlsxWorksheet
+		if err := readXMLPart(files, part, &ws); err != nil {
+			return nil, err
+		}
+		s := wb.AddSheet(sh.Name)
+		if err := readCells(s, ws, strs, styleFmt, wbXML.Pr.Date1904); err != nil {
+			return nil, fmt.Errorf("xlsx: sheet %s: %v", sh.Name, err)
+		}
+		if err := readTables(wb, s, files, part, ws.TableParts); err != nil {
+			return nil, err
+		}
+	}
+	for _, dn := range wbXML.DefinedNames {
+		n := &DefinedName{Name: dn.Name, Formula: dn.Formula}
+		if dn.LocalSheetID != nil && *dn.LocalSheetID >= 0 && *dn.LocalSheetID < len(wb.Sheets) {
+			n.Scope = wb.Sheets[*dn.LocalSheetID].Name
+		}
+		wb.Names = append(wb.Names, n)
+	}
+	return wb, nil
+}
+
+// readTables adds the tables of sheet s stored in part to workbook
+func readTables(wb *Workbook, s *Sheet, files map[string]*zip.File, part string, parts []xlsxTablePart) error {
+	if len(parts) == 0 {
+		return nil
+	}
+	var rels xlsxRelationships
+	dir, file := path.Split(part)
+	if err := readXMLPart(files, path.Join(dir, "_rels", file+".rels"), &rels); err != nil {
+		return err
+	}
+	targets := make(map[string]string)
+	for _, rel := range rels.Relationships {
+		if strings.HasPrefix(rel.Target, "/") {
+			targets[rel.ID] = strings.TrimPrefix(rel.Target, "/")
+		} else {
+			targets[rel.ID] = path.Join(dir, rel.Target)
+		}
+	}
+	for _, tp := range parts {
+		var tx xlsxTable
+		if err := readXMLPart(files, targets[tp.RID], &tx); err != nil {
+			return err
+		}
+		ref, err := ParseRef(tx.Ref)
+		if err != nil {
+			return fmt.Errorf("xlsx: table %s: %v", tx.Name, err)
+		}
+		t := &Table{
+			Name:      tx.DisplayName,
+			Sheet:     s.Name,
+			Ref:       ref,
+			HeaderRow: tx.HeaderRowCount == nil || *tx.HeaderRowCount > 0,
+			TotalsRow: tx.TotalsRowCount > 0,
+		}
+		if t.Name == "" {
+			t.Name = tx.Name
+		}
+		for _, col := range tx.TableColumns {
+			t.Columns = append(t.Columns, col.Name)
+		}
+		wb.Tables = append(wb.Tables, t)
+	}
+	return nil
+}
+
+func readXMLPart(files map[string]*zip.File, name string, v interface{}) error {
+	f, ok := files[name]
+	if !ok {
+		return fmt.Errorf("xlsx: missing part %s", name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	if err := xml.NewDecoder(rc).Decode(v); err != nil {
+		return fmt.Errorf("xlsx: %s: %v", name, err)
+	}
+	return nil
+}
+
+// sharedFormula is the master of a shared formula group. Other cells of the
+// group carry only the group index and get the master's formula shifted by
+// their distance from the master cell
+type sharedFormula struct {
+	at      CellRef
+	formula *Formula
+}
+
+// readCells adds the cells of worksheet ws to s. Dates of workbooks using the
+// 1904 date system are converted to the 1900 date system efp works in
+func readCells(s *Sheet, ws xlsxWorksheet, strs []string, styleFmt func(int) string, date1904 bool) error {
+	shared := make(map[string]sharedFormula)
+	for ri, row := range ws.Rows {
+		rowNum := row.R
+		if rowNum == 0 {
+			rowNum = ri + 1
+		}
+		col := 0
+		for _, xc := range row.Cells {
+			at := CellRef{Row: rowNum, Col: col + 1}
+			if xc.R != "" {
+				c, err := ParseCellRef(xc.R)
+				if err != nil {
+					return err
+				}
+				at = cellKey(c)
+			}
+			col = at.Col
+
+			cell := &Cell{NumFmt: styleFmt(xc.S)}
+			v, err := xlsxValue(xc, strs)
+			if err != nil {
+				return fmt.Errorf("%s: %v", at, err)
+			}
+			if n, ok := v.(float64); ok && date1904 && xc.T != "d" && IsDateFormat(cell.NumFmt) {
+				v = n + date1904Offset
+			}
+			cell.Value = v
+			if xc.F != nil {
+				formula := xc.F.Text
+				if xc.F.T == "shared" {
+					if sf, ok := shared[xc.F.Si]; ok && formula == "" {
+						formula = sf.formula.Rewrite(s.Name, Edit{Kind: CopyOffset, Rows: at.Row - sf.at.Row, Cols: at.Col - sf.at.Col})
+					} else if formula != "" {
+						f, err := ParseFormula(formula)
+						if err != nil {
+							return fmt.Errorf("%s: %v", at, err)
+						}
+						shared[xc.F.Si] = sharedFormula{at: at, formula: f}
+					}
+				}
+				cell.Formula = formula
+			}
+			if cell.Formula == "" && cell.Value == nil {
+				continue
+			}
+			s.Cells[at] = cell
+		}
+	}
+	return nil
+}
+
+// xlsxValue decodes the value stored in cell according to its type
+func xlsxValue(xc xlsxCell, strs []string) (interface{}, error) {
+	if xc.T == "inlineStr" {
+		if xc.IS == nil {
+			return "", nil
+		}
+		return xc.IS.text(), nil
+	}
+	if xc.V == nil {
+		return nil, nil
+	}
+	v := *xc.V
+	switch xc.T {
+	case "s":
+		i, err := strconv.Atoi(v)
+		if err != nil || i < 0 || i >= len(strs) {
+			return nil, fmt.Errorf("invalid shared string index %q", v)
+		}
+		return strs[i], nil
+	case "str":
+		return v, nil
+	case "b":
+		return v == "1", nil
+	case "e":
+		return ErrorValue(v), nil
+	case "d":
+		t, err := time.Parse("2006-01-02T15:04:05", strings.TrimSuffix(v, "Z"))
+		if err != nil {
+			if t, err = time.Parse("2006-01-02", v); err != nil {
+				return nil, err
+			}
+		}
+		return SerialDate(t), nil
+	}
+	if v == "" {
+		return nil, nil
+	}
+	return strconv.ParseFloat(v, 64)
+}
+
+// IsDateFormat returns true if number format code displays a date or time
+func IsDateFormat(code string) bool {
+	inQuote := false
+	for i := 0; i < len(code); i++ {
+		ch := code[i]
+		switch {
+		case ch == '"':
+			inQuote = !inQuote
+		case inQuote:
+		case ch == '\\':
+			i++
+		case ch == '[':
+			// Elapsed time like [h] is a time format, colours and conditions are not
+			end := strings.IndexByte(code[i:], ']')
+			if end < 0 {
+				return false
+			}
+			inner := strings.ToLower(code[i+1 : i+end])
+			if inner == "h" || inner == "hh" || inner == "m" || inner == "mm" || inner == "s" || inner == "ss" {
+				return true
+			}
+			i += end
+		case strings.IndexByte("dmyhsDMYHS", ch) >= 0:
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,204 @@
+package efp
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testXLSX builds a minimal .xlsx package in memory from the given parts
+func testXLSX(t *testing.T, parts map[string]string) *bytes.Reader {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range parts {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return bytes.NewReader(buf.Bytes())
+}
+
+var testParts = map[string]string{
+	"xl/workbook.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="Data" sheetId="1" r:id="rId1"/><sheet name="Q1 Report" sheetId="2" r:id="rId2"/></sheets>
+<definedNames><definedName name="TaxRate">Data!$B$1</definedName><definedName name="Local" localSheetId="1">'Q1 Report'!$A$1</definedName></definedNames>
+</workbook>`,
+	"xl/_rels/workbook.xml.rels": `<?xml version="1.0" encoding="UTF-8"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="/xl/worksheets/sheet2.xml"/>
+</Relationships>`,
+	"xl/sharedStrings.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><si><t>Hello</t></si><si><r><t>Rich </t></r><r><t>Text</t></r></si></sst>`,
+	"xl/styles.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<numFmts count="1"><numFmt numFmtId="164" formatCode="yyyy\-mm\-dd"/></numFmts>
+<cellXfs count="3"><xf numFmtId="0"/><xf numFmtId="14"/><xf numFmtId="164"/></cellXfs>
+</styleSheet>`,
+	"xl/worksheets/sheet1.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>
+<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1"><v>0.5</v></c><c r="C1" s="1"><v>43466</v></c></row>
+<row r="2"><c r="A2"><v>2</v></c><c r="B2"><f t="shared" ref="B2:B4" si="0">A2*10</f><v>20</v></c></row>
+<row r="3"><c r="A3"><v>3</v></c><c r="B3"><f t="shared" si="0"/><v>30</v></c></row>
+<row r="4"><c r="A4"><v>4</v></c><c r="B4"><f t="shared" si="0"/><v>40</v></c></row>
+<row r="5"><c r="A5" t="b"><v>1</v></c><c r="B5" t="e"><v>#N/A</v></c><c r="C5" t="inlineStr"><is><t>inline</t></is></c></row>
+</sheetData></worksheet>`,
+	"xl/worksheets/sheet2.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>
+<row r="1"><c r="A1" t="s"><v>1</v></c><c r="B1" t="str"><f>Data!A1&amp;" "&amp;A1</f><v>Hello Rich Text</v></c></row>
+<row r="2"><c r="A2" s="2"><f>Data!B4*Data!B1</f><v>20</v></c></row>
+</sheetData></worksheet>`,
+}
+
+func TestReadXLSX(t *testing.T) {
+	r := testXLSX(t, testParts)
+	wb, err := ReadXLSX(r, int64(r.Len()))
+	if err != nil {
+		t.Fatalf("ReadXLSX failed, Error: %v", err)
+	}
+	tt := []struct {
+		testName string
+		sheet    string
+		cell     string
+		formula  string
+		value    interface{}
+		numFmt   string
+	}{
+		{"Shared string", "Data", "A1", "", "Hello", ""},
+		{"Number", "Data", "B1", "", 0.5, ""},
+		{"Date", "Data", "C1", "", 43466.0, "mm-dd-yy"},
+		{"Shared formula master", "Data", "B2", "A2*10", 20.0, ""},
+		{"Shared formula follower", "Data", "B4", "A4*10", 40.0, ""},
+		{"Boolean", "Data", "A5", "", true, ""},
+		{"Error", "Data", "B5", "", ErrNA, ""},
+		{"Inline string", "Data", "C5", "", "inline", ""},
+		{"Rich text shared string", "Q1 Report", "A1", "", "Rich Text", ""},
+		{"String formula", "Q1 Report", "B1", `Data!A1&" "&A1`, "Hello Rich Text", ""},
+		{"Custom number format", "Q1 Report", "A2", "Data!B4*Data!B1", 20.0, `yyyy\-mm\-dd`},
+	}
+	var errCnt int
+	for _, tu := range tt {
+		s := wb.Sheet(tu.sheet)
+		if s == nil {
+			t.Logf("Test: %v, Sheet %v not found", tu.testName, tu.sheet)
+			errCnt++
+			continue
+		}
+		c := s.Cell(tu.cell)
+		if c == nil {
+			t.Logf("Test: %v, Cell %v not found", tu.testName, tu.cell)
+			errCnt++
+			continue
+		}
+		if c.Formula != tu.formula || c.Value != tu.value || c.NumFmt != tu.numFmt {
+			t.Logf("Test: %v, Expected: %q %v %q, Got: %q %v %q", tu.testName, tu.formula, tu.value, tu.numFmt, c.Formula, c.Value, c.NumFmt)
+			errCnt++
+		}
+	}
+	if len(wb.Names) != 2 || wb.Names[0].Formula != "Data!$B$1" || wb.Names[1].Scope != "Q1 Report" {
+		t.Logf("Test: Defined names, Got: %v", wb.Names)
+		errCnt++
+	}
+	if errCnt > 0 {
+		t.Errorf("Failed %v of %v test cases", errCnt, len(tt)+1)
+	}
+}
+
+func TestXLSXCachedValues(t *testing.T) {
+	r := testXLSX(t, testParts)
+	wb, err := ReadXLSX(r, int64(r.Len()))
+	if err != nil {
+		t.Fatalf("ReadXLSX failed, Error: %v", err)
+	}
+	var errCnt, total int
+	for _, s := range wb.Sheets {
+		for k, c := range s.Cells {
+			if c.Formula == "" {
+				continue
+			}
+			total++
+			v, err := wb.Evaluate(context.Background(), s.Name, k.String())
+			if err != nil {
+				t.Logf("Cell: %v!%v, Evaluation failed, Error: %v", s.Name, k, err)
+				errCnt++
+				continue
+			}
+			if v != c.Value {
+				t.Logf("Cell: %v!%v, Expected: %v, Got: %v", s.Name, k, c.Value, v)
+				errCnt++
+			}
+		}
+	}
+	if errCnt > 0 {
+		t.Errorf("Failed %v of %v formula cells", errCnt, total)
+	}
+}
+
+func TestXLSXDate1904(t *testing.T) {
+	parts := make(map[string]string, len(testParts))
+	for name, content := range testParts {
+		parts[name] = content
+	}
+	parts["xl/workbook.xml"] = strings.Replace(parts["xl/workbook.xml"], "<sheets>", `<workbookPr date1904="1"/><sheets>`, 1)
+	r := testXLSX(t, parts)
+	wb, err := ReadXLSX(r, int64(r.Len()))
+	if err != nil {
+		t.Fatalf("ReadXLSX failed, Error: %v", err)
+	}
+	tt := []struct {
+		sheet string
+		cell  string
+		value interface{}
+	}{
+		{"Data", "C1", 43466.0 + 1462},
+		{"Data", "B1", 0.5},
+		{"Q1 Report", "A2", 20.0 + 1462},
+	}
+	var errCnt int
+	for _, tu := range tt {
+		if c := wb.Sheet(tu.sheet).Cell(tu.cell); c == nil || c.Value != tu.value {
+			t.Logf("Test: %v!%v, Expected: %v, Got: %v", tu.sheet, tu.cell, tu.value, c)
+			errCnt++
+		}
+	}
+	if errCnt > 0 {
+		t.Errorf("Failed %v of %v test cases", errCnt, len(tt))
+	}
+}
+
+func TestSerialDate(t *testing.T) {
+	tt := []struct {
+		date   time.Time
+		serial float64
+	}{
+		{time.Date(1900, time.March, 1, 0, 0, 0, 0, time.UTC), 61},
+		{time.Date(2019, time.January, 1, 12, 0, 0, 0, time.UTC), 43466.5},
+		{time.Date(2500, time.January, 1, 0, 0, 0, 0, time.UTC), 219148},
+		{time.Date(9999, time.December, 31, 0, 0, 0, 0, time.UTC), 2958465},
+	}
+	var errCnt int
+	for _, tu := range tt {
+		if got := SerialDate(tu.date); got != tu.serial {
+			t.Logf("Test: %v, Expected: %v, Got: %v", tu.date, tu.serial, got)
+			errCnt++
+		}
+		if got := DateFromSerial(tu.serial); !got.Equal(tu.date) {
+			t.Logf("Test: %v, Expected: %v, Got: %v", tu.serial, tu.date, got)
+			errCnt++
+		}
+	}
+	if errCnt > 0 {
+		t.Errorf("Failed %v of %v test cases", errCnt, 2*len(tt))
+	}
+}
@@ -0,0 +1,436 @@
+// Copyright © 2019 Praveen Tirumandyam praveen.tirumandyam@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package efp
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	nsMain          = "http://schemas.openxmlformats.org/spreadsheetml/2006/main"
+	nsRelationships = "http://schemas.openxmlformats.org/officeDocument/2006/relationships"
+	nsPackageRels   = "http://schemas.openxmlformats.org/package/2006/relationships"
+	xmlHeader       = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n"
+	defaultDateFmt  = "yyyy-mm-dd"
+	firstCustomFmt  = 164
+	// calcID is the calculation engine of current Excel versions. Excel
+	// recalculates files written by an older engine in full when opening them
+	calcID = 191029
+)
+
+// futureFunctions are the functions added after Excel 2007, which files
+// store with the _xlfn. prefix
+var futureFunctions = map[string]bool{
+	"ARRAYTOTEXT": true, "BITAND": true, "BITLSHIFT": true, "BITOR": true, "BITRSHIFT": true,
+	"BITXOR": true, "CHOOSECOLS": true, "CHOOSEROWS": true, "CONCAT": true, "DROP": true,
+	"EXPAND": true, "HSTACK": true, "IMCOSH": true, "IMCOT": true, "IMCSC": true,
+	"IMCSCH": true, "IMSEC": true, "IMSECH": true, "IMSINH": true, "IMTAN": true,
+	"MUNIT": true, "REGEXEXTRACT": true, "REGEXREPLACE": true, "REGEXTEST": true, "SINGLE": true,
+	"TAKE": true, "TEXTAFTER": true, "TEXTBEFORE": true, "TEXTSPLIT": true, "TOCOL": true,
+	"TOROW": true, "VALUETOTEXT": true, "VSTACK": true, "WRAPCOLS": true, "WRAPROWS": true,
+}
+
+// fileFormula returns formula the way files store it with the functions in
+// futureFunctions prefixed by _xlfn
+func fileFormula(formula string) string {
+	toks, err := lex(formula)
+	if err != nil {
+		return formula
+	}
+	for i, t := range toks {
+		if t.kind == tokFunc && futureFunctions[strings.ToUpper(t.text)] {
+			toks[i].text = "_xlfn." + t.text
+		}
+	}
+	return joinTokens(toks)
+}
+
+// SaveXLSX writes workbook to .xlsx file at name
+func SaveXLSX(name string, wb *Workbook) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := WriteXLSX(f, wb); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// WriteXLSX writes workbook as an .xlsx package. Formula cells are written
+// with their formula and the value last computed for them so the file opens
+// in Excel without a recalculation. Call Workbook.Recalculate first to bring
+// the values up to date. Tables are written with the sheet they belong to;
+// tables on a sheet missing from the workbook are left out
+func WriteXLSX(w io.Writer, wb *Workbook) error {
+	xw := &xlsxWriter{
+		strIndex: make(map[string]int),
+		fmtIndex: make(map[string]int),
+		fmtIDs:   make(map[string]int),
+	}
+	// tables holds the tables of each sheet, numbered across the workbook
+	tables := make([][]*Table, len(wb.Sheets))
+	var tableCnt int
+	for _, t := range wb.Tables {
+		for i, s := range wb.Sheets {
+			if strings.EqualFold(t.Sheet, s.Name) {
+				tables[i] = append(tables[i], t)
+				tableCnt++
+				break
+			}
+		}
+	}
+	sheets := make([]string, len(wb.Sheets))
+	for i, s := range wb.Sheets {
+		sheets[i] = xw.sheet(s, len(tables[i]))
+	}
+
+	zw := zip.NewWriter(w)
+	parts := []struct {
+		name    string
+		content string
+	}{
+		{"[Content_Types].xml", contentTypes(len(wb.Sheets), tableCnt)},
+		{"_rels/.rels", xmlHeader + `<Relationships xmlns="` + nsPackageRels + `">` +
+			`<Relationship Id="rId1" Type="` + nsRelationships + `/officeDocument" Target="xl/workbook.xml"/></Relationships>`},
+		{"xl/workbook.xml", workbookXML(wb)},
+		{"xl/_rels/workbook.xml.rels", workbookRels(len(wb.Sheets))},
+		{"xl/sharedStrings.xml", xw.sharedStrings()},
+		{"xl/styles.xml", xw.styles()},
+	}
+	for _, p := range parts {
+		if err := writePart(zw, p.name, p.content); err != nil {
+			return err
+		}
+	}
+	var id int
+	for i, s := range sheets {
+		if err := writePart(zw, fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1), s); err != nil {
+			return err
+		}
+		if len(tables[i]) == 0 {
+			continue
+		}
+		if err := writePart(zw, fmt.Sprintf("xl/worksheets/_rels/sheet%d.xml.rels", i+1), sheetRels(id, len(tables[i]))); err != nil {
+			return err
+		}
+		for _, t := range tables[i] {
+			id++
+			if err := writePart(zw, fmt.Sprintf("xl/tables/table%d.xml", id), tableXML(id, t)); err != nil {
+				return err
+			}
+		}
+	}
+	return zw.Close()
+}
+
+func writePart(zw *zip.Writer, name, content string) error {
+	w, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, content)
+	return err
+}
+
+// escape returns s escaped for use in XML text and attribute values
+func escape(s string) string {
+	var sb strings.Builder
+	xml.EscapeText(&sb, []byte(s))
+	return sb.String()
+}
+
+func contentTypes(sheets, tables int) string {
+	var sb strings.Builder
+	sb.WriteString(xmlHeader)
+	sb.WriteString(`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">`)
+	sb.WriteString(`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>`)
+	sb.WriteString(`<Default Extension="xml" ContentType="application/xml"/>`)
+	sb.WriteString(`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>`)
+	for i := 1; i <= sheets; i++ {
+		fmt.Fprintf(&sb, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, i)
+	}
+	for i := 1; i <= tables; i++ {
+		fmt.Fprintf(&sb, `<Override PartName="/xl/tables/table%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.table+xml"/>`, i)
+	}
+	sb.WriteString(`<Override PartName="/xl/sharedStrings.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sharedStrings+xml"/>`)
+	sb.WriteString(`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>`)
+	sb.WriteString(`</Types>`)
+	return sb.String()
+}
+
+func workbookXML(wb *Workbook) string {
+	var sb strings.Builder
+	sb.WriteString(xmlHeader)
+	sb.WriteString(`<workbook xmlns="` + nsMain + `" xmlns:r="` + nsRelationships + `"><sheets>`)
+	for i, s := range wb.Sheets {
+		fmt.Fprintf(&sb, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, escape(s.Name), i+1, i+1)
+	}
+	sb.WriteString(`</sheets>`)
+	if len(wb.Names) > 0 {
+		sb.WriteString(`<definedNames>`)
+		for _, n := range wb.Names {
+			local := ""
+			for i, s := range wb.Sheets {
+				if n.Scope != "" && strings.EqualFold(s.Name, n.Scope) {
+					local = fmt.Sprintf(` localSheetId="%d"`, i)
+				}
+			}
+			fmt.Fprintf(&sb, `<definedName name="%s"%s>%s</definedName>`, escape(n.Name), local, escape(fileFormula(n.Formula)))
+		}
+		sb.WriteString(`</definedNames>`)
+	}
+	fmt.Fprintf(&sb, `<calcPr calcId="%d"/></workbook>`, calcID)
+	return sb.String()
+}
+
+func workbookRels(sheets int) string {
+	var sb strings.Builder
+	sb.WriteString(xmlHeader)
+	sb.WriteString(`<Relationships xmlns="` + nsPackageRels + `">`)
+	for i := 1; i <= sheets; i++ {
+		fmt.Fprintf(&sb, `<Relationship Id="rId%d" Type="%s/worksheet" Target="worksheets/sheet%d.xml"/>`, i, nsRelationships, i)
+	}
+	fmt.Fprintf(&sb, `<Relationship Id="rId%d" Type="%s/sharedStrings" Target="sharedStrings.xml"/>`, sheets+1, nsRelationships)
+	fmt.Fprintf(&sb, `<Relationship Id="rId%d" Type="%s/styles" Target="styles.xml"/>`, sheets+2, nsRelationships)
+	sb.WriteString(`</Relationships>`)
+	return sb.String()
+}
+
+// sheetRels returns the relationships of a sheet to its tables, which follow
+// table number first
+func sheetRels(first, tables int) string {
+	var sb strings.Builder
+	sb.WriteString(xmlHeader)
+	sb.WriteString(`<Relationships xmlns="` + nsPackageRels + `">`)
+	for i := 1; i <= tables; i++ {
+		fmt.Fprintf(&sb, `<Relationship Id="rId%d" Type="%s/table" Target="../tables/table%d.xml"/>`, i, nsRelationships, first+i)
+	}
+	sb.WriteString(`</Relationships>`)
+	return sb.String()
+}
+
+func tableXML(id int, t *Table) string {
+	ref := Ref{From: cellKey(t.Ref.From), To: cellKey(t.Ref.To)}
+	var sb strings.Builder
+	sb.WriteString(xmlHeader)
+	fmt.Fprintf(&sb, `<table xmlns="%s" id="%d" name="%s" displayName="%s" ref="%s"`, nsMain, id, escape(t.Name), escape(t.Name), ref)
+	if !t.HeaderRow {
+		sb.WriteString(` headerRowCount="0"`)
+	}
+	if t.TotalsRow {
+		sb.WriteString(` totalsRowCount="1"`)
+	}
+	sb.WriteString(`>`)
+	fmt.Fprintf(&sb, `<tableColumns count="%d">`, len(t.Columns))
+	for i, c := range t.Columns {
+		fmt.Fprintf(&sb, `<tableColumn id="%d" name="%s"/>`, i+1, escape(c))
+	}
+	sb.WriteString(`</tableColumns><tableStyleInfo name="TableStyleMedium2" showRowStripes="1"/></table>`)
+	return sb.String()
+}
+
+// xlsxWriter collects the shared strings and number formats used by the
+// sheets while they are written
+type xlsxWriter struct {
+	strs     []string
+	strIndex map[string]int
+	fmts     []string
+	fmtIndex map[string]int
+	fmtIDs   map[string]int
+	nextFmt  int
+}
+
+// sharedString returns index of s in the shared string table
+func (xw *xlsxWriter) sharedString(s string) int {
+	if i, ok := xw.strIndex[s]; ok {
+		return i
+	}
+	xw.strs = append(xw.strs, s)
+	xw.strIndex[s] = len(xw.strs) - 1
+	return len(xw.strs) - 1
+}
+
+// style returns the index of cell format using number format code. Index 0
+// is the default General format
+func (xw *xlsxWriter) style(code string) int {
+	if code == "" || code == "General" {
+		return 0
+	}
+	if i, ok := xw.fmtIndex[code]; ok {
+		return i
+	}
+	id := -1
+	for bid, bcode := range builtinNumFmts {
+		if bcode == code {
+			id = bid
+			break
+		}
+	}
+	if id < 0 {
+		id = firstCustomFmt + xw.nextFmt
+		xw.nextFmt++
+	}
+	xw.fmts = append(xw.fmts, code)
+	xw.fmtIDs[code] = id
+	xw.fmtIndex[code] = len(xw.fmts)
+	return len(xw.fmts)
+}
+
+// sheet returns the worksheet part of s, which refers to its tables as rId1
+// to rId<tables>
+func (xw *xlsxWriter) sheet(s *Sheet, tables int) string {
+	refs := make([]CellRef, 0, len(s.Cells))
+	for k := range s.Cells {
+		refs = append(refs, k)
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		if refs[i].Row != refs[j].Row {
+			return refs[i].Row < refs[j].Row
+		}
+		return refs[i].Col < refs[j].Col
+	})
+
+	var sb strings.Builder
+	sb.WriteString(xmlHeader)
+	sb.WriteString(`<worksheet xmlns="` + nsMain + `" xmlns:r="` + nsRelationships + `"><sheetData>`)
+	row := 0
+	for _, k := range refs {
+		if k.Row != row {
+			if row != 0 {
+				sb.WriteString(`</row>`)
+			}
+			row = k.Row
+			fmt.Fprintf(&sb, `<row r="%d">`, row)
+		}
+		xw.cell(&sb, k, s.Cells[k])
+	}
+	if row != 0 {
+		sb.WriteString(`</row>`)
+	}
+	sb.WriteString(`</sheetData>`)
+	if tables > 0 {
+		fmt.Fprintf(&sb, `<tableParts count="%d">`, tables)
+		for i := 1; i <= tables; i++ {
+			fmt.Fprintf(&sb, `<tablePart r:id="rId%d"/>`, i)
+		}
+		sb.WriteString(`</tableParts>`)
+	}
+	sb.WriteString(`</worksheet>`)
+	return sb.String()
+}
+
+func (xw *xlsxWriter) cell(sb *strings.Builder, k CellRef, c *Cell) {
+	numFmt := c.NumFmt
+	if _, ok := c.Value.(time.Time); ok && numFmt == "" {
+		numFmt = defaultDateFmt
+	}
+	fmt.Fprintf(sb, `<c r="%s"`, k)
+	if s := xw.style(numFmt); s != 0 {
+		fmt.Fprintf(sb, ` s="%d"`, s)
+	}
+	var typ, val string
+	switch v := c.Value.(type) {
+	case nil:
+	case string:
+		if c.Formula != "" {
+			typ, val = "str", v
+		} else {
+			typ, val = "s", strconv.Itoa(xw.sharedString(v))
+		}
+	case bool:
+		typ, val = "b", "0"
+		if v {
+			val = "1"
+		}
+	case ErrorValue:
+		typ, val = "e", string(v)
+	case time.Time:
+		val = strconv.FormatFloat(SerialDate(v), 'g', -1, 64)
+	default:
+		if n, err := toNumber(v); err == nil {
+			val = strconv.FormatFloat(n, 'g', -1, 64)
+		} else {
+			typ, val = "str", toString(v)
+			if c.Formula == "" {
+				typ, val = "s", strconv.Itoa(xw.sharedString(toString(v)))
+			}
+		}
+	}
+	if typ != "" {
+		fmt.Fprintf(sb, ` t="%s"`, typ)
+	}
+	sb.WriteString(`>`)
+	if c.Formula != "" {
+		fmt.Fprintf(sb, `<f>%s</f>`, escape(fileFormula(c.Formula)))
+	}
+	if c.Value != nil {
+		fmt.Fprintf(sb, `<v>%s</v>`, escape(val))
+	}
+	sb.WriteString(`</c>`)
+}
+
+func (xw *xlsxWriter) sharedStrings() string {
+	var sb strings.Builder
+	sb.WriteString(xmlHeader)
+	fmt.Fprintf(&sb, `<sst xmlns="%s" count="%d" uniqueCount="%d">`, nsMain, len(xw.strs), len(xw.strs))
+	for _, s := range xw.strs {
+		fmt.Fprintf(&sb, `<si><t xml:space="preserve">%s</t></si>`, escape(s))
+	}
+	sb.WriteString(`</sst>`)
+	return sb.String()
+}
+
+func (xw *xlsxWriter) styles() string {
+	var sb strings.Builder
+	sb.WriteString(xmlHeader)
+	sb.WriteString(`<styleSheet xmlns="` + nsMain + `">`)
+	custom := 0
+	for _, code := range xw.fmts {
+		if xw.fmtIDs[code] >= firstCustomFmt {
+			custom++
+		}
+	}
+	if custom > 0 {
+		fmt.Fprintf(&sb, `<numFmts count="%d">`, custom)
+		for _, code := range xw.fmts {
+			if id := xw.fmtIDs[code]; id >= firstCustomFmt {
+				fmt.Fprintf(&sb, `<numFmt numFmtId="%d" formatCode="%s"/>`, id, escape(code))
+			}
+		}
+		sb.WriteString(`</numFmts>`)
+	}
+	sb.WriteString(`<fonts count="1"><font><sz val="11"/><name val="Calibri"/></font></fonts>`)
+	sb.WriteString(`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>`)
+	sb.WriteString(`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>`)
+	sb.WriteString(`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>`)
+	fmt.Fprintf(&sb, `<cellXfs count="%d"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>`, len(xw.fmts)+1)
+	for _, code := range xw.fmts {
+		fmt.Fprintf(&sb, `<xf numFmtId="%d" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>`, xw.fmtIDs[code])
+	}
+	sb.WriteString(`</cellXfs>`)
+	sb.WriteString(`<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>`)
+	sb.WriteString(`</styleSheet>`)
+	return sb.String()
+}
@@ -0,0 +1,207 @@
+package efp
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteXLSX(t *testing.T) {
+	wb := NewWorkbook()
+	s := wb.AddSheet("Orders & Items")
+	s.SetValue("A1", "Qty")
+	s.SetValue("A2", 3.0)
+	s.SetValue("A3", true)
+	s.SetValue("A4", time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC))
+	s.SetValue("B1", "<Price>")
+	s.SetValue("B2", 2.5)
+	s.Cell("B2").NumFmt = "0.00"
+	s.SetFormula("C2", "A2*B2")
+	s.Cell("C2").NumFmt = `#,##0.000 "units"`
+	s.SetFormula("C3", `A1&" total"`)
+	s.SetFormula("C4", "A2/0")
+	wb.Names = append(wb.Names, &DefinedName{Name: "Qty", Scope: "Orders & Items", Formula: "'Orders & Items'!$A$2"})
+	if err := wb.Recalculate(context.Background()); err != nil {
+		t.Fatalf("Recalculate failed, Error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteXLSX(&buf, wb); err != nil {
+		t.Fatalf("WriteXLSX failed, Error: %v", err)
+	}
+	rd, err := ReadXLSX(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("ReadXLSX of written file failed, Error: %v", err)
+	}
+	rs := rd.Sheet("Orders & Items")
+	if rs == nil {
+		t.Fatalf("Sheet not found in written file")
+	}
+	tt := []struct {
+		cell    string
+		formula string
+		value   interface{}
+		numFmt  string
+	}{
+		{"A1", "", "Qty", ""},
+		{"A2", "", 3.0, ""},
+		{"A3", "", true, ""},
+		{"A4", "", 43466.0, defaultDateFmt},
+		{"B1", "", "<Price>", ""},
+		{"B2", "", 2.5, "0.00"},
+		{"C2", "A2*B2", 7.5, `#,##0.000 "units"`},
+		{"C3", `A1&" total"`, "Qty total", ""},
+		{"C4", "A2/0", ErrDiv0, ""},
+	}
+	var errCnt int
+	for _, tu := range tt {
+		c := rs.Cell(tu.cell)
+		if c == nil {
+			t.Logf("Cell: %v, not found", tu.cell)
+			errCnt++
+			continue
+		}
+		if c.Formula != tu.formula || c.Value != tu.value || c.NumFmt != tu.numFmt {
+			t.Logf("Cell: %v, Expected: %q %v %q, Got: %q %v %q", tu.cell, tu.formula, tu.value, tu.numFmt, c.Formula, c.Value, c.NumFmt)
+			errCnt++
+		}
+	}
+	if len(rd.Names) != 1 || rd.Names[0].Scope != "Orders & Items" {
+		t.Logf("Defined names not written, Got: %v", rd.Names)
+		errCnt++
+	}
+	if errCnt > 0 {
+		t.Errorf("Failed %v of %v test cases", errCnt, len(tt)+1)
+	}
+}
+
+func TestWriteXLSXFormulas(t *testing.T) {
+	wb := NewWorkbook()
+	s := wb.AddSheet("Sheet1")
+	s.SetValue("A1", "a-b")
+	s.SetFormula("B1", `REGEXTEST(A1,"-")`)
+	s.SetFormula("B2", `LEN(textbefore(A1,"-"))*2`)
+	s.SetFormula("B3", `_xlfn.TEXTAFTER(A1,"-")`)
+	s.SetFormula("B4", `"TAKE("&A1`)
+	if err := wb.Recalculate(context.Background()); err != nil {
+		t.Fatalf("Recalculate failed, Error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteXLSX(&buf, wb); err != nil {
+		t.Fatalf("WriteXLSX failed, Error: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("Written file is not a zip, Error: %v", err)
+	}
+	var workbook string
+	for _, f := range zr.File {
+		if f.Name != "xl/workbook.xml" {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("Opening %v failed, Error: %v", f.Name, err)
+		}
+		b, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("Reading %v failed, Error: %v", f.Name, err)
+		}
+		workbook = string(b)
+	}
+	if strings.Contains(workbook, `calcId="0"`) || !strings.Contains(workbook, `<calcPr calcId=`) {
+		t.Errorf("Workbook does not keep the calculated values, Got: %v", workbook)
+	}
+
+	rd, err := ReadXLSX(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("ReadXLSX of written file failed, Error: %v", err)
+	}
+	rs := rd.Sheet("Sheet1")
+	tt := []struct {
+		cell    string
+		formula string
+		value   interface{}
+	}{
+		{"B1", `_xlfn.REGEXTEST(A1,"-")`, true},
+		{"B2", `LEN(_xlfn.textbefore(A1,"-"))*2`, 2.0},
+		{"B3", `_xlfn.TEXTAFTER(A1,"-")`, "b"},
+		{"B4", `"TAKE("&A1`, "TAKE(a-b"},
+	}
+	var errCnt int
+	for _, tu := range tt {
+		c := rs.Cell(tu.cell)
+		if c == nil || c.Formula != tu.formula || c.Value != tu.value {
+			t.Logf("Cell: %v, Expected: %q %v, Got: %v", tu.cell, tu.formula, tu.value, c)
+			errCnt++
+		}
+	}
+	if errCnt > 0 {
+		t.Errorf("Failed %v of %v test cases", errCnt, len(tt))
+	}
+}
+
+func TestWriteXLSXTables(t *testing.T) {
+	wb := NewWorkbook()
+	s := wb.AddSheet("Sales")
+	s.SetValue("A1", "Item")
+	s.SetValue("B1", "Qty & Price")
+	s.SetValue("A2", "Pen")
+	s.SetValue("B2", 2.0)
+	s.SetValue("A3", "Ink")
+	s.SetValue("B3", 3.0)
+	if _, err := wb.AddTable("Orders", "Sales", "A1:B3"); err != nil {
+		t.Fatalf("AddTable failed, Error: %v", err)
+	}
+	r := wb.AddSheet("Report")
+	r.SetValue("D4", 1.0)
+	r.SetValue("D5", 2.0)
+	totals, err := wb.AddTable("Totals", "Report", "D4:D5")
+	if err != nil {
+		t.Fatalf("AddTable failed, Error: %v", err)
+	}
+	totals.HeaderRow = false
+	totals.TotalsRow = true
+	r.SetFormula("A1", "SUM(Orders[Qty & Price])")
+	if err := wb.Recalculate(context.Background()); err != nil {
+		t.Fatalf("Recalculate failed, Error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteXLSX(&buf, wb); err != nil {
+		t.Fatalf("WriteXLSX failed, Error: %v", err)
+	}
+	rd, err := ReadXLSX(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("ReadXLSX of written file failed, Error: %v", err)
+	}
+	if len(rd.Tables) != len(wb.Tables) {
+		t.Fatalf("Expected %v tables, Got: %v", len(wb.Tables), len(rd.Tables))
+	}
+	var errCnt int
+	for i, tb := range wb.Tables {
+		got := rd.Tables[i]
+		if got.Name != tb.Name || got.Sheet != tb.Sheet || got.Ref != tb.Ref ||
+			got.HeaderRow != tb.HeaderRow || got.TotalsRow != tb.TotalsRow ||
+			strings.Join(got.Columns, "|") != strings.Join(tb.Columns, "|") {
+			t.Logf("Test: %v, Expected: %+v, Got: %+v", tb.Name, tb, got)
+			errCnt++
+		}
+	}
+	if err := rd.Recalculate(context.Background()); err != nil {
+		t.Fatalf("Recalculate of read workbook failed, Error: %v", err)
+	}
+	if c := rd.Sheet("Report").Cell("A1"); c == nil || c.Value != 5.0 {
+		t.Logf("Test: %v, Expected: %v, Got: %v", "Orders[Qty & Price]", 5.0, c)
+		errCnt++
+	}
+	if errCnt > 0 {
+		t.Errorf("Failed %v of %v test cases", errCnt, len(wb.Tables)+1)
+	}
+}